@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/ehazlett/dialogue"
 	"github.com/ehazlett/dialogue/auth"
@@ -15,15 +21,31 @@ import (
 
 type (
 	dialogueApi struct {
-		m       *martini.ClassicMartini
-		rdb     *db.Rethinkdb
-		auth    auth.Authenticator
-		address string
+		m           *martini.ClassicMartini
+		rdb         db.Db
+		auth        auth.Authenticator
+		notifier    *notifier
+		inbound     *inboundGateway
+		events      *eventHub
+		attachments *attachmentStore
+		limiter     *rateLimiter
+		metrics     *metrics
+		workers     map[string]*heartbeat
+		server      *http.Server
+		certs       *certLoader
+		address     string
 	}
 	AuthToken struct {
 		Token string `json:"token"`
 	}
+	// ApiError is the body of every error response.  Code is a stable
+	// identifier derived from the status (see errorCodes) unless set.
 	ApiError struct {
+		Code      string            `json:"code"`
+		Message   string            `json:"message"`
+		Details   map[string]string `json:"details,omitempty"`
+		RequestId string            `json:"requestId,omitempty"`
+		// Error repeats Message for clients of the unversioned api
 		Error string `json:"error"`
 	}
 	ApiResponse struct {
@@ -31,42 +53,155 @@ type (
 	}
 )
 
-func NewApi(address string, rdb *db.Rethinkdb, auth auth.Authenticator, sessionKey string) (*dialogueApi, error) {
-	m := martini.Classic()
+func NewApi(address string, rdb db.Db, auth auth.Authenticator, n *notifier, sessionKey string) (*dialogueApi, error) {
+	// martini.Classic without its logger; requests are logged by requestLog
+	router := martini.NewRouter()
+	base := martini.New()
+	base.Use(martini.Recovery())
+	base.Use(martini.Static("public"))
+	base.MapTo(router, (*martini.Routes)(nil))
+	base.Action(router.Handle)
+	m := &martini.ClassicMartini{Martini: base, Router: router}
 	// sessions
 	store := sessions.NewCookieStore([]byte(sessionKey))
 	m.Use(sessions.Sessions("dialogue", store))
 
 	a := &dialogueApi{
-		m:       m,
-		rdb:     rdb,
-		auth:    auth,
-		address: address,
+		m:        m,
+		rdb:      rdb,
+		auth:     auth,
+		notifier: n,
+		events:   newEventHub(),
+		metrics:  newMetrics(),
+		workers:  map[string]*heartbeat{},
+		address:  address,
 	}
+	a.server = &http.Server{
+		Addr:    address,
+		Handler: m,
+	}
+	a.server.RegisterOnShutdown(a.events.Close)
 	// middleware
 	m.Use(render.Renderer())
+	m.Use(requestId)
+	m.Use(requestLog)
+	m.Use(a.measure)
+	m.Use(a.rateLimit)
+	m.Use(jsonBody)
 	// routes
+	rt := apiRoutes{m.Router}
 	// content
-	m.Get("/topics", a.apiAuthorize, a.GetTopics)
-	m.Post("/topics", a.apiAuthorize, a.PostTopics)
-	m.Post("/topics/:topicId", a.apiAuthorize, a.PostTopicsPosts)
-	m.Get("/topics/:topicId", a.apiAuthorize, a.GetTopic)
-	m.Delete("/topics/:topicId", a.apiAuthorize, a.DeleteTopic)
-	m.Delete("/posts/:postId", a.apiAuthorize, a.DeletePost)
+	rt.Get("/topics", a.apiAuthorize, a.GetTopics)
+	rt.Post("/topics", a.apiAuthorize, a.PostTopics)
+	rt.Post("/topics/:topicId", a.apiAuthorize, a.PostTopicsPosts)
+	rt.Get("/topics/:topicId/posts", a.apiAuthorize, a.GetTopicPosts)
+	// the unversioned path returned the posts of the topic
+	m.Get(apiVersion+"/topics/:topicId", a.apiAuthorize, a.GetTopic)
+	m.Get("/topics/:topicId", deprecatedRoute, a.apiAuthorize, a.GetTopicPosts)
+	rt.Put("/topics/:topicId", a.apiAuthorize, a.PutTopic)
+	rt.Post("/topics/:topicId/read", a.apiAuthorize, a.PostTopicRead)
+	rt.Post("/topics/:topicId/archive", a.apiAuthorize, a.PostTopicArchive)
+	rt.Delete("/topics/:topicId/archive", a.apiAuthorize, a.DeleteTopicArchive)
+	rt.Post("/topics/:topicId/sticky", a.apiAuthorize, a.PostTopicSticky)
+	rt.Delete("/topics/:topicId/sticky", a.apiAuthorize, a.DeleteTopicSticky)
+	rt.Get("/topics/:topicId/polls", a.apiAuthorize, a.GetTopicPolls)
+	rt.Post("/topics/:topicId/polls", a.apiAuthorize, a.PostTopicPolls)
+	rt.Get("/polls/:id", a.apiAuthorize, a.GetPoll)
+	rt.Post("/polls/:id/vote", a.apiAuthorize, a.PostPollVote)
+	rt.Delete("/topics/:topicId", a.apiAuthorize, a.DeleteTopic)
+	rt.Get("/posts", a.apiAuthorize, a.GetPosts)
+	rt.Get("/posts/:id", a.apiAuthorize, a.GetPost)
+	rt.Delete("/posts/:postId", a.apiAuthorize, a.DeletePost)
+	rt.Post("/posts/:id/reactions/:name", a.apiAuthorize, a.PostReaction)
+	rt.Delete("/posts/:id/reactions/:name", a.apiAuthorize, a.DeleteReaction)
+	rt.Post("/posts/:id/pin", a.apiAuthorize, a.PostPostPin)
+	rt.Delete("/posts/:id/pin", a.apiAuthorize, a.DeletePostPin)
+	rt.Get("/drafts", a.apiAuthorize, a.GetDrafts)
+	rt.Get("/drafts/:id", a.apiAuthorize, a.GetDraft)
+	rt.Put("/drafts/:id", a.apiAuthorize, a.PutDraft)
+	rt.Delete("/drafts/:id", a.apiAuthorize, a.DeleteDraft)
+	rt.Post("/drafts/:id/publish", a.apiAuthorize, a.PostDraftPublish)
+	rt.Post("/topics/:topicId/labels", a.apiAuthorize, a.PostTopicLabels)
+	rt.Delete("/topics/:topicId/labels/:name", a.apiAuthorize, a.DeleteTopicLabel)
+	rt.Post("/search", a.apiAuthorize, a.PostSearch)
+	// attachments
+	rt.Post("/attachments", a.apiAuthorize, a.PostAttachments)
+	rt.Get("/attachments/:id", a.apiAuthorize, a.GetAttachment)
+	rt.Get("/attachments/:id/content", a.apiAuthorize, a.GetAttachmentContent)
+	// trash
+	rt.Get("/trash", a.apiAuthorize, a.GetTrash)
+	rt.Delete("/trash", a.apiAuthorize, a.requireAdmin, a.DeleteTrash)
+	rt.Post("/trash/topics/:id/restore", a.apiAuthorize, a.PostTrashTopicRestore)
+	rt.Post("/trash/posts/:id/restore", a.apiAuthorize, a.PostTrashPostRestore)
+	// archive
+	rt.Post("/archive", a.apiAuthorize, a.requireAdmin, a.PostArchive)
+	// categories
+	rt.Get("/categories", a.apiAuthorize, a.GetCategories)
+	rt.Post("/categories", a.apiAuthorize, a.requireAdmin, a.PostCategories)
+	rt.Get("/categories/:id", a.apiAuthorize, a.GetCategory)
+	rt.Put("/categories/:id", a.apiAuthorize, a.requireAdmin, a.PutCategory)
+	rt.Delete("/categories/:id", a.apiAuthorize, a.requireAdmin, a.DeleteCategory)
+	rt.Get("/categories/:id/topics", a.apiAuthorize, a.GetCategoryTopics)
+	// labels
+	rt.Get("/labels", a.apiAuthorize, a.GetLabels)
+	rt.Post("/labels", a.apiAuthorize, a.requireAdmin, a.PostLabels)
+	rt.Put("/labels/:name", a.apiAuthorize, a.requireAdmin, a.PutLabel)
+	rt.Delete("/labels/:name", a.apiAuthorize, a.requireAdmin, a.DeleteLabel)
+	// subscriptions
+	rt.Get("/subscriptions", a.apiAuthorize, a.GetSubscriptions)
+	rt.Post("/subscriptions", a.apiAuthorize, a.PostSubscriptions)
+	rt.Delete("/subscriptions/:id", a.apiAuthorize, a.DeleteSubscription)
+	rt.Get("/unsubscribe/:token", a.GetUnsubscribe)
+	rt.Post("/unsubscribe/:token", a.PostUnsubscribe)
+	// inbox
+	rt.Get("/inbox", a.apiAuthorize, a.GetInbox)
+	rt.Post("/inbox/read", a.apiAuthorize, a.PostInboxReadAll)
+	rt.Post("/inbox/:id/read", a.apiAuthorize, a.PostInboxRead)
+	// realtime events
+	rt.Get("/events", a.apiAuthorize, a.GetEvents)
+	// inbound email
+	rt.Post("/inbound", a.PostInbound)
 
 	// authentication
-	m.Post("/auth", a.Authenticate)
-	m.Post("/users", a.apiAuthorize, a.PostUsers)
-	m.Put("/users/:username", a.apiAuthorize, a.PutUser)
+	rt.Post("/auth", a.Authenticate)
+	rt.Post("/users", a.apiAuthorize, a.PostUsers)
+	rt.Get("/users/:username", a.apiAuthorize, a.GetUser)
+	rt.Put("/users/:username", a.apiAuthorize, a.PutUser)
 	// setup
-	m.Get("/setup", a.Setup)
+	rt.Get("/setup", a.Setup)
+	// audit log
+	rt.Get("/audit", a.apiAuthorize, a.requireAdmin, a.GetAudit)
+	// monitoring
+	m.Get("/healthz", a.GetHealthz)
+	m.Get("/readyz", a.GetReadyz)
+	m.Get("/metrics", a.GetMetrics)
 
 	return a, nil
 }
 
+// Run serves the api until Shutdown is called.  TLS is used if
+// certificates are configured.
 func (api *dialogueApi) Run() {
-	log.Info("Listening on " + api.address)
-	log.Fatal(http.ListenAndServe(api.address, api.m))
+	var err error
+	if api.certs != nil {
+		api.server.TLSConfig = api.certs.Config()
+		log.Info("Listening on " + api.address + " (TLS)")
+		err = api.server.ListenAndServeTLS("", "")
+	} else {
+		log.Info("Listening on " + api.address)
+		err = api.server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests
+// to finish, for at most timeout
+func (api *dialogueApi) Shutdown(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return api.server.Shutdown(ctx)
 }
 
 func (api *dialogueApi) unmarshal(data string, v interface{}) error {
@@ -77,7 +212,7 @@ func (api *dialogueApi) Setup(r *http.Request, rndr render.Render) {
 	user, err := api.rdb.GetUser("admin")
 	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("Error checking for admin user: %s", err),
+			Message: fmt.Sprintf("Error checking for admin user: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
@@ -88,7 +223,7 @@ func (api *dialogueApi) Setup(r *http.Request, rndr render.Render) {
 		pw, err := api.auth.HashPassword("dialogue")
 		if err != nil {
 			e := ApiError{
-				Error: fmt.Sprintf("Error generating password for admin user: %s", err),
+				Message: fmt.Sprintf("Error generating password for admin user: %s", err),
 			}
 			rndr.JSON(500, e)
 			return
@@ -99,11 +234,12 @@ func (api *dialogueApi) Setup(r *http.Request, rndr render.Render) {
 		}
 		if err := api.rdb.SaveUser(user); err != nil {
 			e := ApiError{
-				Error: fmt.Sprintf("Error creating user: %s", err),
+				Message: fmt.Sprintf("Error creating user: %s", err),
 			}
 			rndr.JSON(500, e)
 			return
 		}
+		api.audit(r, dialogue.AUDIT_USER_CREATED, "", user.Username, nil)
 		r := ApiResponse{
 			Response: "admin user created: username: admin password: dialogue",
 		}
@@ -111,19 +247,19 @@ func (api *dialogueApi) Setup(r *http.Request, rndr render.Render) {
 		return
 	}
 	e := ApiError{
-		Error: "admin user already present",
+		Message: "admin user already present",
 	}
-	rndr.JSON(400, e)
+	rndr.JSON(409, e)
 	return
 }
 
-func (api *dialogueApi) apiAuthorize(r *http.Request, session sessions.Session, rndr render.Render) {
+func (api *dialogueApi) apiAuthorize(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
 	// check authorization headers
 	username := r.Header.Get("X-Auth-User")
 	token := r.Header.Get("X-Auth-Token")
 	if username == "" || token == "" {
 		e := ApiError{
-			Error: "username and token must be present",
+			Message: "username and token must be present",
 		}
 		rndr.JSON(401, e)
 		return
@@ -132,137 +268,640 @@ func (api *dialogueApi) apiAuthorize(r *http.Request, session sessions.Session,
 	auth, err := api.rdb.GetAuthorization(username)
 	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("error verifying token: %s", err),
+			Message: fmt.Sprintf("error verifying token: %s", err),
 		}
 		rndr.JSON(401, e)
 		return
 	}
 	if auth == nil || auth.Token != token {
 		e := ApiError{
-			Error: "invalid username/token",
+			Message: "invalid username/token",
 		}
 		rndr.JSON(401, e)
 		return
 	}
 	// all is well, set session
 	session.Set("username", username)
+	if api.limiter != nil {
+		api.limiter.LimitUser(w, r, username, rndr)
+	}
+}
+
+// measure records the request in the metrics
+func (api *dialogueApi) measure(c martini.Context, w http.ResponseWriter, r *http.Request, session sessions.Session) {
+	api.metrics.Handler(c, w, r, session)
+}
+
+// rateLimit applies the rate limiter for unauthenticated clients, if one
+// is configured
+func (api *dialogueApi) rateLimit(w http.ResponseWriter, r *http.Request, rndr render.Render) {
+	if api.limiter != nil {
+		api.limiter.Limit(w, r, rndr)
+	}
+}
+
+func isAdmin(username interface{}) bool {
+	return username == "admin"
+}
+
+// requireAdmin rejects requests from users other than admin
+func (api *dialogueApi) requireAdmin(session sessions.Session, rndr render.Render) {
+	if !isAdmin(session.Get("username")) {
+		e := ApiError{
+			Message: "you are not allowed to access this resource",
+		}
+		rndr.JSON(403, e)
+	}
 }
 
 // route handlers
-func (api *dialogueApi) GetTopic(params martini.Params, r render.Render) {
+// GetTopic returns a topic with its status, post count and the time of
+// the latest post
+func (api *dialogueApi) GetTopic(w http.ResponseWriter, req *http.Request, params martini.Params, session sessions.Session, r render.Render) {
+	username := session.Get("username").(string)
+	topic, ok := api.checkTopicAccess(params["topicId"], username, false, r)
+	if !ok {
+		return
+	}
+	count, last, err := api.rdb.GetTopicActivity(topic.Id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topic activity: %s", err),
+		}
+		r.JSON(500, e)
+		return
+	}
+	status := dialogue.TOPIC_OPEN
+	if topic.Archived {
+		status = dialogue.TOPIC_ARCHIVED
+	} else if topic.Closed {
+		status = dialogue.TOPIC_CLOSED
+	}
+	if last == nil {
+		last = &topic.Created
+	}
+	// the tag changes with the activity, but If-Match only compares the
+	// topic version so new posts don't conflict with edits
+	if notModified(w, req, etag(topic.Version, strconv.Itoa(count), strconv.FormatInt(last.UnixNano(), 36))) {
+		return
+	}
+	detail := &dialogue.TopicDetail{
+		Topic:        topic,
+		Status:       status,
+		PostCount:    count,
+		LastActivity: last,
+	}
+	r.JSON(200, detail)
+}
+
+// GetTopicPosts returns the posts in a topic
+func (api *dialogueApi) GetTopicPosts(req *http.Request, params martini.Params, session sessions.Session, r render.Render) {
+	username := session.Get("username").(string)
 	topicId := params["topicId"]
+	if _, ok := api.checkTopicAccess(topicId, username, false, r); !ok {
+		return
+	}
 	res, err := api.rdb.GetPosts(topicId)
 	if err != nil {
 		e := ApiError{
-			Error: "Error getting posts",
+			Message: "Error getting posts",
 		}
 		r.JSON(500, e)
 		return
 	}
+	if !api.formatPosts(res, req.URL.Query().Get("format"), r) {
+		return
+	}
+	summarizePosts(res)
 	r.JSON(200, res)
 }
 
-func (api *dialogueApi) GetTopics(params martini.Params, r render.Render) {
-	res, err := api.rdb.GetTopics()
+func (api *dialogueApi) GetTopics(req *http.Request, session sessions.Session, params martini.Params, r render.Render) {
+	username := session.Get("username").(string)
+	topics, err := api.findTopics(username, req.URL.Query())
 	if err != nil {
 		e := ApiError{
-			Error: "Error getting topics",
+			Message: fmt.Sprintf("Error getting topics: %s", err),
 		}
 		r.JSON(500, e)
 		return
 	}
-	r.JSON(200, res)
+	r.JSON(200, topics)
 }
 
-func (api *dialogueApi) PostTopics(w http.ResponseWriter, r *http.Request, rndr render.Render) {
-	title := r.FormValue("title")
-	// check for title
-	if title == "" {
+// findTopics returns the topics username can read that match the
+// GET /topics query parameters
+func (api *dialogueApi) findTopics(username string, query url.Values) ([]*dialogue.Topic, error) {
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		return nil, err
+	}
+	var categories map[string]bool
+	if id := query.Get("category"); id != "" {
+		categories = map[string]bool{id: true}
+		if query.Get("recursive") == "true" {
+			for _, c := range tree.descendants(id) {
+				categories[c] = true
+			}
+		}
+	}
+	var res []*dialogue.Topic
+	labels := query["label"]
+	matchAll := query.Get("labelMode") != "or"
+	switch {
+	case len(labels) > 0:
+		res, err = api.rdb.GetTopicsByLabels(labels, matchAll)
+	case categories != nil:
+		var ids []string
+		for id := range categories {
+			ids = append(ids, id)
+		}
+		res, err = api.rdb.GetTopicsByCategory(ids)
+	default:
+		res, err = api.rdb.GetTopics()
+	}
+	if err != nil {
+		return nil, err
+	}
+	readable := []*dialogue.Topic{}
+	ids := []string{}
+	for _, t := range res {
+		if !tree.canRead(t.CategoryId, username) {
+			continue
+		}
+		if categories != nil && !categories[t.CategoryId] {
+			continue
+		}
+		readable = append(readable, t)
+		ids = append(ids, t.Id)
+	}
+	counts, err := api.rdb.GetUnreadCounts(username, ids)
+	if err != nil {
+		return nil, err
+	}
+	unreadOnly := query.Get("unread") == "true"
+	archived := query.Get("archived")
+	overdueOnly := query.Get("overdue") == "true"
+	priority := query.Get("priority")
+	assignee := query.Get("assignee")
+	if assignee == "me" {
+		assignee = username
+	}
+	now := time.Now()
+	topics := []*dialogue.Topic{}
+	for _, t := range readable {
+		// archived topics are only listed on request
+		if archived != "all" && t.Archived != (archived == "true") {
+			continue
+		}
+		t.UnreadCount = counts[t.Id]
+		t.HasUnread = t.UnreadCount > 0
+		if unreadOnly && !t.HasUnread {
+			continue
+		}
+		if assignee != "" && !t.IsAssigned(assignee) {
+			continue
+		}
+		if overdueOnly && !t.IsOverdue(now) {
+			continue
+		}
+		if priority != "" && t.Priority != priority {
+			continue
+		}
+		topics = append(topics, t)
+	}
+	sort.Stable(stickyFirst{topics: topics, category: categories != nil})
+	return topics, nil
+}
+
+// checkTopicAccess returns the topic if username is allowed to read it (or
+// post in it, if post is true).  Otherwise an error is rendered.
+func (api *dialogueApi) checkTopicAccess(topicId string, username string, post bool, rndr render.Render) (*dialogue.Topic, bool) {
+	topic, err := api.rdb.GetTopic(topicId)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topic: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	if topic == nil || !tree.canRead(topic.CategoryId, username) {
+		e := ApiError{
+			Message: "topic not found",
+		}
+		rndr.JSON(404, e)
+		return nil, false
+	}
+	if post && !checkTopicPost(tree, topic, username, false, rndr) {
+		return nil, false
+	}
+	return topic, true
+}
+
+// checkTopicPost renders an error and returns false unless username may
+// post in or change the topic.  Archived and closed topics are read-only;
+// if reopen is true, closed topics are allowed so that they can be
+// reopened.
+func checkTopicPost(tree categoryTree, topic *dialogue.Topic, username string, reopen bool, rndr render.Render) bool {
+	if !tree.canPost(topic.CategoryId, username) {
+		e := ApiError{
+			Message: "you are not allowed to post in this topic",
+		}
+		rndr.JSON(403, e)
+		return false
+	}
+	if topic.Archived {
+		e := ApiError{
+			Message: "topic is archived",
+		}
+		rndr.JSON(409, e)
+		return false
+	}
+	if topic.Closed && !reopen {
+		e := ApiError{
+			Message: "topic is closed",
+		}
+		rndr.JSON(409, e)
+		return false
+	}
+	return true
+}
+
+// maxUpdateAttempts limits how often updateTopic retries a change
+const maxUpdateAttempts = 5
+
+// updateTopic applies change to topic and saves it.  Requests that don't
+// send If-Match use it so that concurrent edits of other fields are not
+// reported as conflicts: if the topic has changed since it was read, it is
+// read again and change is applied to the current version.  change returns
+// false if there is nothing to save.
+func (api *dialogueApi) updateTopic(topic *dialogue.Topic, change func(*dialogue.Topic) bool) error {
+	for attempt := 1; ; attempt++ {
+		if !change(topic) {
+			return nil
+		}
+		err := api.rdb.UpdateTopic(topic)
+		if err != db.ErrVersionConflict || attempt == maxUpdateAttempts {
+			return err
+		}
+		if topic, err = api.rdb.GetTopic(topic.Id); err != nil {
+			return err
+		}
+		if topic == nil {
+			return db.ErrTopicNotFound
+		}
+	}
+}
+
+// parseTime parses RFC 3339 times as well as dates and times without a
+// zone, which are interpreted in the server's local time zone
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s", v)
+}
+
+// PutTopic updates the fields of a topic that are present in the request
+func (api *dialogueApi) PutTopic(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	topicId := params["topicId"]
+	topic, ok := api.checkTopicAccess(topicId, username, false, rndr)
+	if !ok {
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	// closed topics can only be changed by reopening them
+	if !checkTopicPost(tree, topic, username, r.FormValue("closed") == "false", rndr) {
+		return
+	}
+	if !checkIfMatch(r, topic.Version, rndr) {
+		return
+	}
+	if !validateRequest(r, topicSchema, rndr) {
+		return
+	}
+	if _, ok := r.Form["title"]; ok {
+		title := r.FormValue("title")
+		if title == "" {
+			e := ApiError{
+				Message: "title must not be empty",
+				Details: map[string]string{"title": "required"},
+			}
+			rndr.JSON(422, e)
+			return
+		}
+		topic.Title = title
+	}
+	if _, ok := r.Form["closed"]; ok {
+		topic.Closed = r.FormValue("closed") == "true"
+	}
+	if assignees, ok := r.Form["assignee"]; ok {
+		topic.Assignees = []string{}
+		for _, a := range assignees {
+			if a == "" || topic.IsAssigned(a) {
+				continue
+			}
+			user, err := api.rdb.GetUser(a)
+			if err != nil {
+				e := ApiError{
+					Message: fmt.Sprintf("Error getting user: %s", err),
+				}
+				rndr.JSON(500, e)
+				return
+			}
+			if user == nil {
+				e := ApiError{
+					Message: fmt.Sprintf("unknown user: %s", a),
+				}
+				rndr.JSON(400, e)
+				return
+			}
+			topic.Assignees = append(topic.Assignees, a)
+		}
+	}
+	dueChanged := false
+	if _, ok := r.Form["due"]; ok {
+		topic.Due = nil
+		if v := r.FormValue("due"); v != "" {
+			due, err := parseTime(v)
+			if err != nil {
+				e := ApiError{
+					Message: err.Error(),
+				}
+				rndr.JSON(400, e)
+				return
+			}
+			topic.Due = &due
+		}
+		dueChanged = true
+	}
+	if _, ok := r.Form["categoryId"]; ok {
+		categoryId := r.FormValue("categoryId")
+		if !api.checkCategoryPost(categoryId, username, rndr) {
+			return
+		}
+		topic.CategoryId = categoryId
+	}
+	if _, ok := r.Form["priority"]; ok {
+		topic.Priority = r.FormValue("priority")
+	}
+	if err := api.rdb.UpdateTopic(topic); err != nil {
+		if err == db.ErrVersionConflict {
+			versionConflict(rndr)
+			return
+		}
 		e := ApiError{
-			Error: "title must be specified",
+			Message: fmt.Sprintf("Error updating topic: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
+	if dueChanged {
+		// send reminders for the new due date
+		if err := api.rdb.ResetTopicReminders(topic.Id); err != nil {
+			log.Errorf("Error resetting reminders for topic %s: %s", topic.Id, err)
+		}
+	}
+	w.Header().Set("ETag", etag(topic.Version))
+	w.WriteHeader(204)
+}
+
+// PostTopicRead marks all posts in a topic as read by the current user
+func (api *dialogueApi) PostTopicRead(w http.ResponseWriter, session sessions.Session, params martini.Params, rndr render.Render) {
+	username := session.Get("username").(string)
+	topicId := params["topicId"]
+	if _, ok := api.checkTopicAccess(topicId, username, false, rndr); !ok {
+		return
+	}
+	if err := api.rdb.SaveReadMarker(username, topicId, time.Now()); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error marking topic read: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) PostTopics(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if !validateRequest(r, newTopicSchema, rndr) {
+		return
+	}
+	title := r.FormValue("title")
+	categoryId := r.FormValue("categoryId")
+	if categoryId == "" {
+		categoryId = dialogue.DEFAULT_CATEGORY
+	}
+	if !api.checkCategoryPost(categoryId, username, rndr) {
+		return
+	}
 	// new topic
 	topic := &dialogue.Topic{
-		Title:  title,
-		Closed: false,
+		Title:      title,
+		Closed:     false,
+		Priority:   dialogue.PRIORITY_NORMAL,
+		CategoryId: categoryId,
 	}
 	if err := api.rdb.SaveTopic(topic); err != nil {
+		status := 500
+		if err == db.ErrTopicExists {
+			status = 409
+		}
 		e := ApiError{
-			Error: fmt.Sprintf("Error saving topic: %s", err),
+			Message: fmt.Sprintf("Error saving topic: %s", err),
 		}
-		rndr.JSON(500, e)
+		rndr.JSON(status, e)
 		return
 	}
-	w.WriteHeader(204)
+	api.publishInCategory(topic.CategoryId, dialogue.EVENT_TOPIC_CREATED, topic)
+	w.Header().Set("Location", apiVersion+"/topics/"+topic.Id)
+	rndr.JSON(201, topic)
 }
 
+// PostTopicsPosts creates a post.  Files can be attached by sending the
+// request as multipart/form-data with "file" fields, or by referencing
+// uploads from POST /attachments with "attachment" values.
 func (api *dialogueApi) PostTopicsPosts(w http.ResponseWriter, r *http.Request, session sessions.Session, params martini.Params, rndr render.Render) {
+	if !api.parseUpload(w, r, rndr) {
+		return
+	}
+	if !validateRequest(r, postSchema, rndr) {
+		return
+	}
 	content := r.FormValue("content")
 	topicId := params["topicId"]
 	author := session.Get("username")
 	// check for content
-	if content == "" {
+	hasFiles := r.MultipartForm != nil && len(r.MultipartForm.File["file"]) > 0
+	if content == "" && !hasFiles && len(r.Form["attachment"]) == 0 {
 		e := ApiError{
-			Error: "content must be specified",
+			Message: "content must be specified",
+			Details: map[string]string{"content": "required"},
 		}
-		rndr.JSON(500, e)
+		rndr.JSON(422, e)
+		return
+	}
+	if _, ok := api.checkTopicAccess(topicId, author.(string), true, rndr); !ok {
+		return
+	}
+	status, publishAt, err := draftFromRequest(r.Form)
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	atts, ok := api.attachmentsFromRequest(r, author.(string), rndr)
+	if !ok {
 		return
 	}
 	// new post
 	post := &dialogue.Post{
-		Content: content,
-		TopicId: topicId,
-		Author:  author.(string),
+		Content:   content,
+		TopicId:   topicId,
+		Author:    author.(string),
+		Status:    status,
+		PublishAt: publishAt,
+	}
+	for _, a := range atts {
+		post.Attachments = append(post.Attachments, a.Id)
 	}
-	if err := api.rdb.SavePost(post); err != nil {
+	// drafts and scheduled posts are announced when they are published
+	if status != "" {
+		err = api.rdb.SavePost(post)
+	} else {
+		err = api.savePost(post)
+	}
+	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("Error saving post: %s", err),
+			Message: fmt.Sprintf("Error saving post: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
-	w.WriteHeader(204)
+	for _, a := range atts {
+		a.PostId = post.Id
+		if err := api.rdb.UpdateAttachment(a); err != nil {
+			e := ApiError{
+				Message: fmt.Sprintf("Error saving attachment: %s", err),
+			}
+			rndr.JSON(500, e)
+			return
+		}
+	}
+	location := apiVersion + "/posts/" + post.Id
+	if status != "" {
+		location = apiVersion + "/drafts/" + post.Id
+	}
+	post.SummarizeReactions()
+	w.Header().Set("Location", location)
+	rndr.JSON(201, post)
 }
 
-func (api *dialogueApi) DeleteTopic(w http.ResponseWriter, params martini.Params, rndr render.Render) {
+// DeleteTopic moves a topic to the trash
+func (api *dialogueApi) DeleteTopic(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
 	id := params["topicId"]
-	if err := api.rdb.DeleteTopic(id); err != nil {
+	topic, ok := api.checkTopicAccess(id, username, true, rndr)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(r, topic.Version, rndr) {
+		return
+	}
+	if err := api.rdb.DeleteTopic(id, username, topic.Version); err != nil {
+		if err == db.ErrVersionConflict {
+			versionConflict(rndr)
+			return
+		}
 		e := ApiError{
-			Error: fmt.Sprintf("Error deleting topic: %s", err),
+			Message: fmt.Sprintf("Error deleting topic: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
+	api.audit(r, dialogue.AUDIT_TOPIC_DELETED, username, id, map[string]string{"title": topic.Title})
 	w.WriteHeader(204)
 }
 
-func (api *dialogueApi) DeletePost(w http.ResponseWriter, params martini.Params, rndr render.Render) {
+// DeletePost moves a post to the trash
+func (api *dialogueApi) DeletePost(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
 	id := params["postId"]
-	if err := api.rdb.DeletePost(id); err != nil {
+	post, err := api.rdb.GetPost(id)
+	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("Error deleting post: %s", err),
+			Message: fmt.Sprintf("Error getting post: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if _, ok := api.checkTopicAccess(post.TopicId, username, true, rndr); !ok {
+		return
+	}
+	if !checkIfMatch(r, post.Version, rndr) {
+		return
+	}
+	if err := api.rdb.DeletePost(id, username, post.Version); err != nil {
+		if err == db.ErrVersionConflict {
+			versionConflict(rndr)
+			return
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error deleting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	api.audit(r, dialogue.AUDIT_POST_DELETED, username, id, map[string]string{"topicId": post.TopicId, "author": post.Author})
 	w.WriteHeader(204)
 }
 
 func (api *dialogueApi) Authenticate(r *http.Request, rndr render.Render, params martini.Params) {
+	if !validateRequest(r, authSchema, rndr) {
+		return
+	}
 	username := r.FormValue("username")
 	pass := r.FormValue("password")
 	user, err := api.rdb.GetUser(username)
 	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("Error authenticating: %s", err),
+			Message: fmt.Sprintf("Error authenticating: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
-	if api.auth.Authenticate(user.Password, pass) {
+	if user != nil && api.auth.Authenticate(user.Password, pass) {
 		t := api.auth.GenerateToken()
 		token := AuthToken{
 			Token: t,
@@ -274,37 +913,35 @@ func (api *dialogueApi) Authenticate(r *http.Request, rndr render.Render, params
 		}
 		if err := api.rdb.SaveAuthorization(a); err != nil {
 			e := ApiError{
-				Error: fmt.Sprintf("Error saving auth token: %s", err),
+				Message: fmt.Sprintf("Error saving auth token: %s", err),
 			}
 			rndr.JSON(500, e)
 			return
 		}
+		api.audit(r, dialogue.AUDIT_LOGIN, username, username, nil)
 		rndr.JSON(200, token)
 		return
 	}
+	api.audit(r, dialogue.AUDIT_LOGIN_FAILED, "", username, nil)
 	e := ApiError{
-		Error: "Invalid username/password",
+		Message: "Invalid username/password",
 	}
 	rndr.JSON(401, e)
 	return
 }
 
-func (api *dialogueApi) PostUsers(w http.ResponseWriter, r *http.Request, rndr render.Render) {
-	username := r.FormValue("username")
-	password := r.FormValue("password")
-	// check for username and password
-	if username == "" || password == "" {
-		e := ApiError{
-			Error: "username and password must be specified",
-		}
-		rndr.JSON(500, e)
+func (api *dialogueApi) PostUsers(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	if !validateRequest(r, newUserSchema, rndr) {
 		return
 	}
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+	email := strings.ToLower(r.FormValue("email"))
 	// hash password
 	pw, err := api.auth.HashPassword(password)
 	if err != nil {
 		e := ApiError{
-			Error: "error hashing password",
+			Message: "error hashing password",
 		}
 		rndr.JSON(500, e)
 		return
@@ -314,27 +951,33 @@ func (api *dialogueApi) PostUsers(w http.ResponseWriter, r *http.Request, rndr r
 	user := &dialogue.User{
 		Username: username,
 		Password: pw,
+		Email:    email,
 	}
 	if err := api.rdb.SaveUser(user); err != nil {
+		status := 500
+		if err == db.ErrUserExists {
+			status = 409
+		}
 		e := ApiError{
-			Error: fmt.Sprintf("Error creating user: %s", err),
+			Message: fmt.Sprintf("Error creating user: %s", err),
 		}
-		rndr.JSON(500, e)
+		rndr.JSON(status, e)
 		return
 	}
+	api.audit(r, dialogue.AUDIT_USER_CREATED, session.Get("username").(string), username, nil)
 	w.WriteHeader(204)
 }
 
 func (api *dialogueApi) PutUser(r *http.Request, w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
-	username := session.Get("username")
+	username := session.Get("username").(string)
 	updateUsername := params["username"]
 	// check for admin user
 	// if not admin, verify request is updating own account or deny
 	if username != "admin" && username != updateUsername {
 		e := ApiError{
-			Error: "you are not allowed to update this resource",
+			Message: "you are not allowed to update this resource",
 		}
-		log.Warn(fmt.Sprintf("User %s attempted to update user %s", username, updateUsername))
+		api.audit(r, dialogue.AUDIT_USER_DENIED, username, updateUsername, nil)
 		rndr.JSON(403, e)
 		return
 	}
@@ -342,30 +985,87 @@ func (api *dialogueApi) PutUser(r *http.Request, w http.ResponseWriter, params m
 	user, err := api.rdb.GetUser(updateUsername)
 	if err != nil {
 		e := ApiError{
-			Error: fmt.Sprintf("Error updating user: %s", err),
+			Message: fmt.Sprintf("Error updating user: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
-	password := r.FormValue("password")
-	// hash password
-	pw, err := api.auth.HashPassword(password)
-	if err != nil {
+	if user == nil {
 		e := ApiError{
-			Error: "error hashing password",
+			Message: "user not found",
 		}
-		rndr.JSON(500, e)
+		rndr.JSON(404, e)
+		return
+	}
+	if !checkIfMatch(r, user.Version, rndr) {
 		return
+	}
+	if !validateRequest(r, userSchema, rndr) {
+		return
+	}
+	changed := []string{}
+	if password := r.FormValue("password"); password != "" {
+		// hash password
+		pw, err := api.auth.HashPassword(password)
+		if err != nil {
+			e := ApiError{
+				Message: "error hashing password",
+			}
+			rndr.JSON(500, e)
+			return
 
+		}
+		user.Password = pw
+		changed = append(changed, "password")
+	}
+	if email := r.FormValue("email"); email != "" {
+		user.Email = strings.ToLower(email)
+		changed = append(changed, "email")
 	}
-	user.Password = pw
 	if err := api.rdb.UpdateUser(user); err != nil {
+		if err == db.ErrVersionConflict {
+			versionConflict(rndr)
+			return
+		}
 		e := ApiError{
-			Error: fmt.Sprintf("Error updating user: %s", err),
+			Message: fmt.Sprintf("Error updating user: %s", err),
 		}
 		rndr.JSON(500, e)
 		return
 	}
-	log.Info(fmt.Sprintf("User %s updated user %s", username, updateUsername))
+	api.audit(r, dialogue.AUDIT_USER_UPDATED, username, updateUsername, map[string]string{"fields": strings.Join(changed, ",")})
+	w.Header().Set("ETag", etag(user.Version))
 	w.WriteHeader(204)
 }
+
+// GetUser returns a user.  Users can only get their own account unless
+// they are the admin.
+func (api *dialogueApi) GetUser(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if username != "admin" && username != params["username"] {
+		e := ApiError{
+			Message: "you are not allowed to access this resource",
+		}
+		rndr.JSON(403, e)
+		return
+	}
+	user, err := api.rdb.GetUser(params["username"])
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting user: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if user == nil {
+		e := ApiError{
+			Message: "user not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if notModified(w, r, etag(user.Version)) {
+		return
+	}
+	rndr.JSON(200, user)
+}
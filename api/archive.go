@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+// PostTopicArchive archives a topic.  Archived topics are read-only and
+// are hidden from GET /topics unless archived=true or archived=all.
+func (api *dialogueApi) PostTopicArchive(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	api.setTopicArchived(w, params["topicId"], session.Get("username").(string), true, rndr)
+}
+
+// DeleteTopicArchive restores an archived topic to active
+func (api *dialogueApi) DeleteTopicArchive(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	api.setTopicArchived(w, params["topicId"], session.Get("username").(string), false, rndr)
+}
+
+func (api *dialogueApi) setTopicArchived(w http.ResponseWriter, topicId string, username string, archived bool, rndr render.Render) {
+	topic, ok := api.checkTopicAccess(topicId, username, false, rndr)
+	if !ok {
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if !tree.canPost(topic.CategoryId, username) {
+		e := ApiError{
+			Message: "you are not allowed to archive this topic",
+		}
+		rndr.JSON(403, e)
+		return
+	}
+	err = api.updateTopic(topic, func(t *dialogue.Topic) bool {
+		if t.Archived == archived {
+			return false
+		}
+		t.Archived = archived
+		t.ArchivedAt = nil
+		if archived {
+			now := time.Now()
+			t.ArchivedAt = &now
+		}
+		return true
+	})
+	if err != nil {
+		status := 500
+		if err == db.ErrTopicNotFound {
+			status = 404
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating topic: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// PostArchive archives topics in bulk.  olderThan archives topics created
+// longer ago than the duration (i.e. 8760h) and inactiveFor archives
+// topics without posts for the duration.  If both are specified, topics
+// must match both.
+func (api *dialogueApi) PostArchive(r *http.Request, rndr render.Render) {
+	createdBefore, err := parseAge(r.FormValue("olderThan"))
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("invalid olderThan: %s", err),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	inactiveSince, err := parseAge(r.FormValue("inactiveFor"))
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("invalid inactiveFor: %s", err),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if createdBefore.IsZero() && inactiveSince.IsZero() {
+		e := ApiError{
+			Message: "olderThan or inactiveFor must be specified",
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	n, err := api.rdb.ArchiveTopics(createdBefore, inactiveSince)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error archiving topics: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, map[string]int{"archived": n})
+}
+
+// parseAge returns the time the duration v before now, or the zero time if
+// v is empty
+func parseAge(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().Add(-d), nil
+}
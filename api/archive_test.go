@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		v    string
+		age  time.Duration
+		zero bool
+		ok   bool
+	}{
+		{"", 0, true, true},
+		{"24h", 24 * time.Hour, false, true},
+		{"8760h", 8760 * time.Hour, false, true},
+		{"1y", 0, false, false},
+	}
+	for _, test := range tests {
+		before := time.Now()
+		at, err := parseAge(test.v)
+		if (err == nil) != test.ok {
+			t.Errorf("parseAge(%q): err = %v, want ok %v", test.v, err, test.ok)
+			continue
+		}
+		if !test.ok {
+			continue
+		}
+		if at.IsZero() != test.zero {
+			t.Errorf("parseAge(%q) = %s", test.v, at)
+			continue
+		}
+		if d := at.Sub(before.Add(-test.age)); !test.zero && (d < 0 || d > time.Second) {
+			t.Errorf("parseAge(%q) = %s, want about %s", test.v, at, before.Add(-test.age))
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/blob"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// attachmentStore saves uploaded files to a blob store, enforcing size
+	// and content type limits
+	attachmentStore struct {
+		blobs     blob.Store
+		maxSize   int64
+		types     []string
+		retention time.Duration
+	}
+	// attachmentError is returned for uploads that are rejected
+	attachmentError struct {
+		status int
+		msg    string
+	}
+)
+
+func (e *attachmentError) Error() string {
+	return e.msg
+}
+
+// uploadOverhead is allowed in upload requests on top of the attachment
+// size for multipart headers and the other form fields
+const uploadOverhead = 1 << 20
+
+// newAttachmentStore returns an attachmentStore that accepts files up to
+// maxSize bytes with a content type matching one of types.  Types ending
+// in "/" match any subtype (i.e. "image/") and "*" matches everything.
+// Uploads that are not attached to a post within retention are deleted.
+func newAttachmentStore(blobs blob.Store, maxSize int64, types []string, retention time.Duration) *attachmentStore {
+	return &attachmentStore{
+		blobs:     blobs,
+		maxSize:   maxSize,
+		types:     types,
+		retention: retention,
+	}
+}
+
+// limitBody caps the size of an upload request so that oversized bodies
+// are rejected while they are read instead of being spooled to disk
+func (s *attachmentStore) limitBody(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxSize+uploadOverhead)
+}
+
+// purge deletes attachments whose post has been purged and uploads older
+// than the retention period that were never posted, along with their
+// blobs.  It returns the number of attachments deleted.
+func (s *attachmentStore) purge(rdb db.Db, now time.Time) (int, error) {
+	atts, err := rdb.GetOrphanedAttachments(now.Add(-s.retention))
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, a := range atts {
+		if err := s.blobs.Delete(a.Key); err != nil && err != blob.ErrNotFound {
+			return count, err
+		}
+		if err := rdb.DeleteAttachment(a.Id); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *attachmentStore) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range s.types {
+		switch {
+		case t == "*", t == mediaType:
+			return true
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t):
+			return true
+		}
+	}
+	return false
+}
+
+// save stores an uploaded file and returns its (unsaved) metadata
+func (s *attachmentStore) save(fh *multipart.FileHeader, uploader string) (*dialogue.Attachment, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(f, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, &attachmentError{413, fmt.Sprintf("%s is larger than %d bytes", fh.Filename, s.maxSize)}
+	}
+	contentType := http.DetectContentType(data)
+	if !s.allowed(contentType) {
+		return nil, &attachmentError{415, fmt.Sprintf("%s has an unsupported content type: %s", fh.Filename, contentType)}
+	}
+	sum := sha256.Sum256(data)
+	a := &dialogue.Attachment{
+		Name:        filepath.Base(fh.Filename),
+		Size:        int64(len(data)),
+		ContentType: contentType,
+		Checksum:    hex.EncodeToString(sum[:]),
+		Uploader:    uploader,
+		Key:         uuid.New(),
+	}
+	if err := s.blobs.Put(a.Key, bytes.NewReader(data), a.Size); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// uploadFiles stores the files uploaded in the form field and saves their
+// metadata
+func (api *dialogueApi) uploadFiles(r *http.Request, field string, username string, rndr render.Render) ([]*dialogue.Attachment, bool) {
+	atts := []*dialogue.Attachment{}
+	if r.MultipartForm == nil {
+		return atts, true
+	}
+	for _, fh := range r.MultipartForm.File[field] {
+		a, err := api.attachments.save(fh, username)
+		if err != nil {
+			status := 500
+			if e, ok := err.(*attachmentError); ok {
+				status = e.status
+			}
+			e := ApiError{
+				Message: fmt.Sprintf("Error saving attachment: %s", err),
+			}
+			rndr.JSON(status, e)
+			return nil, false
+		}
+		if err := api.rdb.SaveAttachment(a); err != nil {
+			e := ApiError{
+				Message: fmt.Sprintf("Error saving attachment: %s", err),
+			}
+			rndr.JSON(500, e)
+			return nil, false
+		}
+		atts = append(atts, a)
+	}
+	return atts, true
+}
+
+// attachmentsFromRequest returns the attachments for a new post: files
+// uploaded with the request and previously uploaded attachments referenced
+// by id.  Referenced attachments must have been uploaded by username and
+// not yet be attached to a post.
+func (api *dialogueApi) attachmentsFromRequest(r *http.Request, username string, rndr render.Render) ([]*dialogue.Attachment, bool) {
+	var atts []*dialogue.Attachment
+	for _, id := range r.Form["attachment"] {
+		a, err := api.rdb.GetAttachment(id)
+		if err != nil {
+			e := ApiError{
+				Message: fmt.Sprintf("Error getting attachment: %s", err),
+			}
+			rndr.JSON(500, e)
+			return nil, false
+		}
+		if a == nil || a.Uploader != username || a.PostId != "" {
+			e := ApiError{
+				Message: fmt.Sprintf("unknown attachment: %s", id),
+			}
+			rndr.JSON(400, e)
+			return nil, false
+		}
+		atts = append(atts, a)
+	}
+	uploaded, ok := api.uploadFiles(r, "file", username, rndr)
+	if !ok {
+		return nil, false
+	}
+	return append(atts, uploaded...), true
+}
+
+// parseUpload parses a multipart/form-data request.  Other requests are
+// left to the usual form parsing.  A 400 or 413 is rendered if the request
+// can't be parsed.
+func (api *dialogueApi) parseUpload(w http.ResponseWriter, r *http.Request, rndr render.Render) bool {
+	api.attachments.limitBody(w, r)
+	err := r.ParseMultipartForm(32 << 20)
+	if err == http.ErrNotMultipart {
+		err = r.ParseForm()
+	}
+	if err != nil {
+		status := 400
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = 413
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error parsing upload: %s", err),
+		}
+		rndr.JSON(status, e)
+		return false
+	}
+	return true
+}
+
+// checkAttachmentAccess returns the attachment if username is allowed to
+// download it.  Attachments on posts are visible to readers of the topic;
+// attachments that have not been posted, or are on drafts, are only
+// visible to the uploader.
+func (api *dialogueApi) checkAttachmentAccess(id string, username string, rndr render.Render) (*dialogue.Attachment, bool) {
+	a, err := api.rdb.GetAttachment(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting attachment: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	notFound := ApiError{
+		Message: "attachment not found",
+	}
+	if a == nil {
+		rndr.JSON(404, notFound)
+		return nil, false
+	}
+	if a.PostId == "" {
+		if a.Uploader != username && !isAdmin(username) {
+			rndr.JSON(404, notFound)
+			return nil, false
+		}
+		return a, true
+	}
+	post, err := api.rdb.GetPost(a.PostId)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	if post == nil {
+		draft, err := api.rdb.GetDraft(a.PostId)
+		if err != nil {
+			e := ApiError{
+				Message: fmt.Sprintf("Error getting post: %s", err),
+			}
+			rndr.JSON(500, e)
+			return nil, false
+		}
+		if draft == nil || draft.Author != username {
+			rndr.JSON(404, notFound)
+			return nil, false
+		}
+		return a, true
+	}
+	if _, ok := api.checkTopicAccess(post.TopicId, username, false, rndr); !ok {
+		return nil, false
+	}
+	return a, true
+}
+
+// PostAttachments uploads files (multipart/form-data "file" fields) to be
+// attached to a post later with the "attachment" form value
+func (api *dialogueApi) PostAttachments(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if !api.parseUpload(w, r, rndr) {
+		return
+	}
+	atts, ok := api.uploadFiles(r, "file", username, rndr)
+	if !ok {
+		return
+	}
+	if len(atts) == 0 {
+		e := ApiError{
+			Message: "file must be specified",
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	rndr.JSON(200, atts)
+}
+
+func (api *dialogueApi) GetAttachment(params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	a, ok := api.checkAttachmentAccess(params["id"], username, rndr)
+	if !ok {
+		return
+	}
+	rndr.JSON(200, a)
+}
+
+// GetAttachmentContent downloads an attachment
+func (api *dialogueApi) GetAttachmentContent(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	a, ok := api.checkAttachmentAccess(params["id"], username, rndr)
+	if !ok {
+		return
+	}
+	rc, err := api.attachments.blobs.Get(a.Key)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting attachment: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(a.Size, 10))
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Name})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Checksum-Sha256", a.Checksum)
+	w.WriteHeader(200)
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Errorf("Error sending attachment %s: %s", a.Id, err)
+	}
+}
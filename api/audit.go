@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ehazlett/dialogue"
+	"github.com/martini-contrib/render"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// audit records a security relevant action in the audit log.  Errors are
+// logged; they don't fail the request.
+func (api *dialogueApi) audit(r *http.Request, action string, actor string, target string, details map[string]string) {
+	entry := &dialogue.AuditEntry{
+		Created:    time.Now(),
+		Action:     action,
+		Actor:      actor,
+		Target:     target,
+		RemoteAddr: api.clientIP(r),
+		RequestId:  r.Header.Get("X-Request-Id"),
+		Details:    details,
+	}
+	log.WithFields(logrus.Fields{
+		"action":    action,
+		"actor":     actor,
+		"target":    target,
+		"remote":    entry.RemoteAddr,
+		"requestId": entry.RequestId,
+	}).Info("audit")
+	if err := api.rdb.SaveAuditEntry(entry); err != nil {
+		log.Errorf("Unable to save audit entry for %s: %s", action, err)
+	}
+}
+
+// clientIP returns the address of the client, taken from X-Forwarded-For
+// when the api is behind a trusted proxy
+func (api *dialogueApi) clientIP(r *http.Request) string {
+	if api.limiter != nil {
+		return api.limiter.clientIP(r)
+	}
+	return remoteHost(r)
+}
+
+// remoteHost returns the address of the peer of the request
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// GetAudit returns the newest audit entries.  They can be filtered by
+// action, actor, target and by time with since and until.
+func (api *dialogueApi) GetAudit(r *http.Request, rndr render.Render) {
+	if !validateRequest(r, auditQuerySchema, rndr) {
+		return
+	}
+	query := r.URL.Query()
+	limit := defaultAuditLimit
+	if v := query.Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+	if limit < 1 || limit > maxAuditLimit {
+		e := ApiError{
+			Message: "invalid request",
+			Details: map[string]string{"limit": fmt.Sprintf("must be between 1 and %d", maxAuditLimit)},
+		}
+		rndr.JSON(422, e)
+		return
+	}
+	entries, err := api.rdb.FindAuditEntries(query.Get("action"), query.Get("actor"), query.Get("target"), queryTime(query, "since"), queryTime(query, "until"), limit)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting audit log: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, entries)
+}
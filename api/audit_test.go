@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestRemoteHost(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		host       string
+	}{
+		{"192.0.2.1:51234", "192.0.2.1"},
+		{"[2001:db8::1]:443", "2001:db8::1"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		r := &http.Request{RemoteAddr: test.remoteAddr}
+		if host := remoteHost(r); host != test.host {
+			t.Errorf("remoteHost(%q) = %q, want %q", test.remoteAddr, host, test.host)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		limiter *rateLimiter
+		remote  string
+	}{
+		{nil, "192.0.2.1"},
+		{newRateLimiter(newMemoryRateStore(), 0, 0, 0, 0, false), "192.0.2.1"},
+		{newRateLimiter(newMemoryRateStore(), 0, 0, 0, 0, true), "203.0.113.7"},
+	}
+	for i, test := range tests {
+		rdb := newFakeDb()
+		api := &dialogueApi{rdb: rdb, limiter: test.limiter}
+		r := &http.Request{RemoteAddr: "192.0.2.1:51234", Header: http.Header{}}
+		r.Header.Set("X-Forwarded-For", "203.0.113.7")
+		r.Header.Set("X-Request-Id", "req-1")
+		api.audit(r, "user.update", "admin", "alice", map[string]string{"admin": "true"})
+		if len(rdb.audit) != 1 {
+			t.Fatalf("%d: %d audit entries saved, want 1", i, len(rdb.audit))
+		}
+		e := rdb.audit[0]
+		if e.Action != "user.update" || e.Actor != "admin" || e.Target != "alice" || e.Details["admin"] != "true" {
+			t.Errorf("%d: entry %+v", i, e)
+		}
+		if e.RemoteAddr != test.remote || e.RequestId != "req-1" || e.Created.IsZero() {
+			t.Errorf("%d: remote %q, request %q, created %s, want remote %q", i, e.RemoteAddr, e.RequestId, e.Created, test.remote)
+		}
+	}
+}
+
+func TestGetAudit(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.audit = []*dialogue.AuditEntry{
+		{Action: "auth.failed", Target: "alice"},
+		{Action: "user.update", Actor: "admin", Target: "alice"},
+		{Action: "auth.failed", Target: "bob"},
+	}
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		query   string
+		status  int
+		entries int
+	}{
+		{"", 200, 3},
+		{"action=auth.failed", 200, 2},
+		{"target=alice&actor=admin", 200, 1},
+		{"limit=1", 200, 1},
+		{"limit=0", 422, 0},
+		{"limit=1001", 422, 0},
+		{"since=last+week", 422, 0},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/audit?"+test.query, nil)
+		rndr := &fakeRender{}
+		api.GetAudit(r, rndr)
+		if rndr.status != test.status {
+			t.Errorf("%q: status %d, want %d", test.query, rndr.status, test.status)
+			continue
+		}
+		if entries, ok := rndr.v.([]*dialogue.AuditEntry); test.status == 200 && (!ok || len(entries) != test.entries) {
+			t.Errorf("%q: returned %v, want %d entries", test.query, rndr.v, test.entries)
+		}
+	}
+}
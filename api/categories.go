@@ -0,0 +1,393 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// categoryTree indexes categories by id for permission checks
+	categoryTree map[string]*dialogue.Category
+)
+
+func (api *dialogueApi) getCategoryTree() (categoryTree, error) {
+	return loadCategoryTree(api.rdb)
+}
+
+func loadCategoryTree(rdb db.Db) (categoryTree, error) {
+	cats, err := rdb.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+	tree := categoryTree{}
+	for _, c := range cats {
+		tree[c.Id] = c
+	}
+	return tree, nil
+}
+
+// permissions returns the permissions for a category, inherited from the
+// nearest ancestor that sets them
+func (t categoryTree) permissions(id string) *dialogue.Permissions {
+	seen := map[string]bool{}
+	for id != "" && !seen[id] {
+		seen[id] = true
+		c, ok := t[id]
+		if !ok {
+			break
+		}
+		if c.Permissions != nil {
+			return c.Permissions
+		}
+		id = c.ParentId
+	}
+	return nil
+}
+
+func (t categoryTree) canRead(id string, username string) bool {
+	return isAdmin(username) || t.permissions(id).CanRead(username)
+}
+
+func (t categoryTree) canPost(id string, username string) bool {
+	return isAdmin(username) || t.permissions(id).CanPost(username)
+}
+
+func (t categoryTree) canModerate(id string, username string) bool {
+	return isAdmin(username) || t.permissions(id).CanModerate(username)
+}
+
+// publishInCategory sends an event to the stream subscribers that can
+// read the category
+func (api *dialogueApi) publishInCategory(categoryId string, eventType string, data interface{}) {
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		log.Errorf("Error getting categories for %s event: %s", eventType, err)
+		return
+	}
+	api.events.PublishIf(func(username string) bool {
+		return tree.canRead(categoryId, username)
+	}, eventType, data)
+}
+
+// publishInTopic sends an event to the stream subscribers that can read
+// the topic
+func (api *dialogueApi) publishInTopic(topicId string, eventType string, data interface{}) {
+	topic, err := api.rdb.GetTopic(topicId)
+	if err != nil {
+		log.Errorf("Error getting topic for %s event: %s", eventType, err)
+		return
+	}
+	if topic == nil {
+		return
+	}
+	api.publishInCategory(topic.CategoryId, eventType, data)
+}
+
+// descendants returns the ids of all subcategories of id
+func (t categoryTree) descendants(id string) []string {
+	var ids []string
+	for _, c := range t {
+		if c.ParentId == id {
+			ids = append(ids, c.Id)
+			ids = append(ids, t.descendants(c.Id)...)
+		}
+	}
+	return ids
+}
+
+// checkCategoryPost renders an error and returns false unless the
+// category exists and username may create topics in it
+func (api *dialogueApi) checkCategoryPost(id string, username string, rndr render.Render) bool {
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return false
+	}
+	if _, ok := tree[id]; !ok || !tree.canRead(id, username) {
+		e := ApiError{
+			Message: fmt.Sprintf("unknown category: %s", id),
+		}
+		rndr.JSON(400, e)
+		return false
+	}
+	if !tree.canPost(id, username) {
+		e := ApiError{
+			Message: "you are not allowed to post in this category",
+		}
+		rndr.JSON(403, e)
+		return false
+	}
+	return true
+}
+
+// updateCategoryFromRequest applies the category fields present in the
+// request.  Setting inherit=true removes the category's permissions.
+func updateCategoryFromRequest(cat *dialogue.Category, tree categoryTree, form url.Values) error {
+	if _, ok := form["name"]; ok {
+		cat.Name = form.Get("name")
+	}
+	if cat.Name == "" {
+		return fmt.Errorf("name must be specified")
+	}
+	if _, ok := form["description"]; ok {
+		cat.Description = form.Get("description")
+	}
+	if _, ok := form["parentId"]; ok {
+		parentId := form.Get("parentId")
+		if parentId != "" {
+			if _, ok := tree[parentId]; !ok {
+				return fmt.Errorf("unknown parent category: %s", parentId)
+			}
+			if cat.Id != "" {
+				if parentId == cat.Id {
+					return fmt.Errorf("a category cannot be its own parent")
+				}
+				for _, id := range tree.descendants(cat.Id) {
+					if id == parentId {
+						return fmt.Errorf("a category cannot be moved into its own subcategory")
+					}
+				}
+			}
+		}
+		cat.ParentId = parentId
+	}
+	read, hasRead := form["read"]
+	post, hasPost := form["post"]
+	moderate, hasModerate := form["moderate"]
+	if hasRead || hasPost || hasModerate {
+		if cat.Permissions == nil {
+			cat.Permissions = &dialogue.Permissions{}
+		}
+		if hasRead {
+			cat.Permissions.Read = nonEmpty(read)
+		}
+		if hasPost {
+			cat.Permissions.Post = nonEmpty(post)
+		}
+		if hasModerate {
+			cat.Permissions.Moderate = nonEmpty(moderate)
+		}
+	}
+	if form.Get("inherit") == "true" {
+		cat.Permissions = nil
+	}
+	return nil
+}
+
+// auditPermissions records the permissions of a category if the request
+// changed them
+func (api *dialogueApi) auditPermissions(r *http.Request, session sessions.Session, cat *dialogue.Category) {
+	changed := false
+	for _, k := range []string{"read", "post", "moderate", "inherit"} {
+		if _, ok := r.Form[k]; ok {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	details := map[string]string{"inherit": "true"}
+	if p := cat.Permissions; p != nil {
+		details = map[string]string{
+			"read":     strings.Join(p.Read, ","),
+			"post":     strings.Join(p.Post, ","),
+			"moderate": strings.Join(p.Moderate, ","),
+		}
+	}
+	api.audit(r, dialogue.AUDIT_PERMISSIONS_CHANGED, session.Get("username").(string), cat.Id, details)
+}
+
+func nonEmpty(values []string) []string {
+	res := []string{}
+	for _, v := range values {
+		if v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (api *dialogueApi) GetCategories(session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	cats, err := api.rdb.GetCategories()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	res := []*dialogue.Category{}
+	for _, c := range cats {
+		if tree.canRead(c.Id, username) {
+			res = append(res, c)
+		}
+	}
+	rndr.JSON(200, res)
+}
+
+func (api *dialogueApi) GetCategory(params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	cat, ok := tree[id]
+	if !ok || !tree.canRead(id, username) {
+		e := ApiError{
+			Message: "category not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	rndr.JSON(200, cat)
+}
+
+// GetCategoryTopics returns the topics in a category.  Subcategories are
+// included with recursive=true.
+func (api *dialogueApi) GetCategoryTopics(r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if _, ok := tree[id]; !ok || !tree.canRead(id, username) {
+		e := ApiError{
+			Message: "category not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	query := r.URL.Query()
+	query.Set("category", id)
+	topics, err := api.findTopics(username, query)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topics: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, topics)
+}
+
+func (api *dialogueApi) PostCategories(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	r.ParseForm()
+	cat := &dialogue.Category{}
+	if err := updateCategoryFromRequest(cat, tree, r.Form); err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.SaveCategory(cat); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error saving category: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	api.auditPermissions(r, session, cat)
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) PutCategory(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting categories",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	cat, ok := tree[params["id"]]
+	if !ok {
+		e := ApiError{
+			Message: "category not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	r.ParseForm()
+	if err := updateCategoryFromRequest(cat, tree, r.Form); err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.UpdateCategory(cat); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating category: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	api.auditPermissions(r, session, cat)
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) DeleteCategory(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	id := params["id"]
+	if id == dialogue.DEFAULT_CATEGORY {
+		e := ApiError{
+			Message: "the default category cannot be deleted",
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.DeleteCategory(id); err != nil {
+		status := 500
+		switch err {
+		case db.ErrCategoryNotFound:
+			status = 404
+		case db.ErrCategoryNotEmpty:
+			status = 409
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error deleting category: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	api.audit(r, dialogue.AUDIT_CATEGORY_DELETED, session.Get("username").(string), id, nil)
+	w.WriteHeader(204)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func testCategoryTree() categoryTree {
+	team := &dialogue.Permissions{Read: []string{"bob", "carol"}, Post: []string{"bob"}, Moderate: []string{"carol"}}
+	return categoryTree{
+		"general": {Id: "general"},
+		"team":    {Id: "team", Permissions: team},
+		"sub":     {Id: "sub", ParentId: "team"},
+		"subsub":  {Id: "subsub", ParentId: "sub"},
+		"open":    {Id: "open", ParentId: "team", Permissions: &dialogue.Permissions{}},
+		"loop-a":  {Id: "loop-a", ParentId: "loop-b"},
+		"loop-b":  {Id: "loop-b", ParentId: "loop-a"},
+	}
+}
+
+func TestCategoryPermissions(t *testing.T) {
+	tree := testCategoryTree()
+	tests := []struct {
+		id       string
+		username string
+		read     bool
+		post     bool
+		moderate bool
+	}{
+		{"general", "alice", true, true, false},
+		{"team", "alice", false, false, false},
+		{"team", "bob", true, true, false},
+		{"team", "carol", true, false, true},
+		{"sub", "alice", false, false, false},
+		{"subsub", "bob", true, true, false},
+		{"subsub", "carol", true, false, true},
+		{"open", "alice", true, true, false},
+		{"team", "admin", true, true, true},
+		{"loop-a", "alice", true, true, false},
+		{"missing", "alice", true, true, false},
+	}
+	for _, test := range tests {
+		if got := tree.canRead(test.id, test.username); got != test.read {
+			t.Errorf("%s %s: canRead = %v, want %v", test.id, test.username, got, test.read)
+		}
+		if got := tree.canPost(test.id, test.username); got != test.post {
+			t.Errorf("%s %s: canPost = %v, want %v", test.id, test.username, got, test.post)
+		}
+		if got := tree.canModerate(test.id, test.username); got != test.moderate {
+			t.Errorf("%s %s: canModerate = %v, want %v", test.id, test.username, got, test.moderate)
+		}
+	}
+	if p := tree.permissions("subsub"); p != tree["team"].Permissions {
+		t.Errorf("subsub does not inherit the permissions of team: %+v", p)
+	}
+}
+
+func TestCategoryDescendants(t *testing.T) {
+	tree := testCategoryTree()
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"team", "open sub subsub"},
+		{"sub", "subsub"},
+		{"general", ""},
+		{"missing", ""},
+	}
+	for _, test := range tests {
+		ids := tree.descendants(test.id)
+		sort.Strings(ids)
+		if got := strings.Join(ids, " "); got != test.want {
+			t.Errorf("descendants(%s) = %q, want %q", test.id, got, test.want)
+		}
+	}
+}
+
+func TestUpdateCategoryFromRequest(t *testing.T) {
+	tree := testCategoryTree()
+	tests := []struct {
+		id   string
+		form url.Values
+		ok   bool
+	}{
+		{"sub", url.Values{"parentId": {"general"}}, true},
+		{"sub", url.Values{"parentId": {""}}, true},
+		{"sub", url.Values{"parentId": {"missing"}}, false},
+		{"sub", url.Values{"parentId": {"sub"}}, false},
+		{"team", url.Values{"parentId": {"subsub"}}, false},
+		{"sub", url.Values{"name": {""}}, false},
+	}
+	for _, test := range tests {
+		cat := *tree[test.id]
+		cat.Name = "name"
+		err := updateCategoryFromRequest(&cat, tree, test.form)
+		if (err == nil) != test.ok {
+			t.Errorf("%s %v: err = %v, want ok %v", test.id, test.form, err, test.ok)
+		}
+	}
+
+	cat := &dialogue.Category{Name: "c"}
+	form := url.Values{"read": {"bob", ""}, "moderate": {"carol"}}
+	if err := updateCategoryFromRequest(cat, tree, form); err != nil {
+		t.Fatalf("updateCategoryFromRequest: %s", err)
+	}
+	if p := cat.Permissions; p == nil || len(p.Read) != 1 || p.Read[0] != "bob" || len(p.Post) != 0 || len(p.Moderate) != 1 {
+		t.Errorf("permissions = %+v", p)
+	}
+	if err := updateCategoryFromRequest(cat, tree, url.Values{"inherit": {"true"}}); err != nil || cat.Permissions != nil {
+		t.Errorf("inherit=true kept permissions %+v, %v", cat.Permissions, err)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The api is configured by flags, which can also be set in a config file
+// and by environment variables.  Command line flags take precedence over
+// the environment, which takes precedence over the config file.
+//
+// The config file is a subset of TOML.  Keys are flag names; keys in a
+// [section] are prefixed with the section name, so
+//
+//	[rethink]
+//	address = "db:28015"
+//
+// sets -rethink-address.  Environment variables are named after the flag
+// in upper case with a DIALOGUE_ prefix (i.e. DIALOGUE_RETHINK_ADDRESS).
+
+const (
+	envPrefix      = "DIALOGUE_"
+	defaultSession = "dialogue-key"
+	redacted       = "<redacted>"
+)
+
+var (
+	// configAliases are config keys for flags with short names
+	configAliases = map[string]string{
+		"listen": "l",
+	}
+	// secrets are not shown by -print-config
+	secrets = map[string]bool{
+		"session-key":   true,
+		"mail-key":      true,
+		"smtp-password": true,
+		"inbound-token": true,
+		"s3-secret-key": true,
+	}
+	// configFlags control loading the config and can't be set in it
+	configFlags = map[string]bool{
+		"config":       true,
+		"print-config": true,
+	}
+)
+
+// configKey returns the config key and environment variable for a flag
+func configKey(name string) (string, string) {
+	for alias, n := range configAliases {
+		if n == name {
+			name = alias
+		}
+	}
+	return name, envPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// flagName returns the flag for a config key
+func flagName(key string) string {
+	key = strings.Replace(strings.ToLower(key), "_", "-", -1)
+	if name, ok := configAliases[key]; ok {
+		return name
+	}
+	return key
+}
+
+// loadConfig sets the flags that were not given on the command line from
+// the environment and the config file
+func loadConfig(path string) error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	values := map[string]string{}
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if values, err = parseConfig(path, f); err != nil {
+			return err
+		}
+	}
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if configFlags[f.Name] {
+			return
+		}
+		_, env := configKey(f.Name)
+		if v := os.Getenv(env); v != "" {
+			values[f.Name] = v
+		}
+	})
+	names := []string{}
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if explicit[name] {
+			continue
+		}
+		if e := flag.Set(name, values[name]); e != nil && err == nil {
+			err = fmt.Errorf("invalid value %q for %s: %s", values[name], name, e)
+		}
+	}
+	return err
+}
+
+// parseConfig reads the flag values in a config file
+func parseConfig(path string, r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	section := ""
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if section != "" {
+			key = section + "-" + key
+		}
+		name := flagName(key)
+		if flag.Lookup(name) == nil || configFlags[name] {
+			return nil, fmt.Errorf("%s:%d: unknown setting %q", path, n, key)
+		}
+		v, err := parseConfigValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s: %s", path, n, key, err)
+		}
+		values[name] = v
+	}
+	return values, s.Err()
+}
+
+// parseConfigValue parses a string, a number or boolean, or an array of
+// strings, which is joined with commas.  Comments after the value are
+// ignored.
+func parseConfigValue(v string) (string, error) {
+	switch {
+	case strings.HasPrefix(v, "["):
+		end := strings.LastIndex(v, "]")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated array")
+		}
+		items := []string{}
+		for _, item := range strings.Split(v[1:end], ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			s, err := parseConfigValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case strings.HasPrefix(v, "'"):
+		end := strings.Index(v[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		return v[1 : end+1], nil
+	case strings.HasPrefix(v, "\""):
+		for end := 1; end < len(v); end++ {
+			if v[end] == '\\' {
+				end++
+				continue
+			}
+			if v[end] == '"' {
+				return strconv.Unquote(v[:end+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string")
+	}
+	if i := strings.Index(v, "#"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	if v == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return v, nil
+}
+
+// printConfig writes the effective config in the config file format.
+// Secrets are redacted.
+func printConfig(w io.Writer) {
+	flag.VisitAll(func(f *flag.Flag) {
+		if configFlags[f.Name] {
+			return
+		}
+		key, _ := configKey(f.Name)
+		v := f.Value.String()
+		if secrets[f.Name] && v != "" {
+			v = redacted
+		}
+		switch f.Value.(flag.Getter).Get().(type) {
+		case bool, int, int64:
+			if v != redacted {
+				fmt.Fprintf(w, "%s = %s\n", key, v)
+				return
+			}
+		}
+		fmt.Fprintf(w, "%s = %s\n", key, strconv.Quote(v))
+	})
+}
+
+// validateConfig checks the settings that can't be checked by the flag
+// types and returns a message for each problem
+func validateConfig() []string {
+	errs := []string{}
+	if !devMode {
+		if sessionKey == defaultSession {
+			errs = append(errs, "session-key must be changed from the default (or use -dev)")
+		} else if len(sessionKey) < 16 {
+			errs = append(errs, "session-key must be at least 16 characters (or use -dev)")
+		}
+	}
+	if mailKey != "" && len(mailKey) < 16 {
+		errs = append(errs, "mail-key must be at least 16 characters")
+	}
+	if u, err := url.Parse(baseUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Sprintf("base-url must be an absolute url: %q", baseUrl))
+	}
+	if logFormat != "text" && logFormat != "json" {
+		errs = append(errs, "log-format must be text or json")
+	}
+	if authCost != 0 && (authCost < 4 || authCost > 31) {
+		errs = append(errs, "auth-cost must be between 4 and 31 (0 uses the default)")
+	}
+	if (tlsCert == "") != (tlsKey == "") {
+		errs = append(errs, "tls-cert and tls-key must be set together")
+	}
+	if tlsClientCA != "" && tlsCert == "" {
+		errs = append(errs, "tls-client-ca requires tls-cert and tls-key")
+	}
+	if smtpAddress != "" && mailDir != "" {
+		errs = append(errs, "only one of smtp-address and mail-dir can be set")
+	}
+	if !strings.Contains(mailFrom, "@") {
+		errs = append(errs, fmt.Sprintf("mail-from must be an email address: %q", mailFrom))
+	}
+	if s3Endpoint != "" && (s3Bucket == "" || s3AccessKey == "" || s3SecretKey == "") {
+		errs = append(errs, "s3-endpoint requires s3-bucket, s3-access-key and s3-secret-key")
+	}
+	if rateLimitRead < 0 || rateLimitWrite < 0 || rateLimitAuth < 0 || rateLimitAddress < 0 {
+		errs = append(errs, "rate limits can't be negative")
+	}
+	if inboundMaxSize <= 0 || attachmentSize <= 0 {
+		errs = append(errs, "inbound-max-size and attachment-max-size must be positive")
+	}
+	if digestInterval <= 0 {
+		errs = append(errs, "digest-interval must be positive")
+	}
+	if uploadRetention <= 0 {
+		errs = append(errs, "upload-retention must be positive")
+	}
+	if readTimeout < 0 || writeTimeout < 0 || idleTimeout < 0 || shutdownTimeout < 0 {
+		errs = append(errs, "timeouts can't be negative")
+	}
+	return errs
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConfigValue(t *testing.T) {
+	tests := []struct {
+		v    string
+		want string
+		ok   bool
+	}{
+		{`"db:28015"`, "db:28015", true},
+		{`"a \"quoted\" value" # comment`, `a "quoted" value`, true},
+		{`"a # in a string"`, "a # in a string", true},
+		{`'C:\path'`, `C:\path`, true},
+		{`true`, "true", true},
+		{`42 # comment`, "42", true},
+		{`["a", 'b', c]`, "a,b,c", true},
+		{`[]`, "", true},
+		{`[ "a", ]`, "a", true},
+		{`"unterminated`, "", false},
+		{`'unterminated`, "", false},
+		{`"escaped end\"`, "", false},
+		{`["a"`, "", false},
+		{`["a, "b"]`, "", false},
+		{``, "", false},
+		{`# only a comment`, "", false},
+	}
+	for _, test := range tests {
+		got, err := parseConfigValue(test.v)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseConfigValue(%q) = %q, %v, want %q (ok %v)", test.v, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	config := `
+# dialogue
+listen = ":4000"
+debug = true
+
+[rethink]
+address = "db:28015" # shared
+name = 'forum'
+
+[smtp]
+address = "smtp.example.com:587"
+`
+	values, err := parseConfig("test.toml", strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("parseConfig: %s", err)
+	}
+	want := map[string]string{
+		"l":               ":4000",
+		"debug":           "true",
+		"rethink-address": "db:28015",
+		"rethink-name":    "forum",
+		"smtp-address":    "smtp.example.com:587",
+	}
+	if len(values) != len(want) {
+		t.Errorf("parseConfig = %v, want %v", values, want)
+	}
+	for k, v := range want {
+		if values[k] != v {
+			t.Errorf("%s = %q, want %q", k, values[k], v)
+		}
+	}
+
+	errors := []struct {
+		config string
+		want   string
+	}{
+		{"unknown = 1", `test.toml:1: unknown setting "unknown"`},
+		{"debug = true\nconfig = \"other.toml\"", `test.toml:2: unknown setting "config"`},
+		{"[rethink]\ndebug = true", `test.toml:2: unknown setting "rethink-debug"`},
+		{"debug", "test.toml:1: expected key = value"},
+		{"session-key = \"abc", "test.toml:1: session-key: unterminated string"},
+	}
+	for _, test := range errors {
+		_, err := parseConfig("test.toml", strings.NewReader(test.config))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("parseConfig(%q) returned %v, want %q", test.config, err, test.want)
+		}
+	}
+}
+
+func TestConfigKey(t *testing.T) {
+	tests := []struct {
+		flag string
+		key  string
+		env  string
+	}{
+		{"l", "listen", "DIALOGUE_LISTEN"},
+		{"rethink-address", "rethink-address", "DIALOGUE_RETHINK_ADDRESS"},
+		{"debug", "debug", "DIALOGUE_DEBUG"},
+	}
+	for _, test := range tests {
+		key, env := configKey(test.flag)
+		if key != test.key || env != test.env {
+			t.Errorf("configKey(%q) = %q, %q, want %q, %q", test.flag, key, env, test.key, test.env)
+		}
+		if name := flagName(key); name != test.flag {
+			t.Errorf("flagName(%q) = %q, want %q", key, name, test.flag)
+		}
+	}
+	if name := flagName("RETHINK_ADDRESS"); name != "rethink-address" {
+		t.Errorf("flagName(RETHINK_ADDRESS) = %q", name)
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	saved := []interface{}{sessionKey, mailKey, baseUrl, tlsCert, tlsKey, devMode}
+	defer func() {
+		sessionKey, mailKey, baseUrl = saved[0].(string), saved[1].(string), saved[2].(string)
+		tlsCert, tlsKey, devMode = saved[3].(string), saved[4].(string), saved[5].(bool)
+	}()
+	reset := func() {
+		sessionKey, mailKey, baseUrl = "0123456789abcdef", "", "https://dialogue.example.com"
+		tlsCert, tlsKey, devMode = "", "", false
+	}
+	tests := []struct {
+		name   string
+		change func()
+		err    string
+	}{
+		{"valid", func() {}, ""},
+		{"default session key", func() { sessionKey = defaultSession }, "session-key must be changed from the default (or use -dev)"},
+		{"dev mode", func() { sessionKey, devMode = defaultSession, true }, ""},
+		{"short mail key", func() { mailKey = "short" }, "mail-key must be at least 16 characters"},
+		{"mail key", func() { mailKey = "fedcba9876543210" }, ""},
+		{"relative base url", func() { baseUrl = "/dialogue" }, `base-url must be an absolute url: "/dialogue"`},
+		{"tls key missing", func() { tlsCert = "cert.pem" }, "tls-cert and tls-key must be set together"},
+	}
+	for _, test := range tests {
+		reset()
+		test.change()
+		errs := validateConfig()
+		if test.err == "" && len(errs) > 0 {
+			t.Errorf("%s: validateConfig = %v", test.name, errs)
+		}
+		if test.err != "" && (len(errs) != 1 || errs[0] != test.err) {
+			t.Errorf("%s: validateConfig = %v, want %q", test.name, errs, test.err)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// scheduler publishes scheduled posts when they are due.  Several api
+	// instances can run a scheduler against the same database: each post
+	// is published by a single conditional write, so it is announced once.
+	scheduler struct {
+		api      *dialogueApi
+		interval time.Duration
+		beat     *heartbeat
+		stop     chan bool
+		done     chan bool
+	}
+)
+
+func newScheduler(api *dialogueApi, interval time.Duration) *scheduler {
+	return &scheduler{
+		api:      api,
+		interval: interval,
+		beat:     newHeartbeat(interval),
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+}
+
+// Run publishes due posts every interval until Stop is called.  Posts that
+// became due while the api was down are published on the first run.
+func (s *scheduler) Run() {
+	defer close(s.done)
+	s.publish(time.Now())
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			s.publish(time.Now())
+			s.beat.Beat(time.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run and waits for it to return
+func (s *scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *scheduler) publish(now time.Time) {
+	s.announce(now)
+	posts, err := s.api.rdb.GetDuePosts(now)
+	if err != nil {
+		log.Errorf("Error getting scheduled posts: %s", err)
+		return
+	}
+	if len(posts) == 0 {
+		return
+	}
+	tree, err := s.api.getCategoryTree()
+	if err != nil {
+		log.Errorf("Error getting categories: %s", err)
+		return
+	}
+	for _, p := range posts {
+		// posts that can no longer be published are returned to the
+		// author as drafts
+		topic, err := s.api.rdb.GetTopic(p.TopicId)
+		if err != nil {
+			log.Errorf("Error getting topic for scheduled post %s: %s", p.Id, err)
+			continue
+		}
+		if topic == nil || topic.Archived || topic.Closed || !tree.canPost(topic.CategoryId, p.Author) {
+			log.Warnf("Unable to publish scheduled post %s; moving it to drafts", p.Id)
+			p.Status = dialogue.POST_DRAFT
+			p.PublishAt = nil
+			if _, err := s.api.rdb.UpdateDraft(p); err != nil {
+				log.Errorf("Error updating scheduled post %s: %s", p.Id, err)
+			}
+			continue
+		}
+		if _, err := s.api.publishPost(p); err != nil {
+			log.Errorf("Error publishing scheduled post %s: %s", p.Id, err)
+		}
+	}
+}
+
+// announce announces posts that were published but not announced, i.e.
+// because the api stopped in between.  Posts published during the last
+// interval are left to the api instance that is publishing them.
+func (s *scheduler) announce(now time.Time) {
+	posts, err := s.api.rdb.GetUnannouncedPosts(now.Add(-s.interval))
+	if err != nil {
+		log.Errorf("Error getting unannounced posts: %s", err)
+		return
+	}
+	for _, p := range posts {
+		s.api.announcePost(p)
+	}
+}
+
+// draftFromRequest returns the status and publish time requested for a
+// post: draft=true saves a draft and publishAt (see parseTime) schedules
+// the post.  Published posts have an empty status.
+func draftFromRequest(form url.Values) (string, *time.Time, error) {
+	if v := form.Get("publishAt"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid publishAt: %s", v)
+		}
+		if !t.After(time.Now()) {
+			return "", nil, fmt.Errorf("publishAt must be in the future")
+		}
+		return dialogue.POST_SCHEDULED, &t, nil
+	}
+	if form.Get("draft") == "true" {
+		return dialogue.POST_DRAFT, nil, nil
+	}
+	return "", nil, nil
+}
+
+// publishPost publishes a draft or scheduled post and announces it.  It
+// returns false if the post had already been published or was changed.
+func (api *dialogueApi) publishPost(post *dialogue.Post) (bool, error) {
+	if err := api.preparePost(post); err != nil {
+		return false, err
+	}
+	ok, err := api.rdb.PublishPost(post)
+	if err != nil || !ok {
+		return false, err
+	}
+	api.announcePost(post)
+	return true, nil
+}
+
+// announcePost notifies about a published post unless someone else has
+// already done so.  If the api stops before this, the scheduler announces
+// the post later.
+func (api *dialogueApi) announcePost(post *dialogue.Post) {
+	claimed, err := api.rdb.ClaimPostAnnouncement(post.Id)
+	if err != nil {
+		log.Errorf("Error announcing post %s: %s", post.Id, err)
+		return
+	}
+	if claimed {
+		post.Unannounced = false
+		api.postPublished(post)
+	}
+}
+
+// checkDraftAccess returns the draft if it belongs to username.  Otherwise
+// an error is rendered.
+func (api *dialogueApi) checkDraftAccess(id string, username string, rndr render.Render) (*dialogue.Post, bool) {
+	post, err := api.rdb.GetDraft(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting draft: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	if post == nil || post.Author != username {
+		e := ApiError{
+			Message: "draft not found",
+		}
+		rndr.JSON(404, e)
+		return nil, false
+	}
+	return post, true
+}
+
+// draftChanged renders the error for a draft that could not be saved
+// because it was published (409) or changed (412) in the meantime
+func (api *dialogueApi) draftChanged(id string, rndr render.Render) {
+	post, err := api.rdb.GetDraft(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting draft: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post != nil {
+		versionConflict(rndr)
+		return
+	}
+	e := ApiError{
+		Message: "draft has already been published",
+	}
+	rndr.JSON(409, e)
+}
+
+// GetDrafts returns the user's drafts and scheduled posts
+func (api *dialogueApi) GetDrafts(session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	posts, err := api.rdb.GetDrafts(username)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting drafts: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if posts == nil {
+		posts = []*dialogue.Post{}
+	}
+	rndr.JSON(200, posts)
+}
+
+func (api *dialogueApi) GetDraft(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	post, ok := api.checkDraftAccess(params["id"], session.Get("username").(string), rndr)
+	if !ok {
+		return
+	}
+	if notModified(w, r, etag(post.Version)) {
+		return
+	}
+	rndr.JSON(200, post)
+}
+
+// PutDraft updates the content of a draft.  publishAt schedules it and
+// draft=true turns a scheduled post back into a draft.
+func (api *dialogueApi) PutDraft(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	post, ok := api.checkDraftAccess(params["id"], session.Get("username").(string), rndr)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(r, post.Version, rndr) {
+		return
+	}
+	if !validateRequest(r, draftSchema, rndr) {
+		return
+	}
+	if _, ok := r.Form["content"]; ok {
+		post.Content = r.FormValue("content")
+	}
+	if post.Content == "" && len(post.Attachments) == 0 {
+		e := ApiError{
+			Message: "content must be specified",
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	status, publishAt, err := draftFromRequest(r.Form)
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if status != "" {
+		post.Status = status
+		post.PublishAt = publishAt
+	}
+	updated, err := api.rdb.UpdateDraft(post)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating draft: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if !updated {
+		api.draftChanged(post.Id, rndr)
+		return
+	}
+	w.Header().Set("ETag", etag(post.Version))
+	w.WriteHeader(204)
+}
+
+// DeleteDraft permanently deletes a draft
+func (api *dialogueApi) DeleteDraft(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	post, ok := api.checkDraftAccess(params["id"], session.Get("username").(string), rndr)
+	if !ok {
+		return
+	}
+	if !checkIfMatch(r, post.Version, rndr) {
+		return
+	}
+	if err := api.rdb.DeleteDraft(post.Id, post.Version); err != nil {
+		if err == db.ErrVersionConflict {
+			api.draftChanged(post.Id, rndr)
+			return
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error deleting draft: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// PostDraftPublish publishes a draft or scheduled post immediately
+func (api *dialogueApi) PostDraftPublish(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	post, ok := api.checkDraftAccess(params["id"], username, rndr)
+	if !ok {
+		return
+	}
+	if _, ok := api.checkTopicAccess(post.TopicId, username, true, rndr); !ok {
+		return
+	}
+	published, err := api.publishPost(post)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error publishing draft: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if !published {
+		api.draftChanged(post.Id, rndr)
+		return
+	}
+	w.WriteHeader(204)
+}
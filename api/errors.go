@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+)
+
+// errorCodes are the codes used for error responses with each status.
+// Clients rely on them, so existing codes must not change.
+var errorCodes = map[int]string{
+	400: "bad_request",
+	401: "unauthorized",
+	403: "forbidden",
+	404: "not_found",
+	409: "conflict",
+	412: "precondition_failed",
+	413: "too_large",
+	422: "invalid_request",
+	428: "precondition_required",
+	429: "rate_limited",
+	500: "internal_error",
+	503: "unavailable",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return errorCodes[500]
+	}
+	return errorCodes[400]
+}
+
+// errorRender fills in the code and request id of ApiError responses
+type errorRender struct {
+	render.Render
+	requestId string
+}
+
+func (r *errorRender) JSON(status int, v interface{}) {
+	if e, ok := v.(ApiError); ok {
+		if e.Code == "" {
+			e.Code = errorCode(status)
+		}
+		e.RequestId = r.requestId
+		e.Error = e.Message
+		v = e
+	}
+	r.Render.JSON(status, v)
+}
+
+// requestId assigns each request an id, which is returned in the
+// X-Request-Id header and in error responses.  An id sent by the client
+// (i.e. from a proxy) is kept.
+func requestId(c martini.Context, w http.ResponseWriter, r *http.Request, rndr render.Render) {
+	id := r.Header.Get("X-Request-Id")
+	if id == "" || len(id) > 128 {
+		id = uuid.New()
+		r.Header.Set("X-Request-Id", id)
+	}
+	w.Header().Set("X-Request-Id", id)
+	c.MapTo(&errorRender{Render: rndr, requestId: id}, (*render.Render)(nil))
+}
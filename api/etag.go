@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/martini-contrib/render"
+)
+
+// etag returns the entity tag for a document version.  Responses that
+// include more than the document (i.e. topic activity) add a suffix after
+// a dot, which If-Match ignores.
+func etag(version int, suffix ...string) string {
+	tag := strconv.Itoa(version)
+	if len(suffix) > 0 {
+		tag += "." + strings.Join(suffix, ".")
+	}
+	return "\"" + tag + "\""
+}
+
+// tagVersion returns the document version in an entity tag
+func tagVersion(tag string) (int, bool) {
+	tag = strings.Trim(tag, "\"")
+	if i := strings.Index(tag, "."); i >= 0 {
+		tag = tag[:i]
+	}
+	v, err := strconv.Atoi(tag)
+	return v, err == nil
+}
+
+// notModified sets the ETag header and, if the request's If-None-Match
+// has the tag, responds with 304 and returns true
+func notModified(w http.ResponseWriter, r *http.Request, tag string) bool {
+	w.Header().Set("ETag", tag)
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == tag || t == "*" {
+			w.WriteHeader(304)
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch requires the request's If-Match header to have the current
+// version of the document being changed.  If it is missing (428) or does
+// not match (412) an error is rendered and false is returned.
+func checkIfMatch(r *http.Request, version int, rndr render.Render) bool {
+	h := r.Header.Get("If-Match")
+	if h == "" {
+		e := ApiError{
+			Message: "If-Match must be set to the ETag of the resource",
+		}
+		rndr.JSON(428, e)
+		return false
+	}
+	for _, t := range strings.Split(h, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if v, ok := tagVersion(t); ok && v == version {
+			return true
+		}
+	}
+	versionConflict(rndr)
+	return false
+}
+
+// versionConflict renders the error for a document that has changed since
+// the client read it
+func versionConflict(rndr render.Render) {
+	e := ApiError{
+		Message: "the resource has been changed since it was read",
+	}
+	rndr.JSON(412, e)
+}
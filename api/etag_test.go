@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtag(t *testing.T) {
+	tests := []struct {
+		version int
+		suffix  []string
+		tag     string
+	}{
+		{3, nil, `"3"`},
+		{3, []string{"12", "kx"}, `"3.12.kx"`},
+		{0, formatTag(formatHTML), `"0.` + formatHTML + renderVersion + `"`},
+		{0, formatTag(formatMarkdown), `"0"`},
+		{0, formatTag(formatText), `"0.` + formatText + `"`},
+	}
+	for _, test := range tests {
+		tag := etag(test.version, test.suffix...)
+		if tag != test.tag {
+			t.Errorf("etag(%d, %v) = %s, want %s", test.version, test.suffix, tag, test.tag)
+		}
+		if v, ok := tagVersion(tag); !ok || v != test.version {
+			t.Errorf("tagVersion(%s) = %d, %v", tag, v, ok)
+		}
+	}
+	if _, ok := tagVersion(`"abc"`); ok {
+		t.Errorf("tagVersion accepted a tag without a version")
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		status      int
+	}{
+		{"", 200},
+		{`"3.1"`, 304},
+		{`W/"3.1"`, 304},
+		{`"2.1", "3.1"`, 304},
+		{`"3"`, 200},
+		{"*", 304},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/topics/t1", nil)
+		r.Header.Set("If-None-Match", test.ifNoneMatch)
+		w := httptest.NewRecorder()
+		if notModified(w, r, `"3.1"`) != (test.status == 304) || w.Code != test.status {
+			t.Errorf("If-None-Match %s: status %d, want %d", test.ifNoneMatch, w.Code, test.status)
+		}
+		if w.Header().Get("ETag") != `"3.1"` {
+			t.Errorf("If-None-Match %s: ETag = %s", test.ifNoneMatch, w.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		status  int
+	}{
+		{`"3"`, 0},
+		{`"3.12.kx"`, 0},
+		{`"2", "3"`, 0},
+		{"*", 0},
+		{"", 428},
+		{`"2"`, 412},
+		{"3", 0},
+		{`"x"`, 412},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("PUT", "/topics/t1", nil)
+		r.Header.Set("If-Match", test.ifMatch)
+		rndr := &fakeRender{}
+		if ok := checkIfMatch(r, 3, rndr); ok != (test.status == 0) || rndr.status != test.status {
+			t.Errorf("If-Match %s: ok %v, status %d, want %d", test.ifMatch, ok, rndr.status, test.status)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// eventHub fans out events to realtime stream subscribers
+	eventHub struct {
+		mu          sync.Mutex
+		subscribers map[chan *dialogue.Event]string
+		closed      chan bool
+	}
+)
+
+const (
+	eventBufferSize = 32
+	eventStreamPing = time.Second * 30
+)
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subscribers: map[chan *dialogue.Event]string{},
+		closed:      make(chan bool),
+	}
+}
+
+// Close ends all streams, which would otherwise keep the server from
+// shutting down
+func (h *eventHub) Close() {
+	close(h.closed)
+}
+
+func (h *eventHub) Subscribe(username string) chan *dialogue.Event {
+	c := make(chan *dialogue.Event, eventBufferSize)
+	h.mu.Lock()
+	h.subscribers[c] = username
+	h.mu.Unlock()
+	return c
+}
+
+func (h *eventHub) Unsubscribe(c chan *dialogue.Event) {
+	h.mu.Lock()
+	delete(h.subscribers, c)
+	h.mu.Unlock()
+}
+
+// Publish sends an event to the subscribers for username
+func (h *eventHub) Publish(username string, eventType string, data interface{}) {
+	h.PublishIf(func(u string) bool {
+		return u == username
+	}, eventType, data)
+}
+
+// PublishIf sends an event to the subscribers whose user is allowed to
+// see it.  Slow subscribers miss events rather than blocking the
+// publisher.
+func (h *eventHub) PublishIf(allowed func(username string) bool, eventType string, data interface{}) {
+	e := &dialogue.Event{
+		Type: eventType,
+		Data: data,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c, u := range h.subscribers {
+		if !allowed(u) {
+			continue
+		}
+		select {
+		case c <- e:
+		default:
+			log.Warnf("Dropping %s event for slow subscriber %s", eventType, u)
+		}
+	}
+}
+
+// Count returns the number of stream subscribers
+func (h *eventHub) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// GetEvents streams events to the client as server-sent events
+func (api *dialogueApi) GetEvents(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		e := ApiError{
+			Message: "streaming is not supported",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	c := api.events.Subscribe(username)
+	defer api.events.Unsubscribe(c)
+	ping := time.NewTicker(eventStreamPing)
+	defer ping.Stop()
+	// end the stream cleanly before the server's write timeout cuts it
+	// off; clients reconnect
+	var expire <-chan time.Time
+	if t := api.server.WriteTimeout; t > 0 {
+		expire = time.After(t - t/10)
+	}
+	for {
+		select {
+		case e := <-c:
+			b, err := json.Marshal(e.Data)
+			if err != nil {
+				log.Errorf("Error serializing event: %s", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, b)
+			flusher.Flush()
+		case <-ping.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-expire:
+			return
+		case <-api.events.closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/martini-contrib/sessions"
+)
+
+// fakeSession is the session of a logged in user
+type fakeSession struct {
+	sessions.Session
+	username string
+}
+
+func (s fakeSession) Get(key interface{}) interface{} {
+	if key == "username" {
+		return s.username
+	}
+	return nil
+}
+
+// fakeDb keeps topics and subscriptions in memory.  Methods that are not
+// implemented panic through the embedded nil db.Db, so tests notice when
+// the code under test needs more of the database.
+type fakeDb struct {
+	db.Db
+	mu         sync.Mutex
+	topics     map[string]*dialogue.Topic
+	subs       map[string]*dialogue.Subscription
+	categories map[string]*dialogue.Category
+	// unread counts the unread posts by topic for every user
+	unread map[string]int
+	users  map[string]*dialogue.User
+	inbox  []*dialogue.InboxEntry
+	posts  map[string]*dialogue.Post
+	// findPosts records the arguments of the last FindPosts call
+	findPosts []interface{}
+	pingErr   error
+	audit     []*dialogue.AuditEntry
+}
+
+func newFakeDb() *fakeDb {
+	return &fakeDb{
+		topics: map[string]*dialogue.Topic{},
+		subs:   map[string]*dialogue.Subscription{},
+		categories: map[string]*dialogue.Category{
+			dialogue.DEFAULT_CATEGORY: {Id: dialogue.DEFAULT_CATEGORY, Name: "General"},
+		},
+		unread: map[string]int{},
+		users:  map[string]*dialogue.User{},
+		posts:  map[string]*dialogue.Post{},
+	}
+}
+
+// addTopic adds a topic in the default category unless it has one
+func (f *fakeDb) addTopic(t *dialogue.Topic) *dialogue.Topic {
+	if t.CategoryId == "" {
+		t.CategoryId = dialogue.DEFAULT_CATEGORY
+	}
+	f.topics[t.Id] = t
+	return t
+}
+
+func (f *fakeDb) GetTopics() ([]*dialogue.Topic, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ids := []string{}
+	for id := range f.topics {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	topics := []*dialogue.Topic{}
+	for _, id := range ids {
+		topics = append(topics, f.topics[id])
+	}
+	return topics, nil
+}
+
+func (f *fakeDb) GetCategories() ([]*dialogue.Category, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cats := []*dialogue.Category{}
+	for _, c := range f.categories {
+		cats = append(cats, c)
+	}
+	return cats, nil
+}
+
+func (f *fakeDb) GetUnreadCounts(username string, topicIds []string) (map[string]int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := map[string]int{}
+	for _, id := range topicIds {
+		if n := f.unread[id]; n > 0 {
+			counts[id] = n
+		}
+	}
+	return counts, nil
+}
+
+func (f *fakeDb) GetTopic(id string) (*dialogue.Topic, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.topics[id], nil
+}
+
+func (f *fakeDb) GetSubscriptionByToken(token string) (*dialogue.Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sub := range f.subs {
+		if sub.UnsubscribeToken == token {
+			return sub, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeDb) DeleteSubscription(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, id)
+	return nil
+}
+
+func (f *fakeDb) ClaimTopicReminder(id string, overdue bool) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	t, ok := f.topics[id]
+	if !ok {
+		return false, nil
+	}
+	sent := &t.DueReminderSent
+	if overdue {
+		sent = &t.OverdueReminderSent
+	}
+	if *sent {
+		return false, nil
+	}
+	*sent = true
+	return true, nil
+}
+
+func (f *fakeDb) GetUser(username string) (*dialogue.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.users[username], nil
+}
+
+func (f *fakeDb) SaveInboxEntry(entry *dialogue.InboxEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.inbox = append(f.inbox, entry)
+	return nil
+}
+
+func (f *fakeDb) UpdateTopic(topic *dialogue.Topic) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	current, ok := f.topics[topic.Id]
+	if !ok {
+		return db.ErrTopicNotFound
+	}
+	if current.Version != topic.Version {
+		return db.ErrVersionConflict
+	}
+	topic.Version++
+	f.topics[topic.Id] = topic
+	return nil
+}
+
+func (f *fakeDb) GetTopicsByCategory(categoryIds []string) ([]*dialogue.Topic, error) {
+	all, _ := f.GetTopics()
+	topics := []*dialogue.Topic{}
+	for _, t := range all {
+		for _, id := range categoryIds {
+			if t.CategoryId == id {
+				topics = append(topics, t)
+			}
+		}
+	}
+	return topics, nil
+}
+
+func (f *fakeDb) SaveTopic(topic *dialogue.Topic) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.topics {
+		if t.Title == topic.Title {
+			return db.ErrTopicExists
+		}
+	}
+	topic.Id = fmt.Sprintf("t%d", len(f.topics)+1)
+	f.topics[topic.Id] = topic
+	return nil
+}
+
+func (f *fakeDb) GetPost(id string) (*dialogue.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.posts[id], nil
+}
+
+func (f *fakeDb) FindPosts(topicIds []string, author string, since, until *time.Time, limit int) ([]*dialogue.Post, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.findPosts = []interface{}{topicIds, author, since, until, limit}
+	return []*dialogue.Post{}, nil
+}
+
+func (f *fakeDb) GetTopicActivity(topicId string) (int, *time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	var last *time.Time
+	for _, p := range f.posts {
+		if p.TopicId != topicId {
+			continue
+		}
+		count++
+		if created := p.Created; last == nil || created.After(*last) {
+			last = &created
+		}
+	}
+	return count, last, nil
+}
+
+func (f *fakeDb) Ping() error {
+	return f.pingErr
+}
+
+func (f *fakeDb) SaveAuditEntry(entry *dialogue.AuditEntry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.audit = append(f.audit, entry)
+	return nil
+}
+
+func (f *fakeDb) FindAuditEntries(action, actor, target string, since, until *time.Time, limit int) ([]*dialogue.AuditEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries := []*dialogue.AuditEntry{}
+	for _, e := range f.audit {
+		if (action == "" || e.Action == action) && (actor == "" || e.Actor == actor) && (target == "" || e.Target == target) {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/martini-contrib/render"
+)
+
+type (
+	// heartbeat records when a background worker last did its work, so
+	// that a stuck worker makes the api unready
+	heartbeat struct {
+		mu       sync.Mutex
+		last     time.Time
+		interval time.Duration
+	}
+	Health struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks,omitempty"`
+	}
+)
+
+const (
+	HEALTH_OK      = "ok"
+	HEALTH_FAILING = "failing"
+)
+
+func newHeartbeat(interval time.Duration) *heartbeat {
+	return &heartbeat{
+		last:     time.Now(),
+		interval: interval,
+	}
+}
+
+func (h *heartbeat) Beat(now time.Time) {
+	h.mu.Lock()
+	h.last = now
+	h.mu.Unlock()
+}
+
+// Alive returns false if the worker has missed several runs
+func (h *heartbeat) Alive(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return now.Sub(h.last) < h.interval*3
+}
+
+// GetHealthz reports that the api is running
+func (api *dialogueApi) GetHealthz(rndr render.Render) {
+	rndr.JSON(200, Health{Status: HEALTH_OK})
+}
+
+// GetReadyz reports whether the api can serve requests: the database must
+// answer and the background workers must be running.  It responds with
+// 503 and the failing checks otherwise.
+func (api *dialogueApi) GetReadyz(rndr render.Render) {
+	h := Health{
+		Status: HEALTH_OK,
+		Checks: map[string]string{},
+	}
+	if err := api.rdb.Ping(); err != nil {
+		log.Errorf("Readiness check failed: database: %s", err)
+		h.Checks["database"] = HEALTH_FAILING
+		h.Status = HEALTH_FAILING
+	} else {
+		h.Checks["database"] = HEALTH_OK
+	}
+	now := time.Now()
+	for name, b := range api.workers {
+		if b.Alive(now) {
+			h.Checks[name] = HEALTH_OK
+			continue
+		}
+		log.Errorf("Readiness check failed: %s has not run for %s", name, b.interval*3)
+		h.Checks[name] = HEALTH_FAILING
+		h.Status = HEALTH_FAILING
+	}
+	if h.Status != HEALTH_OK {
+		rndr.JSON(503, h)
+		return
+	}
+	rndr.JSON(200, h)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHeartbeat(t *testing.T) {
+	now := time.Now()
+	b := newHeartbeat(time.Minute)
+	b.Beat(now)
+	tests := []struct {
+		at    time.Duration
+		alive bool
+	}{
+		{0, true},
+		{2 * time.Minute, true},
+		{3 * time.Minute, false},
+	}
+	for _, test := range tests {
+		if alive := b.Alive(now.Add(test.at)); alive != test.alive {
+			t.Errorf("Alive after %s = %v, want %v", test.at, alive, test.alive)
+		}
+	}
+}
+
+func TestGetReadyz(t *testing.T) {
+	stuck := newHeartbeat(time.Minute)
+	stuck.Beat(time.Now().Add(-time.Hour))
+	tests := []struct {
+		name    string
+		pingErr error
+		workers map[string]*heartbeat
+		status  int
+		failing []string
+	}{
+		{"ready", nil, map[string]*heartbeat{"notifier": newHeartbeat(time.Minute)}, 200, nil},
+		{"database down", errors.New("connection refused"), nil, 503, []string{"database"}},
+		{"stuck worker", nil, map[string]*heartbeat{"notifier": newHeartbeat(time.Minute), "purger": stuck}, 503, []string{"purger"}},
+	}
+	for _, test := range tests {
+		rdb := newFakeDb()
+		rdb.pingErr = test.pingErr
+		api := &dialogueApi{rdb: rdb, workers: test.workers}
+		rndr := &fakeRender{}
+		api.GetReadyz(rndr)
+		h, ok := rndr.v.(Health)
+		if rndr.status != test.status || !ok {
+			t.Errorf("%s: status %d, %+v", test.name, rndr.status, rndr.v)
+			continue
+		}
+		failing := 0
+		for _, status := range h.Checks {
+			if status == HEALTH_FAILING {
+				failing++
+			}
+		}
+		if failing != len(test.failing) {
+			t.Errorf("%s: checks %v, want %v failing", test.name, h.Checks, test.failing)
+		}
+		for _, name := range test.failing {
+			if h.Checks[name] != HEALTH_FAILING {
+				t.Errorf("%s: %s is %q", test.name, name, h.Checks[name])
+			}
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/mailer"
+	"github.com/martini-contrib/render"
+)
+
+type (
+	// inboundGateway turns replies to notification emails into posts.
+	// The topic is identified by the signed reply address the
+	// notification was sent with.  The signature is bound to the
+	// recipient of the notification, so only mail from that user is
+	// accepted for it.  Rejected messages are not bounced to the sender,
+	// which can't be verified; the SMTP listener rejects them in the
+	// session instead.
+	inboundGateway struct {
+		api     *dialogueApi
+		secret  string
+		token   string
+		maxSize int64
+	}
+)
+
+func newInboundGateway(api *dialogueApi, secret, token string, maxSize int64) *inboundGateway {
+	return &inboundGateway{
+		api:     api,
+		secret:  secret,
+		token:   token,
+		maxSize: maxSize,
+	}
+}
+
+// HandleSMTP is the mailer.InboundHandler for the embedded SMTP listener
+func (g *inboundGateway) HandleSMTP(from string, to []string, data []byte) error {
+	_, err := g.Receive(to, data)
+	return err
+}
+
+// Receive creates a post from a raw MIME message.  Recipients are the
+// envelope recipients, if known, and are checked for a reply address in
+// addition to the message headers.
+func (g *inboundGateway) Receive(recipients []string, data []byte) (*dialogue.Post, error) {
+	msg, err := mailer.ParseMessage(data)
+	if err != nil {
+		return nil, &mailer.Bounce{Reason: fmt.Sprintf("unable to parse message: %s", err)}
+	}
+	user, err := g.api.rdb.GetUserByEmail(msg.From)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, &mailer.Bounce{Reason: fmt.Sprintf("unknown sender: %s", msg.From)}
+	}
+	topicId := g.findTopic(user.Username, append(recipients, msg.To...))
+	if topicId == "" {
+		return nil, &mailer.Bounce{Reason: "no valid reply address for the sender"}
+	}
+	topic, err := g.api.rdb.GetTopic(topicId)
+	if err != nil {
+		return nil, err
+	}
+	if topic == nil {
+		return nil, &mailer.Bounce{Reason: "topic not found"}
+	}
+	tree, err := g.api.getCategoryTree()
+	if err != nil {
+		return nil, err
+	}
+	if !tree.canRead(topic.CategoryId, user.Username) {
+		return nil, &mailer.Bounce{Reason: "topic not found"}
+	}
+	if !tree.canPost(topic.CategoryId, user.Username) {
+		return nil, &mailer.Bounce{Reason: "you are not allowed to post in this topic"}
+	}
+	if topic.Closed {
+		return nil, &mailer.Bounce{Reason: "topic is closed"}
+	}
+	if topic.Archived {
+		return nil, &mailer.Bounce{Reason: "topic is archived"}
+	}
+	content := mailer.StripReply(msg.Text)
+	if content == "" {
+		return nil, &mailer.Bounce{Reason: "message has no content"}
+	}
+	post := &dialogue.Post{
+		Content: content,
+		TopicId: topicId,
+		Author:  user.Username,
+	}
+	if err := g.api.savePost(post); err != nil {
+		return nil, err
+	}
+	log.Infof("Created post %s in topic %s from email by %s", post.Id, topicId, user.Username)
+	return post, nil
+}
+
+// findTopic returns the topic of the first reply address that is signed
+// for username, or an empty string if there is none
+func (g *inboundGateway) findTopic(username string, addresses []string) string {
+	for _, addr := range addresses {
+		if topicId, ok := mailer.ParseReplyAddress(g.secret, addr, username); ok {
+			return topicId
+		}
+	}
+	return ""
+}
+
+// PostInbound accepts a raw MIME message from a mail provider webhook
+func (api *dialogueApi) PostInbound(w http.ResponseWriter, r *http.Request, rndr render.Render) {
+	g := api.inbound
+	if g == nil || g.token == "" {
+		e := ApiError{
+			Message: "inbound email is not enabled",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	token := r.Header.Get("X-Inbound-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(g.token)) != 1 {
+		e := ApiError{
+			Message: "invalid inbound token",
+		}
+		rndr.JSON(401, e)
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, g.maxSize+1))
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error reading message: %s", err),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if int64(len(data)) > g.maxSize {
+		e := ApiError{
+			Message: "message too large",
+		}
+		rndr.JSON(413, e)
+		return
+	}
+	var recipients []string
+	if rcpt := r.Header.Get("X-Original-To"); rcpt != "" {
+		recipients = append(recipients, strings.ToLower(rcpt))
+	}
+	if _, err := g.Receive(recipients, data); err != nil {
+		if b, ok := err.(*mailer.Bounce); ok {
+			e := ApiError{
+				Message: b.Reason,
+			}
+			rndr.JSON(422, e)
+			return
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error receiving message: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+var mentionRe = regexp.MustCompile(`(?:^|[^\w@])@([A-Za-z0-9_.-]*[A-Za-z0-9_])`)
+
+// parseMentions returns the unique usernames mentioned in content
+func parseMentions(content string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, m := range mentionRe.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// savePost prepares and saves a new post and announces it
+func (api *dialogueApi) savePost(post *dialogue.Post) error {
+	if err := api.preparePost(post); err != nil {
+		return err
+	}
+	if err := api.rdb.SavePost(post); err != nil {
+		return err
+	}
+	api.postPublished(post)
+	return nil
+}
+
+// preparePost resolves mentions and renders the post content
+func (api *dialogueApi) preparePost(post *dialogue.Post) error {
+	var mentions []string
+	for _, name := range parseMentions(post.Content) {
+		user, err := api.rdb.GetUser(name)
+		if err != nil {
+			return err
+		}
+		if user != nil {
+			mentions = append(mentions, user.Username)
+		}
+	}
+	post.Mentions = mentions
+	api.renderPost(post)
+	return nil
+}
+
+// postPublished notifies mentioned users, subscribers and stream clients
+// of a new post.  Only users that can read the topic are notified.
+func (api *dialogueApi) postPublished(post *dialogue.Post) {
+	topic, err := api.rdb.GetTopic(post.TopicId)
+	if err != nil {
+		log.Errorf("Error getting topic of post %s: %s", post.Id, err)
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		log.Errorf("Error getting categories: %s", err)
+		return
+	}
+	if topic == nil {
+		return
+	}
+	canRead := func(username string) bool {
+		return tree.canRead(topic.CategoryId, username)
+	}
+	for _, username := range post.Mentions {
+		if username == post.Author || !canRead(username) {
+			continue
+		}
+		entry := &dialogue.InboxEntry{
+			Username: username,
+			Kind:     dialogue.INBOX_MENTION,
+			TopicId:  post.TopicId,
+			PostId:   post.Id,
+			Author:   post.Author,
+		}
+		if err := api.rdb.SaveInboxEntry(entry); err != nil {
+			log.Errorf("Error saving inbox entry for %s: %s", username, err)
+			continue
+		}
+		api.events.Publish(username, dialogue.EVENT_INBOX_CREATED, entry)
+	}
+	api.events.PublishIf(canRead, dialogue.EVENT_POST_CREATED, post)
+	if api.notifier != nil {
+		api.notifier.PostCreatedAsync(post)
+	}
+}
+
+func (api *dialogueApi) GetInbox(r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	entries, err := api.rdb.GetInbox(username, unreadOnly)
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting inbox",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, entries)
+}
+
+func (api *dialogueApi) PostInboxRead(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	entry, err := api.rdb.GetInboxEntry(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting inbox entry: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if entry == nil || entry.Username != username {
+		e := ApiError{
+			Message: "inbox entry not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if err := api.rdb.MarkInboxRead(username, id); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating inbox: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) PostInboxReadAll(w http.ResponseWriter, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if err := api.rdb.MarkInboxRead(username, ""); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating inbox: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"hi @alice", []string{"alice"}},
+		{"@alice and @bob, @alice again", []string{"alice", "bob"}},
+		{"thanks @alice.", []string{"alice"}},
+		{"(@bob_smith) @j.doe-2", []string{"bob_smith", "j.doe-2"}},
+		{"alice@example.com", nil},
+		{"@@alice", nil},
+		{"@ alone", nil},
+		{"no mentions", nil},
+	}
+	for _, test := range tests {
+		got := parseMentions(test.content)
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("parseMentions(%q) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
+
+func TestEventHub(t *testing.T) {
+	h := newEventHub()
+	alice := h.Subscribe("alice")
+	bob := h.Subscribe("bob")
+	if h.Count() != 2 {
+		t.Fatalf("Count = %d, want 2", h.Count())
+	}
+	h.Publish("alice", "inbox.created", "x")
+	h.PublishIf(func(u string) bool { return true }, "post.created", "y")
+	want := map[string][]string{
+		"alice": {"inbox.created", "post.created"},
+		"bob":   {"post.created"},
+	}
+	for name, c := range map[string]chan *dialogue.Event{"alice": alice, "bob": bob} {
+		var got []string
+		for len(c) > 0 {
+			got = append(got, (<-c).Type)
+		}
+		if strings.Join(got, ",") != strings.Join(want[name], ",") {
+			t.Errorf("%s received %v, want %v", name, got, want[name])
+		}
+	}
+	// slow subscribers miss events instead of blocking
+	for i := 0; i < eventBufferSize+1; i++ {
+		h.Publish("bob", "post.created", i)
+	}
+	if len(bob) != eventBufferSize {
+		t.Errorf("bob has %d buffered events, want %d", len(bob), eventBufferSize)
+	}
+	h.Unsubscribe(alice)
+	if h.Count() != 1 {
+		t.Errorf("Count after Unsubscribe = %d, want 1", h.Count())
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+var (
+	labelNameRe  = regexp.MustCompile(`^[\w.:/-]+$`)
+	labelColorRe = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// labelFromRequest validates the label fields in the request
+func labelFromRequest(r *http.Request) (*dialogue.Label, error) {
+	label := &dialogue.Label{
+		Name:        r.FormValue("name"),
+		Color:       r.FormValue("color"),
+		Description: r.FormValue("description"),
+	}
+	if !labelNameRe.MatchString(label.Name) {
+		return nil, fmt.Errorf("invalid label name: %q", label.Name)
+	}
+	if label.Color == "" {
+		label.Color = "#cccccc"
+	}
+	if !labelColorRe.MatchString(label.Color) {
+		return nil, fmt.Errorf("invalid color (expected #rrggbb): %s", label.Color)
+	}
+	return label, nil
+}
+
+func (api *dialogueApi) GetLabels(rndr render.Render) {
+	labels, err := api.rdb.GetLabels()
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting labels",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, labels)
+}
+
+func (api *dialogueApi) PostLabels(w http.ResponseWriter, r *http.Request, rndr render.Render) {
+	label, err := labelFromRequest(r)
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.SaveLabel(label); err != nil {
+		status := 500
+		if err == db.ErrLabelExists {
+			status = 409
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error saving label: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) PutLabel(w http.ResponseWriter, r *http.Request, params martini.Params, rndr render.Render) {
+	name := params["name"]
+	existing, err := api.rdb.GetLabel(name)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting label: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if existing == nil {
+		e := ApiError{
+			Message: "label not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	// keep fields that are not being updated
+	if r.FormValue("name") == "" {
+		r.Form.Set("name", existing.Name)
+	}
+	if r.FormValue("color") == "" {
+		r.Form.Set("color", existing.Color)
+	}
+	if _, ok := r.Form["description"]; !ok {
+		r.Form.Set("description", existing.Description)
+	}
+	label, err := labelFromRequest(r)
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.UpdateLabel(name, label); err != nil {
+		status := 500
+		if err == db.ErrLabelExists {
+			status = 409
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating label: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) DeleteLabel(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	if err := api.rdb.DeleteLabel(params["name"]); err != nil {
+		status := 500
+		if err == db.ErrLabelNotFound {
+			status = 404
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error deleting label: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	api.audit(r, dialogue.AUDIT_LABEL_DELETED, session.Get("username").(string), params["name"], nil)
+	w.WriteHeader(204)
+}
+
+// PostTopicLabels attaches an existing label to a topic
+func (api *dialogueApi) PostTopicLabels(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	topicId := params["topicId"]
+	name := r.FormValue("label")
+	label, err := api.rdb.GetLabel(name)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting label: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if label == nil {
+		e := ApiError{
+			Message: fmt.Sprintf("unknown label: %s", name),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	api.updateTopicLabels(w, topicId, session.Get("username").(string), rndr, func(t *dialogue.Topic) {
+		if !t.HasLabel(name) {
+			t.Labels = append(t.Labels, name)
+		}
+	})
+}
+
+func (api *dialogueApi) DeleteTopicLabel(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	name := params["name"]
+	api.updateTopicLabels(w, params["topicId"], session.Get("username").(string), rndr, func(t *dialogue.Topic) {
+		labels := []string{}
+		for _, l := range t.Labels {
+			if l != name {
+				labels = append(labels, l)
+			}
+		}
+		t.Labels = labels
+	})
+}
+
+func (api *dialogueApi) updateTopicLabels(w http.ResponseWriter, topicId string, username string, rndr render.Render, update func(*dialogue.Topic)) {
+	topic, ok := api.checkTopicAccess(topicId, username, true, rndr)
+	if !ok {
+		return
+	}
+	archived := false
+	err := api.updateTopic(topic, func(t *dialogue.Topic) bool {
+		if t.Archived {
+			archived = true
+			return false
+		}
+		update(t)
+		return true
+	})
+	if archived {
+		e := ApiError{
+			Message: "topic is archived",
+		}
+		rndr.JSON(409, e)
+		return
+	}
+	if err != nil {
+		status := 500
+		if err == db.ErrTopicNotFound {
+			status = 404
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating topic: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestLabelFromRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		color string
+		want  string
+		ok    bool
+	}{
+		{"bug", "", "#cccccc", true},
+		{"area:api", "#ff0000", "#ff0000", true},
+		{"v1.2/backport-ok_x", "#A0b1C2", "#A0b1C2", true},
+		{"", "", "", false},
+		{"needs review", "", "", false},
+		{"bug", "red", "", false},
+		{"bug", "#fff", "", false},
+	}
+	for _, test := range tests {
+		form := url.Values{"name": {test.name}, "color": {test.color}}
+		r, _ := http.NewRequest("POST", "/labels", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		label, err := labelFromRequest(r)
+		if (err == nil) != test.ok {
+			t.Errorf("%q %q: err = %v, want ok %v", test.name, test.color, err, test.ok)
+			continue
+		}
+		if err == nil && (label.Name != test.name || label.Color != test.want) {
+			t.Errorf("%q %q: label = %+v", test.name, test.color, label)
+		}
+	}
+}
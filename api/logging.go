@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/sessions"
+)
+
+var routeType = reflect.TypeOf((*martini.Route)(nil)).Elem()
+
+// requestLog logs each request with its id, route, status, latency and
+// user.  It replaces martini's logger.
+func requestLog(c martini.Context, w http.ResponseWriter, r *http.Request, session sessions.Session) {
+	start := time.Now()
+	c.Next()
+	status := responseStatus(w)
+	fields := logrus.Fields{
+		"requestId": r.Header.Get("X-Request-Id"),
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"route":     routePattern(c),
+		"status":    status,
+		"latencyMs": time.Since(start).Seconds() * 1000,
+		"remote":    remoteHost(r),
+	}
+	if username, ok := session.Get("username").(string); ok {
+		fields["user"] = username
+	}
+	entry := log.WithFields(fields)
+	if status >= 500 {
+		entry.Error("request")
+		return
+	}
+	entry.Info("request")
+}
+
+// routePattern returns the pattern of the route that handled the request,
+// or an empty string if no route matched
+func routePattern(c martini.Context) string {
+	if v := c.Get(routeType); v.IsValid() {
+		return v.Interface().(martini.Route).Pattern()
+	}
+	return ""
+}
+
+// responseStatus returns the status of the response that was written
+func responseStatus(w http.ResponseWriter) int {
+	if rw, ok := w.(martini.ResponseWriter); ok && rw.Status() != 0 {
+		return rw.Status()
+	}
+	return 200
+}
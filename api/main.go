@@ -1,13 +1,21 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/ehazlett/dialogue/auth"
+	"github.com/ehazlett/dialogue/blob"
 	"github.com/ehazlett/dialogue/db"
+	"github.com/ehazlett/dialogue/mailer"
 )
 
 var (
@@ -15,48 +23,270 @@ var (
 	rethinkDbAddress string
 	rethinkDbName    string
 	enableDebug      bool
+	logFormat        string
+	configFile       string
+	showConfig       bool
+	devMode          bool
+	authCost         int
 	sessionKey       string
+	mailKey          string
+	baseUrl          string
+	smtpAddress      string
+	smtpUsername     string
+	smtpPassword     string
+	mailFrom         string
+	mailDir          string
+	mailDomain       string
+	inboundAddress   string
+	inboundToken     string
+	inboundMaxSize   int64
+	digestInterval   time.Duration
+	reminderLead     time.Duration
+	trashRetention   time.Duration
+	auditRetention   time.Duration
+	attachmentDir    string
+	attachmentSize   int64
+	attachmentTypes  string
+	uploadRetention  time.Duration
+	s3Endpoint       string
+	s3Bucket         string
+	s3Region         string
+	s3AccessKey      string
+	s3SecretKey      string
+	rateLimitRead    int
+	rateLimitWrite   int
+	rateLimitAuth    int
+	rateLimitAddress int
+	rateLimitShared  bool
+	trustProxy       bool
+	readTimeout      time.Duration
+	writeTimeout     time.Duration
+	idleTimeout      time.Duration
+	shutdownTimeout  time.Duration
+	tlsCert          string
+	tlsKey           string
+	tlsClientCA      string
 	log              = logrus.New()
 )
 
 func init() {
+	flag.StringVar(&configFile, "config", os.Getenv("DIALOGUE_CONFIG"), "Config file (TOML)")
+	flag.BoolVar(&showConfig, "print-config", false, "Print the effective config with secrets redacted and exit")
+	flag.BoolVar(&devMode, "dev", false, "Development mode (allows the default session key)")
 	flag.StringVar(&listenAddress, "l", ":3000", "Listen address (i.e. 127.0.0.1:3000)")
 	flag.StringVar(&rethinkDbAddress, "rethink-address", "127.0.0.1:28015", "RethinkDB Address")
 	flag.StringVar(&rethinkDbName, "rethink-name", "dialogue", "RethinkDB Name")
 	flag.BoolVar(&enableDebug, "debug", false, "Enable debug logging")
-	flag.StringVar(&sessionKey, "session-key", "dialogue-key", "Secret Session Key")
+	flag.StringVar(&logFormat, "log-format", "text", "Log format (text or json)")
+	flag.StringVar(&sessionKey, "session-key", defaultSession, "Secret Session Key")
+	flag.IntVar(&authCost, "auth-cost", 0, "bcrypt cost of password hashes (0 uses the default)")
+	flag.StringVar(&baseUrl, "base-url", "http://localhost:3000", "Public URL of the API (used in emails)")
+	flag.StringVar(&smtpAddress, "smtp-address", "", "SMTP server address for notifications (i.e. smtp.example.com:587)")
+	flag.StringVar(&smtpUsername, "smtp-username", "", "SMTP username")
+	flag.StringVar(&smtpPassword, "smtp-password", "", "SMTP password")
+	flag.StringVar(&mailFrom, "mail-from", "dialogue@localhost", "Sender address for notifications")
+	flag.StringVar(&mailDir, "mail-dir", "", "Write notifications to this directory instead of sending them")
+	flag.StringVar(&mailKey, "mail-key", "", "Secret for signing reply addresses (default: derived from -session-key)")
+	flag.StringVar(&mailDomain, "mail-domain", "", "Domain for reply addresses (default: domain of -mail-from)")
+	flag.StringVar(&inboundAddress, "inbound-smtp-address", "", "Listen address for inbound email (i.e. :2525)")
+	flag.StringVar(&inboundToken, "inbound-token", "", "Shared secret required to post raw messages to /inbound")
+	flag.Int64Var(&inboundMaxSize, "inbound-max-size", 10<<20, "Maximum size of inbound messages in bytes")
+	flag.DurationVar(&digestInterval, "digest-interval", time.Minute, "How often to check for pending digests")
+	flag.DurationVar(&reminderLead, "reminder-lead", time.Hour*24, "Remind assignees this long before a topic is due")
+	flag.DurationVar(&trashRetention, "trash-retention", time.Hour*24*30, "Permanently delete trash after this long (0 keeps it forever)")
+	flag.DurationVar(&auditRetention, "audit-retention", time.Hour*24*365, "Delete audit log entries after this long (0 keeps them forever)")
+	flag.StringVar(&attachmentDir, "attachment-dir", "attachments", "Directory for attachments when S3 is not configured")
+	flag.Int64Var(&attachmentSize, "attachment-max-size", 10<<20, "Maximum size of attachments in bytes")
+	flag.StringVar(&attachmentTypes, "attachment-types", "image/,text/,application/pdf,application/zip,application/x-gzip", "Allowed attachment content types (comma separated; \"image/\" allows all images, \"*\" allows anything)")
+	flag.DurationVar(&uploadRetention, "upload-retention", time.Hour*24, "Delete uploaded attachments that were not posted after this long")
+	flag.StringVar(&s3Endpoint, "s3-endpoint", "", "S3 compatible endpoint for attachments (i.e. https://s3.amazonaws.com or http://localhost:9000)")
+	flag.StringVar(&s3Bucket, "s3-bucket", "", "S3 bucket for attachments")
+	flag.StringVar(&s3Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&s3AccessKey, "s3-access-key", "", "S3 access key")
+	flag.StringVar(&s3SecretKey, "s3-secret-key", "", "S3 secret key")
+	flag.IntVar(&rateLimitRead, "rate-limit-read", 600, "Read requests per minute per user (0 disables the limit)")
+	flag.IntVar(&rateLimitWrite, "rate-limit-write", 120, "Write requests per minute per user (0 disables the limit)")
+	flag.IntVar(&rateLimitAddress, "rate-limit-address", 1200, "Requests per minute per address before authentication (0 disables the limit)")
+	flag.IntVar(&rateLimitAuth, "rate-limit-auth", 10, "Authentication requests per minute per address (0 disables the limit)")
+	flag.BoolVar(&rateLimitShared, "rate-limit-shared", false, "Keep rate limits in RethinkDB to share them between api instances")
+	flag.DurationVar(&readTimeout, "read-timeout", time.Second*30, "Maximum time to read a request, including the body")
+	flag.DurationVar(&writeTimeout, "write-timeout", time.Minute, "Maximum time to write a response (event streams are reopened after it)")
+	flag.DurationVar(&idleTimeout, "idle-timeout", time.Minute*2, "Close keep-alive connections that are idle for this long")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", time.Second*30, "Wait this long for in-flight requests on shutdown")
+	flag.StringVar(&tlsCert, "tls-cert", "", "TLS certificate (enables TLS; reloaded on SIGHUP)")
+	flag.StringVar(&tlsKey, "tls-key", "", "TLS private key")
+	flag.StringVar(&tlsClientCA, "tls-client-ca", "", "Require client certificates signed by these CAs")
+	flag.BoolVar(&trustProxy, "trust-proxy", false, "Use X-Forwarded-For for the client address (only behind a proxy that sets it)")
+}
+
+// getMailer returns the configured Mailer or nil if notifications are disabled
+func getMailer() (mailer.Mailer, error) {
+	switch {
+	case smtpAddress != "":
+		return mailer.NewSMTPMailer(smtpAddress, smtpUsername, smtpPassword)
+	case mailDir != "":
+		return mailer.NewFileMailer(mailDir)
+	}
+	return nil, nil
+}
+
+// getBlobStore returns the configured attachment store
+func getBlobStore() (blob.Store, error) {
+	if s3Endpoint != "" {
+		return blob.NewS3Store(s3Endpoint, s3Bucket, s3Region, s3AccessKey, s3SecretKey)
+	}
+	return blob.NewFileStore(attachmentDir)
+}
+
+// deriveKey returns a key for a single purpose derived from secret, so
+// that the secret itself is not shared between uses
+func deriveKey(secret, purpose string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func main() {
 	flag.Parse()
+	if err := loadConfig(configFile); err != nil {
+		log.Fatalf("Unable to load config: %s", err)
+	}
+	if showConfig {
+		printConfig(os.Stdout)
+		return
+	}
+	if errs := validateConfig(); len(errs) > 0 {
+		log.Fatalf("Invalid config:\n  %s", strings.Join(errs, "\n  "))
+	}
+	if logFormat == "json" {
+		log.Formatter = &logrus.JSONFormatter{}
+	}
 	log.Info("Dialogue API")
 	var (
-		sig = make(chan os.Signal)
+		sig = make(chan os.Signal, 1)
 	)
-	signal.Notify(sig, os.Interrupt)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	// init db
-	db, err := db.NewRethinkdbSession(rethinkDbAddress, rethinkDbName)
+	rethinkdb, err := db.NewRethinkdbSession(rethinkDbAddress, rethinkDbName)
 	if err != nil {
 		log.Fatalf("Unable to initialize database: %s", err)
 	}
+	metrics := newMetrics()
+	db := db.NewTimedDb(rethinkdb, metrics.ObserveDb)
 
 	// init auth
-	auth := auth.NewAuthenticator(0) // allow specifying cost?
+	auth := auth.NewAuthenticator(authCost)
+
+	// init notifications
+	var n *notifier
+	m, err := getMailer()
+	if err != nil {
+		log.Fatalf("Unable to initialize mailer: %s", err)
+	}
+	if mailDomain == "" {
+		mailDomain = mailFrom[strings.LastIndex(mailFrom, "@")+1:]
+	}
+	if mailKey == "" {
+		mailKey = deriveKey(sessionKey, "dialogue reply addresses")
+	}
+	if m != nil {
+		n = newNotifier(db, m, mailFrom, mailDomain, mailKey, baseUrl, digestInterval)
+		go n.Run()
+	} else {
+		log.Warn("No mailer configured; email notifications are disabled")
+	}
 
 	// launch api
-	api, err := NewApi(listenAddress, db, auth, sessionKey)
+	api, err := NewApi(listenAddress, db, auth, n, sessionKey)
 	if err != nil {
 		log.Fatal("Unable to spawn API server")
 	}
+	api.metrics = metrics
+	api.server.ReadTimeout = readTimeout
+	api.server.WriteTimeout = writeTimeout
+	api.server.IdleTimeout = idleTimeout
+	if tlsCert != "" || tlsKey != "" {
+		api.certs, err = newCertLoader(tlsCert, tlsKey, tlsClientCA)
+		if err != nil {
+			log.Fatalf("Unable to load TLS certificate: %s", err)
+		}
+	}
+	// attachments
+	blobs, err := getBlobStore()
+	if err != nil {
+		log.Fatalf("Unable to initialize attachment store: %s", err)
+	}
+	api.attachments = newAttachmentStore(blobs, attachmentSize, strings.Split(attachmentTypes, ","), uploadRetention)
+	// rate limits
+	var limits rateStore = newMemoryRateStore()
+	if rateLimitShared {
+		limits = db
+	}
+	api.limiter = newRateLimiter(limits, rateLimitRead, rateLimitWrite, rateLimitAuth, rateLimitAddress, trustProxy)
+	// inbound email
+	var smtpd *mailer.SMTPServer
+	if inboundAddress != "" || inboundToken != "" {
+		api.inbound = newInboundGateway(api, mailKey, inboundToken, inboundMaxSize)
+	}
+	if inboundAddress != "" {
+		smtpd = mailer.NewSMTPServer(inboundAddress, mailDomain, inboundMaxSize, api.inbound.HandleSMTP)
+		go func() {
+			log.Infof("Receiving email on %s", inboundAddress)
+			if err := smtpd.ListenAndServe(); err != nil {
+				log.Errorf("Inbound email listener stopped: %s", err)
+			}
+		}()
+	}
+	// due date reminders
+	rm := newReminder(api, m, mailFrom, reminderLead, time.Minute)
+	go rm.Run()
+	// scheduled posts
+	sc := newScheduler(api, time.Minute)
+	go sc.Run()
+	api.workers["reminder"] = rm.beat
+	api.workers["scheduler"] = sc.beat
+	if n != nil {
+		api.workers["notifier"] = n.beat
+	}
+	// trash, unused attachments and the audit log
+	p := newPurger(db, api.attachments, trashRetention, auditRetention, time.Hour)
+	go p.Run()
+	api.workers["purger"] = p.beat
 	go api.Run()
 
 	// watch for shutdown
-	for {
-		select {
-		case <-sig:
-			log.Info("Shutting down Dialogue API")
-			return
+	for s := range sig {
+		if s == syscall.SIGHUP {
+			if api.certs != nil {
+				if err := api.certs.Reload(); err != nil {
+					log.Errorf("Unable to reload TLS certificate: %s", err)
+				} else {
+					log.Info("Reloaded TLS certificate")
+				}
+			}
+			continue
+		}
+		log.Info("Shutting down Dialogue API")
+		// finish in-flight requests before stopping what they use
+		if err := api.Shutdown(shutdownTimeout); err != nil {
+			log.Errorf("Unable to finish all requests: %s", err)
+		}
+		if smtpd != nil {
+			smtpd.Close()
+		}
+		// the workers can still create posts, so the notifier is stopped
+		// after them; the database is closed once nothing uses it
+		rm.Stop()
+		sc.Stop()
+		p.Stop()
+		if n != nil {
+			n.Stop()
+		}
+		api.limiter.Wait()
+		if err := db.Close(); err != nil {
+			log.Errorf("Unable to close database: %s", err)
 		}
+		return
 	}
 }
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestDeriveKey(t *testing.T) {
+	reply := deriveKey("session secret", "dialogue reply addresses")
+	tests := []struct {
+		name  string
+		key   string
+		equal bool
+	}{
+		{"same purpose", deriveKey("session secret", "dialogue reply addresses"), true},
+		{"other purpose", deriveKey("session secret", "other"), false},
+		{"other secret", deriveKey("other secret", "dialogue reply addresses"), false},
+		{"secret itself", "session secret", false},
+	}
+	for _, test := range tests {
+		if (test.key == reply) != test.equal {
+			t.Errorf("%s: %q == %q is %v", test.name, test.key, reply, !test.equal)
+		}
+	}
+	if len(reply) != 64 {
+		t.Errorf("derived key has %d characters, want 64", len(reply))
+	}
+}
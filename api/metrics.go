@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/sessions"
+)
+
+// users that made a request within this window count as active sessions
+const activeSessionWindow = time.Minute * 15
+
+// latencyBuckets are the upper bounds of the latency histograms in seconds
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type (
+	// histogram counts observations in latencyBuckets
+	histogram struct {
+		counts []uint64
+		sum    float64
+		count  uint64
+	}
+	requestLabels struct {
+		route  string
+		method string
+		status int
+	}
+	// metrics collects the counters served in the Prometheus text format
+	// on /metrics
+	metrics struct {
+		mu       sync.Mutex
+		requests map[requestLabels]*histogram
+		dbCalls  map[string]*histogram
+		users    map[string]time.Time
+	}
+)
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	s := d.Seconds()
+	for i, b := range latencyBuckets {
+		if s <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += s
+	h.count++
+}
+
+// write writes the histogram samples for name with labels, which are
+// already formatted (i.e. `route="/topics"`)
+func (h *histogram) write(w io.Writer, name string, labels string) {
+	for i, b := range latencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(b, 'g', -1, 64), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+	fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestLabels]*histogram),
+		dbCalls:  make(map[string]*histogram),
+		users:    make(map[string]time.Time),
+	}
+}
+
+// Handler times each request and counts it by route, method and status.
+// Requests that match no route are counted with an empty route so that
+// unknown paths can't create new series.
+func (m *metrics) Handler(c martini.Context, w http.ResponseWriter, r *http.Request, session sessions.Session) {
+	start := time.Now()
+	c.Next()
+	labels := requestLabels{
+		route:  routePattern(c),
+		method: r.Method,
+		status: responseStatus(w),
+	}
+	username, _ := session.Get("username").(string)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.requests[labels]
+	if !ok {
+		h = newHistogram()
+		m.requests[labels] = h
+	}
+	h.observe(time.Since(start))
+	if username != "" {
+		m.users[username] = start
+	}
+}
+
+// ObserveDb records the duration of a db call
+func (m *metrics) ObserveDb(method string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h, ok := m.dbCalls[method]
+	if !ok {
+		h = newHistogram()
+		m.dbCalls[method] = h
+	}
+	h.observe(d)
+}
+
+// activeSessions returns the number of users seen within the
+// activeSessionWindow and forgets the others
+func (m *metrics) activeSessions(now time.Time) int {
+	for u, t := range m.users {
+		if now.Sub(t) > activeSessionWindow {
+			delete(m.users, u)
+		}
+	}
+	return len(m.users)
+}
+
+// write writes all metrics in the Prometheus text format
+func (m *metrics) write(w io.Writer, subscribers int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		requests = append(requests, l)
+	}
+	sort.Sort(byRequestLabels(requests))
+	fmt.Fprintln(w, "# HELP dialogue_http_requests_total Requests by route, method and status.")
+	fmt.Fprintln(w, "# TYPE dialogue_http_requests_total counter")
+	for _, l := range requests {
+		fmt.Fprintf(w, "dialogue_http_requests_total{%s} %d\n", l.String(), m.requests[l].count)
+	}
+	fmt.Fprintln(w, "# HELP dialogue_http_request_duration_seconds Request latency by route, method and status.")
+	fmt.Fprintln(w, "# TYPE dialogue_http_request_duration_seconds histogram")
+	for _, l := range requests {
+		m.requests[l].write(w, "dialogue_http_request_duration_seconds", l.String())
+	}
+
+	methods := make([]string, 0, len(m.dbCalls))
+	for method := range m.dbCalls {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	fmt.Fprintln(w, "# HELP dialogue_db_call_duration_seconds Database call latency by method.")
+	fmt.Fprintln(w, "# TYPE dialogue_db_call_duration_seconds histogram")
+	for _, method := range methods {
+		m.dbCalls[method].write(w, "dialogue_db_call_duration_seconds", fmt.Sprintf("method=%q", method))
+	}
+
+	fmt.Fprintln(w, "# HELP dialogue_active_sessions Users that made a request in the last 15 minutes.")
+	fmt.Fprintln(w, "# TYPE dialogue_active_sessions gauge")
+	fmt.Fprintf(w, "dialogue_active_sessions %d\n", m.activeSessions(time.Now()))
+	fmt.Fprintln(w, "# HELP dialogue_event_subscribers Open realtime event streams.")
+	fmt.Fprintln(w, "# TYPE dialogue_event_subscribers gauge")
+	fmt.Fprintf(w, "dialogue_event_subscribers %d\n", subscribers)
+}
+
+func (l requestLabels) String() string {
+	return fmt.Sprintf("route=%q,method=%q,status=\"%d\"", l.route, l.method, l.status)
+}
+
+type byRequestLabels []requestLabels
+
+func (r byRequestLabels) Len() int      { return len(r) }
+func (r byRequestLabels) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byRequestLabels) Less(i, j int) bool {
+	if r[i].route != r[j].route {
+		return r[i].route < r[j].route
+	}
+	if r[i].method != r[j].method {
+		return r[i].method < r[j].method
+	}
+	return r[i].status < r[j].status
+}
+
+// GetMetrics serves the metrics for Prometheus
+func (api *dialogueApi) GetMetrics(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	api.metrics.write(w, api.events.Count())
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram()
+	for _, d := range []time.Duration{time.Millisecond, 30 * time.Millisecond, 30 * time.Second} {
+		h.observe(d)
+	}
+	var buf bytes.Buffer
+	h.write(&buf, "latency", `route="/topics"`)
+	out := buf.String()
+	// buckets are cumulative and observations above the last bucket only
+	// count in +Inf
+	for _, line := range []string{
+		`latency_bucket{route="/topics",le="0.005"} 1`,
+		`latency_bucket{route="/topics",le="0.05"} 2`,
+		`latency_bucket{route="/topics",le="10"} 2`,
+		`latency_bucket{route="/topics",le="+Inf"} 3`,
+		`latency_sum{route="/topics"} 30.031`,
+		`latency_count{route="/topics"} 3`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, out)
+		}
+	}
+}
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics()
+	now := time.Now()
+	for _, l := range []requestLabels{
+		{"/topics", "POST", 201},
+		{"/topics", "GET", 200},
+		{"/topics", "GET", 200},
+		{"", "GET", 404},
+	} {
+		if m.requests[l] == nil {
+			m.requests[l] = newHistogram()
+		}
+		m.requests[l].observe(time.Millisecond)
+	}
+	m.ObserveDb("GetTopics", time.Millisecond)
+	m.users["alice"] = now
+	m.users["bob"] = now.Add(-activeSessionWindow - time.Second)
+
+	var buf bytes.Buffer
+	m.write(&buf, 2)
+	out := buf.String()
+	for _, line := range []string{
+		`dialogue_http_requests_total{route="",method="GET",status="404"} 1`,
+		`dialogue_http_requests_total{route="/topics",method="GET",status="200"} 2`,
+		`dialogue_http_requests_total{route="/topics",method="POST",status="201"} 1`,
+		`dialogue_db_call_duration_seconds_count{method="GetTopics"} 1`,
+		`dialogue_active_sessions 1`,
+		`dialogue_event_subscribers 2`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, out)
+		}
+	}
+	// series are sorted so that the output is stable
+	if strings.Index(out, `route="",method="GET"`) > strings.Index(out, `route="/topics",method="GET"`) {
+		t.Errorf("requests are not sorted:\n%s", out)
+	}
+	if _, ok := m.users["bob"]; ok {
+		t.Errorf("inactive user was kept")
+	}
+}
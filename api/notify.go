@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/ehazlett/dialogue/mailer"
+	"github.com/ehazlett/dialogue/markdown"
+)
+
+type (
+	// notifier delivers new posts to subscribers.  Immediate subscriptions
+	// are delivered as posts are created; hourly and daily subscriptions
+	// are delivered as digests by a background scheduler.
+	notifier struct {
+		rdb      db.Db
+		mailer   mailer.Mailer
+		from     string
+		domain   string
+		secret   string
+		baseUrl  string
+		interval time.Duration
+		beat     *heartbeat
+		stop     chan bool
+		done     chan bool
+		sends    sync.WaitGroup
+	}
+	digestTopic struct {
+		Id    string
+		Title string
+		Posts []*dialogue.Post
+	}
+	digest struct {
+		Username       string
+		Mode           string
+		Topics         []*digestTopic
+		UnsubscribeUrl string
+	}
+)
+
+var (
+	digestPeriods = map[string]time.Duration{
+		dialogue.DELIVERY_HOURLY: time.Hour,
+		dialogue.DELIVERY_DAILY:  time.Hour * 24,
+	}
+	// post content is Markdown; ids are not linked as the digest is read
+	// outside of the api
+	digestFuncs = map[string]interface{}{
+		"markdownText": func(s string) string {
+			return markdown.Text(s, markdown.Options{})
+		},
+		"markdownHTML": func(s string) htmltemplate.HTML {
+			return htmltemplate.HTML(markdown.HTML(s, markdown.Options{}))
+		},
+	}
+	digestTextTemplate = template.Must(template.New("text").Funcs(digestFuncs).Parse(`Hello {{.Username}},
+{{range .Topics}}
+{{.Title}}
+{{range .Posts}}
+  {{.Author}} ({{.Created.Format "Jan 2 15:04"}}):
+{{markdownText .Content}}
+{{end}}{{end}}
+--
+To stop receiving these emails, visit {{.UnsubscribeUrl}}
+`))
+	digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(digestFuncs).Parse(`<html>
+<body>
+<p>Hello {{.Username}},</p>
+{{range .Topics}}
+<h3>{{.Title}}</h3>
+{{range .Posts}}
+<p><strong>{{.Author}}</strong> <small>{{.Created.Format "Jan 2 15:04"}}</small></p>
+<div>{{markdownHTML .Content}}</div>
+{{end}}{{end}}
+<hr/>
+<p><small><a href="{{.UnsubscribeUrl}}">Unsubscribe</a></small></p>
+</body>
+</html>
+`))
+)
+
+func newNotifier(rdb db.Db, m mailer.Mailer, from, domain, secret, baseUrl string, interval time.Duration) *notifier {
+	return &notifier{
+		rdb:      rdb,
+		mailer:   m,
+		from:     from,
+		domain:   domain,
+		secret:   secret,
+		baseUrl:  baseUrl,
+		interval: interval,
+		beat:     newHeartbeat(interval),
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+}
+
+// Run starts the digest scheduler and blocks until Stop is called
+func (n *notifier) Run() {
+	defer close(n.done)
+	log.Infof("Delivering subscription digests every %s", n.interval)
+	t := time.NewTicker(n.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			for mode, period := range digestPeriods {
+				n.deliverDigests(mode, period)
+			}
+			n.beat.Beat(time.Now())
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run and waits for it and the deliveries started by
+// PostCreatedAsync to return
+func (n *notifier) Stop() {
+	close(n.stop)
+	<-n.done
+	n.sends.Wait()
+}
+
+// PostCreatedAsync runs PostCreated in the background
+func (n *notifier) PostCreatedAsync(post *dialogue.Post) {
+	n.sends.Add(1)
+	go func() {
+		defer n.sends.Done()
+		n.PostCreated(post)
+	}()
+}
+
+// PostCreated delivers a new post to all immediate subscribers that can
+// read it
+func (n *notifier) PostCreated(post *dialogue.Post) {
+	subs, err := n.rdb.GetSubscriptionsByMode(dialogue.DELIVERY_IMMEDIATE)
+	if err != nil {
+		log.Errorf("Error getting subscriptions: %s", err)
+		return
+	}
+	access, err := n.newAccessCheck()
+	if err != nil {
+		log.Errorf("Error getting categories: %s", err)
+		return
+	}
+	for _, sub := range subs {
+		if sub.Username == post.Author {
+			continue
+		}
+		if sub.TopicId != "" && sub.TopicId != post.TopicId {
+			continue
+		}
+		if ok, err := access.canRead(post.TopicId, sub.Username); err != nil || !ok {
+			continue
+		}
+		if err := n.deliver(sub, []*dialogue.Post{post}); err != nil {
+			log.Errorf("Error delivering post to %s: %s", sub.Username, err)
+			continue
+		}
+		sub.LastSent = post.Created
+		if err := n.rdb.UpdateSubscription(sub); err != nil {
+			log.Errorf("Error updating subscription: %s", err)
+		}
+	}
+}
+
+func (n *notifier) deliverDigests(mode string, period time.Duration) {
+	subs, err := n.rdb.GetSubscriptionsByMode(mode)
+	if err != nil {
+		log.Errorf("Error getting subscriptions: %s", err)
+		return
+	}
+	access, err := n.newAccessCheck()
+	if err != nil {
+		log.Errorf("Error getting categories: %s", err)
+		return
+	}
+	for _, sub := range subs {
+		if time.Since(sub.LastSent) < period {
+			continue
+		}
+		cutoff := time.Now()
+		res, err := n.rdb.GetPostsSince(sub.TopicId, sub.LastSent)
+		if err != nil {
+			log.Errorf("Error getting posts for digest: %s", err)
+			continue
+		}
+		var posts []*dialogue.Post
+		for _, p := range res {
+			if p.Author == sub.Username || p.Created.After(cutoff) {
+				continue
+			}
+			ok, err := access.canRead(p.TopicId, sub.Username)
+			if err != nil {
+				log.Errorf("Error checking access to topic %s: %s", p.TopicId, err)
+				continue
+			}
+			if ok {
+				posts = append(posts, p)
+			}
+		}
+		if len(posts) > 0 {
+			if err := n.deliver(sub, posts); err != nil {
+				log.Errorf("Error delivering digest to %s: %s", sub.Username, err)
+				continue
+			}
+		}
+		sub.LastSent = cutoff
+		if err := n.rdb.UpdateSubscription(sub); err != nil {
+			log.Errorf("Error updating subscription: %s", err)
+		}
+	}
+}
+
+// accessCheck caches the topics and categories needed to check that
+// subscribers can read the posts they are sent
+type accessCheck struct {
+	rdb    db.Db
+	tree   categoryTree
+	topics map[string]*dialogue.Topic
+}
+
+func (n *notifier) newAccessCheck() (*accessCheck, error) {
+	tree, err := loadCategoryTree(n.rdb)
+	if err != nil {
+		return nil, err
+	}
+	return &accessCheck{
+		rdb:    n.rdb,
+		tree:   tree,
+		topics: map[string]*dialogue.Topic{},
+	}, nil
+}
+
+// canRead returns true if username can read the topic.  Deleted topics
+// can't be read.
+func (a *accessCheck) canRead(topicId string, username string) (bool, error) {
+	topic, ok := a.topics[topicId]
+	if !ok {
+		var err error
+		if topic, err = a.rdb.GetTopic(topicId); err != nil {
+			return false, err
+		}
+		a.topics[topicId] = topic
+	}
+	return topic != nil && a.tree.canRead(topic.CategoryId, username), nil
+}
+
+func (n *notifier) deliver(sub *dialogue.Subscription, posts []*dialogue.Post) error {
+	user, err := n.rdb.GetUser(sub.Username)
+	if err != nil {
+		return err
+	}
+	if user == nil || user.Email == "" {
+		log.Debugf("Skipping delivery for %s: no email address", sub.Username)
+		return nil
+	}
+	msg, err := n.render(sub, posts)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{user.Email}
+	return n.mailer.Send(msg)
+}
+
+func (n *notifier) render(sub *dialogue.Subscription, posts []*dialogue.Post) (*mailer.Message, error) {
+	d := &digest{
+		Username:       sub.Username,
+		Mode:           sub.Mode,
+		UnsubscribeUrl: fmt.Sprintf("%s%s/unsubscribe/%s", n.baseUrl, apiVersion, sub.UnsubscribeToken),
+	}
+	// group posts by topic
+	topics := map[string]*digestTopic{}
+	for _, p := range posts {
+		t, ok := topics[p.TopicId]
+		if !ok {
+			title := p.TopicId
+			topic, err := n.rdb.GetTopic(p.TopicId)
+			if err != nil {
+				return nil, err
+			}
+			if topic != nil {
+				title = topic.Title
+			}
+			t = &digestTopic{
+				Id:    p.TopicId,
+				Title: title,
+			}
+			topics[p.TopicId] = t
+			d.Topics = append(d.Topics, t)
+		}
+		t.Posts = append(t.Posts, p)
+	}
+	var text bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, d); err != nil {
+		return nil, err
+	}
+	var html bytes.Buffer
+	if err := digestHTMLTemplate.Execute(&html, d); err != nil {
+		return nil, err
+	}
+	subject := fmt.Sprintf("[dialogue] %d new posts (%s digest)", len(posts), sub.Mode)
+	if sub.Mode == dialogue.DELIVERY_IMMEDIATE {
+		subject = fmt.Sprintf("[dialogue] New post in %s", d.Topics[0].Title)
+	}
+	msg := &mailer.Message{
+		From:    n.from,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      fmt.Sprintf("<%s>", d.UnsubscribeUrl),
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}
+	// replies can be posted when the email covers a single topic
+	if len(d.Topics) == 1 {
+		t := d.Topics[0]
+		msg.Headers["Reply-To"] = mailer.ReplyAddress(n.secret, n.domain, t.Id, sub.Username)
+		if len(posts) == 1 {
+			msg.Headers["Message-ID"] = fmt.Sprintf("<%s>", mailer.MessageId("post", posts[0].Id, n.domain))
+		}
+		msg.Headers["References"] = fmt.Sprintf("<%s>", mailer.MessageId("topic", t.Id, n.domain))
+	}
+	return msg, nil
+}
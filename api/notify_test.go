@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/mailer"
+)
+
+func newTestNotifier() (*notifier, *fakeDb) {
+	rdb := newFakeDb()
+	rdb.topics["t1"] = &dialogue.Topic{Id: "t1", Title: "Release planning"}
+	rdb.topics["t2"] = &dialogue.Topic{Id: "t2", Title: "Hi\r\nBcc: eve@example.com"}
+	n := newNotifier(rdb, nil, "dialogue@example.com", "example.com", "reply-secret", "https://dialogue.example.com", time.Minute)
+	return n, rdb
+}
+
+func TestNotifierRenderDigest(t *testing.T) {
+	n, _ := newTestNotifier()
+	created := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	posts := []*dialogue.Post{
+		{Id: "p1", TopicId: "t1", Author: "bob", Content: "first", Created: created},
+		{Id: "p2", TopicId: "t3", Author: "bob", Content: "in a deleted topic", Created: created},
+		{Id: "p3", TopicId: "t1", Author: "carol", Content: "**second**", Created: created},
+	}
+	sub := &dialogue.Subscription{Username: "alice", Mode: dialogue.DELIVERY_DAILY, UnsubscribeToken: "tok"}
+	msg, err := n.render(sub, posts)
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	if msg.Subject != "[dialogue] 3 new posts (daily digest)" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	// posts are grouped by topic in the order the topics first appear
+	text := msg.Text
+	order := []string{"Release planning", "bob (Oct 20 09:00):\nfirst", "carol (Oct 20 09:00):\nsecond", "t3", "in a deleted topic"}
+	last := -1
+	for _, s := range order {
+		i := strings.Index(text, s)
+		if i < 0 || i < last {
+			t.Errorf("%q is missing or out of order:\n%s", s, text)
+		}
+		last = i
+	}
+	if !strings.Contains(msg.HTML, "<strong>second</strong>") {
+		t.Errorf("HTML does not render the Markdown:\n%s", msg.HTML)
+	}
+	unsubscribe := "https://dialogue.example.com/v1/unsubscribe/tok"
+	if !strings.Contains(text, unsubscribe) || !strings.Contains(msg.HTML, unsubscribe) {
+		t.Errorf("unsubscribe url is missing:\n%s\n%s", text, msg.HTML)
+	}
+	if msg.Headers["List-Unsubscribe"] != "<"+unsubscribe+">" || msg.Headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("unsubscribe headers = %v", msg.Headers)
+	}
+	// replies can't be posted to a digest of several topics
+	if _, ok := msg.Headers["Reply-To"]; ok {
+		t.Errorf("digest of several topics has a Reply-To: %v", msg.Headers)
+	}
+}
+
+func TestNotifierRenderImmediate(t *testing.T) {
+	n, _ := newTestNotifier()
+	tests := []struct {
+		topicId string
+		subject string
+	}{
+		{"t1", "[dialogue] New post in Release planning"},
+		{"t2", "[dialogue] New post in Hi  Bcc: eve@example.com"},
+	}
+	for _, test := range tests {
+		post := &dialogue.Post{Id: "p1", TopicId: test.topicId, Author: "bob", Content: "hello"}
+		sub := &dialogue.Subscription{Username: "alice", Mode: dialogue.DELIVERY_IMMEDIATE, UnsubscribeToken: "tok"}
+		msg, err := n.render(sub, []*dialogue.Post{post})
+		if err != nil {
+			t.Fatalf("render: %s", err)
+		}
+		msg.To = []string{"alice@example.com"}
+		b, err := msg.Bytes()
+		if err != nil {
+			t.Fatalf("Bytes: %s", err)
+		}
+		parsed, err := mail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("unable to parse message: %s", err)
+		}
+		if got := parsed.Header.Get("Subject"); got != test.subject {
+			t.Errorf("Subject = %q, want %q", got, test.subject)
+		}
+		if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+			t.Errorf("topic title added a header: Bcc: %s", bcc)
+		}
+		topicId, ok := mailer.ParseReplyAddress("reply-secret", parsed.Header.Get("Reply-To"), "alice")
+		if !ok || topicId != test.topicId {
+			t.Errorf("Reply-To %q is not signed for alice and %s", parsed.Header.Get("Reply-To"), test.topicId)
+		}
+		if got := parsed.Header.Get("Message-ID"); got != "<post.p1@example.com>" {
+			t.Errorf("Message-ID = %q", got)
+		}
+		if got := parsed.Header.Get("References"); got != "<topic."+test.topicId+"@example.com>" {
+			t.Errorf("References = %q", got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// stickyFirst orders topics that are sticky in the current list first
+	stickyFirst struct {
+		topics   []*dialogue.Topic
+		category bool
+	}
+)
+
+func (s stickyFirst) Len() int      { return len(s.topics) }
+func (s stickyFirst) Swap(i, j int) { s.topics[i], s.topics[j] = s.topics[j], s.topics[i] }
+func (s stickyFirst) Less(i, j int) bool {
+	return s.isSticky(s.topics[i]) && !s.isSticky(s.topics[j])
+}
+
+// isSticky returns true for global sticky topics and, in category lists,
+// for topics that are sticky in their category
+func (s stickyFirst) isSticky(t *dialogue.Topic) bool {
+	return t.Sticky == dialogue.STICKY_GLOBAL || (s.category && t.Sticky == dialogue.STICKY_CATEGORY)
+}
+
+// PostPostPin pins a post to the top of its topic
+func (api *dialogueApi) PostPostPin(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	api.setPostPinned(w, params["id"], session.Get("username").(string), true, rndr)
+}
+
+func (api *dialogueApi) DeletePostPin(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	api.setPostPinned(w, params["id"], session.Get("username").(string), false, rndr)
+}
+
+func (api *dialogueApi) setPostPinned(w http.ResponseWriter, id string, username string, pinned bool, rndr render.Render) {
+	post, err := api.rdb.GetPost(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if _, ok := api.checkTopicModerate(post.TopicId, username, rndr); !ok {
+		return
+	}
+	if err := api.rdb.SetPostPinned(id, pinned, username); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// PostTopicSticky lists a topic first in its category (scope=category, the
+// default) or in all topic lists (scope=global, admin only)
+func (api *dialogueApi) PostTopicSticky(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	scope := r.FormValue("scope")
+	if scope == "" {
+		scope = dialogue.STICKY_CATEGORY
+	}
+	if scope != dialogue.STICKY_CATEGORY && scope != dialogue.STICKY_GLOBAL {
+		e := ApiError{
+			Message: fmt.Sprintf("invalid scope: %s", scope),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	api.setTopicSticky(w, params["topicId"], session.Get("username").(string), scope, rndr)
+}
+
+func (api *dialogueApi) DeleteTopicSticky(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	api.setTopicSticky(w, params["topicId"], session.Get("username").(string), "", rndr)
+}
+
+func (api *dialogueApi) setTopicSticky(w http.ResponseWriter, topicId string, username string, sticky string, rndr render.Render) {
+	topic, ok := api.checkTopicModerate(topicId, username, rndr)
+	if !ok {
+		return
+	}
+	denied := false
+	err := api.updateTopic(topic, func(t *dialogue.Topic) bool {
+		// global sticky topics are shown in every category, so only
+		// admin may add or remove them
+		if (sticky == dialogue.STICKY_GLOBAL || t.Sticky == dialogue.STICKY_GLOBAL) && !isAdmin(username) {
+			denied = true
+			return false
+		}
+		if t.Sticky == sticky {
+			return false
+		}
+		t.Sticky = sticky
+		return true
+	})
+	if denied {
+		e := ApiError{
+			Message: "only admin can change global sticky topics",
+		}
+		rndr.JSON(403, e)
+		return
+	}
+	if err != nil {
+		status := 500
+		if err == db.ErrTopicNotFound {
+			status = 404
+		}
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating topic: %s", err),
+		}
+		rndr.JSON(status, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// checkTopicModerate returns the topic if username may moderate it.
+// Otherwise an error is rendered.
+func (api *dialogueApi) checkTopicModerate(topicId string, username string, rndr render.Render) (*dialogue.Topic, bool) {
+	topic, ok := api.checkTopicAccess(topicId, username, false, rndr)
+	if !ok {
+		return nil, false
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	if !tree.canModerate(topic.CategoryId, username) {
+		e := ApiError{
+			Message: "you are not allowed to moderate this topic",
+		}
+		rndr.JSON(403, e)
+		return nil, false
+	}
+	return topic, true
+}
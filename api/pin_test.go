@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestFindTopicsSticky(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.addTopic(&dialogue.Topic{Id: "t1"})
+	rdb.addTopic(&dialogue.Topic{Id: "t2", Sticky: dialogue.STICKY_CATEGORY})
+	rdb.addTopic(&dialogue.Topic{Id: "t3"})
+	rdb.addTopic(&dialogue.Topic{Id: "t4", Sticky: dialogue.STICKY_GLOBAL})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// category sticky topics are only listed first in their category
+		{"", "t4,t1,t2,t3"},
+		{"category=" + dialogue.DEFAULT_CATEGORY, "t2,t4,t1,t3"},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		topics, err := api.findTopics("alice", query)
+		if err != nil {
+			t.Fatalf("findTopics(%q): %s", test.query, err)
+		}
+		if got := topicIds(topics); got != test.want {
+			t.Errorf("findTopics(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSetTopicSticky(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["team"] = &dialogue.Category{Id: "team", Permissions: &dialogue.Permissions{Moderate: []string{"carol"}}}
+	rdb.addTopic(&dialogue.Topic{Id: "general"})
+	rdb.addTopic(&dialogue.Topic{Id: "team", CategoryId: "team"})
+	rdb.addTopic(&dialogue.Topic{Id: "global", CategoryId: "team", Sticky: dialogue.STICKY_GLOBAL})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		topicId  string
+		username string
+		sticky   string
+		status   int
+		want     string
+	}{
+		{"general", "carol", dialogue.STICKY_CATEGORY, 403, ""},
+		{"general", "admin", dialogue.STICKY_CATEGORY, 204, dialogue.STICKY_CATEGORY},
+		{"team", "alice", dialogue.STICKY_CATEGORY, 403, ""},
+		{"team", "carol", dialogue.STICKY_CATEGORY, 204, dialogue.STICKY_CATEGORY},
+		{"team", "carol", dialogue.STICKY_GLOBAL, 403, dialogue.STICKY_CATEGORY},
+		{"team", "carol", "", 204, ""},
+		{"global", "carol", "", 403, dialogue.STICKY_GLOBAL},
+		{"global", "admin", "", 204, ""},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		api.setTopicSticky(w, test.topicId, test.username, test.sticky, rndr)
+		status := rndr.status
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.status {
+			t.Errorf("%s by %s (%q): status %d, want %d", test.topicId, test.username, test.sticky, status, test.status)
+		}
+		if got := rdb.topics[test.topicId].Sticky; got != test.want {
+			t.Errorf("%s by %s (%q): sticky %q, want %q", test.topicId, test.username, test.sticky, got, test.want)
+		}
+	}
+}
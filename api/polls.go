@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+const maxPollOptions = 20
+
+// pollFromRequest validates the poll fields in the request
+func pollFromRequest(r *http.Request) (*dialogue.Poll, error) {
+	poll := &dialogue.Poll{
+		Question:  strings.TrimSpace(r.FormValue("question")),
+		Multiple:  r.FormValue("multiple") == "true",
+		Anonymous: r.FormValue("anonymous") == "true",
+	}
+	if poll.Question == "" {
+		return nil, fmt.Errorf("question must be specified")
+	}
+	seen := map[string]bool{}
+	for _, o := range r.Form["option"] {
+		o = strings.TrimSpace(o)
+		if o == "" {
+			continue
+		}
+		if seen[o] {
+			return nil, fmt.Errorf("duplicate option: %s", o)
+		}
+		seen[o] = true
+		poll.Options = append(poll.Options, o)
+	}
+	if len(poll.Options) < 2 || len(poll.Options) > maxPollOptions {
+		return nil, fmt.Errorf("a poll must have between 2 and %d options", maxPollOptions)
+	}
+	// the close time is either absolute (closesAt) or relative (closesIn)
+	if v := r.FormValue("closesAt"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid closesAt: %s", v)
+		}
+		poll.ClosesAt = &t
+	} else if v := r.FormValue("closesIn"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid closesIn: %s", err)
+		}
+		t := time.Now().Add(d)
+		poll.ClosesAt = &t
+	}
+	if poll.ClosesAt != nil && !poll.ClosesAt.After(time.Now()) {
+		return nil, fmt.Errorf("the close time must be in the future")
+	}
+	return poll, nil
+}
+
+// parseChoices returns the option indexes voted for
+func parseChoices(poll *dialogue.Poll, values []string) ([]int, error) {
+	choices := []int{}
+	seen := map[int]bool{}
+	for _, v := range values {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 || i >= len(poll.Options) {
+			return nil, fmt.Errorf("invalid option: %s", v)
+		}
+		if !seen[i] {
+			seen[i] = true
+			choices = append(choices, i)
+		}
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("option must be specified")
+	}
+	if len(choices) > 1 && !poll.Multiple {
+		return nil, fmt.Errorf("only one option can be chosen")
+	}
+	return choices, nil
+}
+
+// publishPoll sends the current results to stream clients
+func (api *dialogueApi) publishPoll(eventType string, poll *dialogue.Poll) {
+	results := *poll
+	results.Tally("", time.Now())
+	api.publishInTopic(poll.TopicId, eventType, &results)
+}
+
+// checkPollAccess returns the poll if username may read its topic (or vote,
+// if vote is true).  Otherwise an error is rendered.
+func (api *dialogueApi) checkPollAccess(id string, username string, vote bool, rndr render.Render) (*dialogue.Poll, bool) {
+	poll, err := api.rdb.GetPoll(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting poll: %s", err),
+		}
+		rndr.JSON(500, e)
+		return nil, false
+	}
+	if poll == nil {
+		e := ApiError{
+			Message: "poll not found",
+		}
+		rndr.JSON(404, e)
+		return nil, false
+	}
+	if _, ok := api.checkTopicAccess(poll.TopicId, username, vote, rndr); !ok {
+		return nil, false
+	}
+	return poll, true
+}
+
+// PostTopicPolls creates a poll in a topic
+func (api *dialogueApi) PostTopicPolls(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	topicId := params["topicId"]
+	if _, ok := api.checkTopicAccess(topicId, username, true, rndr); !ok {
+		return
+	}
+	if !validateRequest(r, pollSchema, rndr) {
+		return
+	}
+	poll, err := pollFromRequest(r)
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	poll.TopicId = topicId
+	poll.Author = username
+	if err := api.rdb.SavePoll(poll); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error saving poll: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	api.publishPoll(dialogue.EVENT_POLL_CREATED, poll)
+	w.WriteHeader(204)
+}
+
+// GetTopicPolls returns the polls in a topic with their results
+func (api *dialogueApi) GetTopicPolls(params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	topicId := params["topicId"]
+	if _, ok := api.checkTopicAccess(topicId, username, false, rndr); !ok {
+		return
+	}
+	polls, err := api.rdb.GetPolls(topicId)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting polls: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	now := time.Now()
+	for _, p := range polls {
+		p.Tally(username, now)
+	}
+	if polls == nil {
+		polls = []*dialogue.Poll{}
+	}
+	rndr.JSON(200, polls)
+}
+
+func (api *dialogueApi) GetPoll(params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	poll, ok := api.checkPollAccess(params["id"], username, false, rndr)
+	if !ok {
+		return
+	}
+	poll.Tally(username, time.Now())
+	rndr.JSON(200, poll)
+}
+
+// PostPollVote records the user's vote, replacing an earlier one.  The
+// chosen options are given as zero based indexes with option.
+func (api *dialogueApi) PostPollVote(r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	poll, ok := api.checkPollAccess(params["id"], username, true, rndr)
+	if !ok {
+		return
+	}
+	if poll.IsClosed(time.Now()) {
+		e := ApiError{
+			Message: "poll is closed",
+		}
+		rndr.JSON(409, e)
+		return
+	}
+	if !validateRequest(r, voteSchema, rndr) {
+		return
+	}
+	choices, err := parseChoices(poll, r.Form["option"])
+	if err != nil {
+		e := ApiError{
+			Message: err.Error(),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	if err := api.rdb.SavePollVote(poll.Id, username, choices); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error saving vote: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	poll, err = api.rdb.GetPoll(poll.Id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting poll: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if poll == nil {
+		e := ApiError{
+			Message: "poll not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	api.publishPoll(dialogue.EVENT_POLL_VOTED, poll)
+	poll.Tally(username, time.Now())
+	rndr.JSON(200, poll)
+}
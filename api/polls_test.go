@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestPollFromRequest(t *testing.T) {
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	tooMany := ""
+	for i := 0; i <= maxPollOptions; i++ {
+		tooMany += fmt.Sprintf("&option=%d", i)
+	}
+	tests := []struct {
+		form    string
+		options int
+		closes  bool
+		ok      bool
+	}{
+		{"question=Lunch?&option=pizza&option=sushi", 2, false, true},
+		{"question=Lunch?&option=pizza&option=+&option=sushi", 2, false, true},
+		{"question=Lunch?&option=pizza&option=sushi&closesIn=24h", 2, true, true},
+		{"question=Lunch?&option=pizza&option=sushi&closesAt=" + url.QueryEscape(future), 2, true, true},
+		{"question=Lunch?&option=pizza&option=sushi&closesAt=" + url.QueryEscape(past), 0, false, false},
+		{"question=Lunch?&option=pizza&option=sushi&closesAt=tomorrow", 0, false, false},
+		{"question=Lunch?&option=pizza&option=sushi&closesIn=-1h", 0, false, false},
+		{"question=+&option=pizza&option=sushi", 0, false, false},
+		{"question=Lunch?&option=pizza", 0, false, false},
+		{"question=Lunch?&option=pizza&option=pizza", 0, false, false},
+		{"question=Lunch?" + tooMany, 0, false, false},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/topics/t1/polls", strings.NewReader(test.form))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		poll, err := pollFromRequest(r)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: err = %v, want ok %v", test.form, err, test.ok)
+			continue
+		}
+		if err == nil && (len(poll.Options) != test.options || (poll.ClosesAt != nil) != test.closes) {
+			t.Errorf("%s: options %v, closes at %v", test.form, poll.Options, poll.ClosesAt)
+		}
+	}
+}
+
+func TestParseChoices(t *testing.T) {
+	single := &dialogue.Poll{Options: []string{"a", "b", "c"}}
+	multiple := &dialogue.Poll{Options: []string{"a", "b", "c"}, Multiple: true}
+	tests := []struct {
+		poll   *dialogue.Poll
+		values []string
+		want   string
+		ok     bool
+	}{
+		{single, []string{"1"}, "[1]", true},
+		{single, []string{"1", "1"}, "[1]", true},
+		{single, []string{"0", "2"}, "", false},
+		{multiple, []string{"0", "2", "0"}, "[0 2]", true},
+		{multiple, []string{"3"}, "", false},
+		{multiple, []string{"-1"}, "", false},
+		{multiple, []string{"a"}, "", false},
+		{multiple, nil, "", false},
+	}
+	for _, test := range tests {
+		choices, err := parseChoices(test.poll, test.values)
+		if (err == nil) != test.ok {
+			t.Errorf("%v: err = %v, want ok %v", test.values, err, test.ok)
+			continue
+		}
+		if got := fmt.Sprint(choices); err == nil && got != test.want {
+			t.Errorf("%v: choices %s, want %s", test.values, got, test.want)
+		}
+	}
+}
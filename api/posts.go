@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+const (
+	defaultPostLimit = 50
+	maxPostLimit     = 500
+)
+
+// GetPost returns a single post.  format selects the format of the post
+// content as for GET /topics/:id/posts.
+func (api *dialogueApi) GetPost(w http.ResponseWriter, r *http.Request, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	post, err := api.rdb.GetPost(params["id"])
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if _, ok := api.checkTopicAccess(post.TopicId, username, false, rndr); !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if notModified(w, r, etag(post.Version, formatTag(format)...)) {
+		return
+	}
+	posts := []*dialogue.Post{post}
+	if !api.formatPosts(posts, format, rndr) {
+		return
+	}
+	summarizePosts(posts)
+	rndr.JSON(200, post)
+}
+
+// GetPosts returns the newest posts in the topics the user can read.
+// Posts can be filtered by author (me for the current user), by creation
+// time with since and until, and by topicId.  limit sets the number of
+// posts returned.
+func (api *dialogueApi) GetPosts(r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if !validateRequest(r, postsQuerySchema, rndr) {
+		return
+	}
+	query := r.URL.Query()
+	author := query.Get("author")
+	if author == "me" {
+		author = username
+	}
+	since := queryTime(query, "since")
+	until := queryTime(query, "until")
+	limit := defaultPostLimit
+	if v := query.Get("limit"); v != "" {
+		limit, _ = strconv.Atoi(v)
+	}
+	if limit < 1 || limit > maxPostLimit {
+		e := ApiError{
+			Message: "invalid request",
+			Details: map[string]string{"limit": fmt.Sprintf("must be between 1 and %d", maxPostLimit)},
+		}
+		rndr.JSON(422, e)
+		return
+	}
+	topics, err := api.findTopics(username, url.Values{"archived": {"all"}})
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topics: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	topicIds := []string{}
+	for _, t := range topics {
+		if id := query.Get("topicId"); id == "" || id == t.Id {
+			topicIds = append(topicIds, t.Id)
+		}
+	}
+	posts, err := api.rdb.FindPosts(topicIds, author, since, until, limit)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting posts: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if !api.formatPosts(posts, query.Get("format"), rndr) {
+		return
+	}
+	summarizePosts(posts)
+	rndr.JSON(200, posts)
+}
+
+// queryTime returns the time in the named query parameter, which has
+// already been validated
+func queryTime(query url.Values, name string) *time.Time {
+	v := query.Get(name)
+	if v == "" {
+		return nil
+	}
+	t, err := parseTime(v)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
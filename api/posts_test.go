@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+)
+
+func TestGetPost(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["private"] = &dialogue.Category{Id: "private", Permissions: &dialogue.Permissions{Read: []string{"bob"}}}
+	rdb.addTopic(&dialogue.Topic{Id: "t1"})
+	rdb.addTopic(&dialogue.Topic{Id: "t2", CategoryId: "private"})
+	rdb.posts["p1"] = &dialogue.Post{Id: "p1", TopicId: "t1", Content: "hello"}
+	rdb.posts["p2"] = &dialogue.Post{Id: "p2", TopicId: "t2", Content: "secret"}
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		id     string
+		query  string
+		status int
+	}{
+		{"p1", "", 200},
+		{"p1", "?format=markdown", 200},
+		{"p1", "?format=pdf", 400},
+		{"p2", "", 404},
+		{"missing", "", 404},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/posts/"+test.id+test.query, nil)
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		api.GetPost(w, r, martini.Params{"id": test.id}, fakeSession{username: "alice"}, rndr)
+		if rndr.status != test.status {
+			t.Errorf("%s%s: status %d, want %d", test.id, test.query, rndr.status, test.status)
+			continue
+		}
+		if test.status == 200 {
+			if post, ok := rndr.v.(*dialogue.Post); !ok || post.Id != test.id {
+				t.Errorf("%s: returned %+v", test.id, rndr.v)
+			}
+			if w.Header().Get("ETag") == "" {
+				t.Errorf("%s: no ETag", test.id)
+			}
+		}
+	}
+}
+
+func TestGetPosts(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["private"] = &dialogue.Category{Id: "private", Permissions: &dialogue.Permissions{Read: []string{"bob"}}}
+	rdb.addTopic(&dialogue.Topic{Id: "t1"})
+	rdb.addTopic(&dialogue.Topic{Id: "t2", Archived: true})
+	rdb.addTopic(&dialogue.Topic{Id: "t3", CategoryId: "private"})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		query  string
+		status int
+		topics string
+		author string
+		limit  int
+	}{
+		// archived topics are included, unreadable ones are not
+		{"", 200, "t1,t2", "", defaultPostLimit},
+		{"author=me&limit=10", 200, "t1,t2", "alice", 10},
+		{"author=bob&topicId=t2", 200, "t2", "bob", defaultPostLimit},
+		{"topicId=t3", 200, "", "", defaultPostLimit},
+		{"since=2026-10-20&until=2026-10-21T00:00:00Z", 200, "t1,t2", "", defaultPostLimit},
+		{"limit=0", 422, "", "", 0},
+		{"limit=501", 422, "", "", 0},
+		{"since=yesterday", 422, "", "", 0},
+	}
+	for _, test := range tests {
+		rdb.findPosts = nil
+		r, _ := http.NewRequest("GET", "/posts?"+test.query, nil)
+		rndr := &fakeRender{}
+		api.GetPosts(r, fakeSession{username: "alice"}, rndr)
+		if rndr.status != test.status {
+			t.Errorf("%q: status %d, want %d", test.query, rndr.status, test.status)
+			continue
+		}
+		if test.status != 200 {
+			continue
+		}
+		topics := strings.Join(rdb.findPosts[0].([]string), ",")
+		author := rdb.findPosts[1].(string)
+		limit := rdb.findPosts[4].(int)
+		if topics != test.topics || author != test.author || limit != test.limit {
+			t.Errorf("%q: FindPosts(%s, %q, %d), want (%s, %q, %d)", test.query, topics, author, limit, test.topics, test.author, test.limit)
+		}
+	}
+
+	r, _ := http.NewRequest("GET", "/posts?since=2026-10-20T09:00:00Z", nil)
+	api.GetPosts(r, fakeSession{username: "alice"}, &fakeRender{})
+	if since := rdb.findPosts[2].(*time.Time); since == nil || !since.Equal(time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("since = %v", since)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/martini-contrib/render"
+)
+
+const (
+	RATE_READ    = "read"
+	RATE_WRITE   = "write"
+	RATE_AUTH    = "auth"
+	RATE_ADDRESS = "address"
+)
+
+// buckets that have not been used for this long are full again and are
+// removed from the store
+const rateBucketIdle = time.Minute * 10
+
+type (
+	// rateStore keeps the token buckets of the rate limiter.  The
+	// database implements it to share buckets between api instances.
+	rateStore interface {
+		TakeToken(key string, capacity, rate float64, now time.Time) (bool, float64, error)
+		PurgeRateBuckets(before time.Time) (int, error)
+	}
+	// memoryRateStore keeps buckets in memory for a single api instance
+	memoryRateStore struct {
+		mu      sync.Mutex
+		buckets map[string]*dialogue.RateBucket
+	}
+	// rateLimiter limits requests with a token bucket per client and
+	// class of request.  Limits are in requests per minute; 0 disables
+	// limiting for the class.  Clients are identified by address until
+	// they are authenticated, and by user after.
+	rateLimiter struct {
+		store      rateStore
+		limits     map[string]int
+		trustProxy bool
+		mu         sync.Mutex
+		lastPurge  time.Time
+		purges     sync.WaitGroup
+	}
+)
+
+func newMemoryRateStore() *memoryRateStore {
+	return &memoryRateStore{
+		buckets: make(map[string]*dialogue.RateBucket),
+	}
+}
+
+func (s *memoryRateStore) TakeToken(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &dialogue.RateBucket{
+			Key:     key,
+			Tokens:  capacity,
+			Updated: now,
+		}
+		s.buckets[key] = b
+	}
+	taken := b.Take(capacity, rate, now)
+	return taken, b.Tokens, nil
+}
+
+func (s *memoryRateStore) PurgeRateBuckets(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for k, b := range s.buckets {
+		if b.Updated.Before(before) {
+			delete(s.buckets, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func newRateLimiter(store rateStore, read, write, auth, address int, trustProxy bool) *rateLimiter {
+	return &rateLimiter{
+		store: store,
+		limits: map[string]int{
+			RATE_READ:    read,
+			RATE_WRITE:   write,
+			RATE_AUTH:    auth,
+			RATE_ADDRESS: address,
+		},
+		trustProxy: trustProxy,
+		lastPurge:  time.Now(),
+	}
+}
+
+// rateClass returns the class of a request, which have separate limits
+func rateClass(r *http.Request) string {
+	switch {
+	case r.Method == "POST" && (r.URL.Path == "/auth" || r.URL.Path == apiVersion+"/auth"):
+		return RATE_AUTH
+	case r.Method == "GET" || r.Method == "HEAD":
+		return RATE_READ
+	}
+	return RATE_WRITE
+}
+
+// clientIP returns the address of the client.  X-Forwarded-For is only
+// used behind a trusted proxy, since clients can set it to anything.
+func (l *rateLimiter) clientIP(r *http.Request) string {
+	if l.trustProxy {
+		if f := r.Header.Get("X-Forwarded-For"); f != "" {
+			return strings.TrimSpace(strings.Split(f, ",")[0])
+		}
+	}
+	return remoteHost(r)
+}
+
+// Limit limits requests by client address before they are authenticated.
+// Authentication has its own, lower limit so that guessing passwords is
+// slowed down as well.  Credentials can't be trusted at this point, so
+// authenticated clients are limited by LimitUser once they are verified.
+func (l *rateLimiter) Limit(w http.ResponseWriter, r *http.Request, rndr render.Render) {
+	class := RATE_ADDRESS
+	if rateClass(r) == RATE_AUTH {
+		class = RATE_AUTH
+	}
+	l.take(w, class, "ip:"+l.clientIP(r), rndr)
+}
+
+// LimitUser limits the requests of an authenticated user.  It returns false
+// if the user is over the limit and a 429 has been rendered.
+func (l *rateLimiter) LimitUser(w http.ResponseWriter, r *http.Request, username string, rndr render.Render) bool {
+	class := rateClass(r)
+	if class == RATE_AUTH {
+		return true
+	}
+	return l.take(w, class, "user:"+username, rndr)
+}
+
+// take takes a token from the bucket of the client for a class of requests
+// and responds with 429 if there are none left.  The X-RateLimit headers
+// report the limit, the requests left and the seconds until the bucket is
+// full again.
+func (l *rateLimiter) take(w http.ResponseWriter, class string, client string, rndr render.Render) bool {
+	limit := l.limits[class]
+	if limit <= 0 {
+		return true
+	}
+	now := time.Now()
+	l.purge(now)
+	capacity := float64(limit)
+	rate := capacity / 60
+	ok, tokens, err := l.store.TakeToken(class+":"+client, capacity, rate, now)
+	if err == db.ErrRateBucketBusy {
+		// other requests are updating the bucket, so it is not worth
+		// rejecting this one over it
+		log.Debugf("Rate limit bucket for %s is busy", client)
+		return true
+	}
+	if err != nil {
+		// don't turn a database problem into an outage
+		log.Errorf("Unable to check rate limit: %s", err)
+		return true
+	}
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(int(tokens)))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil((capacity-tokens)/rate))))
+	if !ok {
+		h.Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/rate))))
+		e := ApiError{
+			Message: "rate limit exceeded; try again later",
+		}
+		rndr.JSON(429, e)
+	}
+	return ok
+}
+
+// Wait waits for bucket purges that are running in the background
+func (l *rateLimiter) Wait() {
+	l.purges.Wait()
+}
+
+// purge removes idle buckets from the store every few minutes
+func (l *rateLimiter) purge(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastPurge) < rateBucketIdle {
+		return
+	}
+	l.lastPurge = now
+	l.purges.Add(1)
+	go func() {
+		defer l.purges.Done()
+		if _, err := l.store.PurgeRateBuckets(now.Add(-rateBucketIdle)); err != nil {
+			log.Errorf("Unable to purge rate limit buckets: %s", err)
+		}
+	}()
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue/db"
+)
+
+func TestMemoryRateStore(t *testing.T) {
+	s := newMemoryRateStore()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		key    string
+		at     time.Duration
+		ok     bool
+		tokens float64
+	}{
+		{"a", 0, true, 1},
+		{"a", 0, true, 0},
+		{"a", 0, false, 0},
+		{"b", 0, true, 1},
+		{"a", time.Second, true, 0},
+		{"a", time.Minute, true, 1},
+	}
+	for i, test := range tests {
+		ok, tokens, err := s.TakeToken(test.key, 2, 1, now.Add(test.at))
+		if err != nil || ok != test.ok || tokens != test.tokens {
+			t.Errorf("%d: TakeToken(%q) = %v, %v, %v, want %v, %v", i, test.key, ok, tokens, err, test.ok, test.tokens)
+		}
+	}
+	n, err := s.PurgeRateBuckets(now.Add(30 * time.Second))
+	if err != nil || n != 1 {
+		t.Errorf("PurgeRateBuckets = %d, %v, want 1", n, err)
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	l := newRateLimiter(newMemoryRateStore(), 0, 2, 0, 0, false)
+	for i, want := range []bool{true, true, false} {
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		if ok := l.take(w, RATE_WRITE, "user:alice", rndr); ok != want {
+			t.Fatalf("%d: take = %v, want %v", i, ok, want)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "2" {
+			t.Errorf("%d: X-RateLimit-Limit = %q", i, w.Header().Get("X-RateLimit-Limit"))
+		}
+		if want {
+			continue
+		}
+		if rndr.status != 429 {
+			t.Errorf("over the limit rendered %d, want 429", rndr.status)
+		}
+		if w.Header().Get("X-RateLimit-Remaining") != "0" || w.Header().Get("Retry-After") != "30" {
+			t.Errorf("over the limit headers = %v", w.Header())
+		}
+	}
+	// a limit of 0 disables limiting
+	w := httptest.NewRecorder()
+	if !l.take(w, RATE_READ, "user:alice", &fakeRender{}) || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("unlimited class was limited")
+	}
+}
+
+// Limiters of several api instances share buckets through their store, so
+// clients get the same number of requests however they are balanced.
+func TestRateLimiterSharedStore(t *testing.T) {
+	const limit = 20
+	store := newMemoryRateStore()
+	limiters := []*rateLimiter{
+		newRateLimiter(store, 0, limit, 0, 0, false),
+		newRateLimiter(store, 0, limit, 0, 0, false),
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < limit*3; i++ {
+		wg.Add(1)
+		go func(l *rateLimiter) {
+			defer wg.Done()
+			if l.take(httptest.NewRecorder(), RATE_WRITE, "user:alice", &fakeRender{}) {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}(limiters[i%len(limiters)])
+	}
+	wg.Wait()
+	if allowed != limit {
+		t.Errorf("%d requests allowed, want %d", allowed, limit)
+	}
+}
+
+func TestRateClass(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		class  string
+	}{
+		{"GET", "/topics", RATE_READ},
+		{"HEAD", "/topics", RATE_READ},
+		{"POST", "/topics", RATE_WRITE},
+		{"DELETE", "/topics/1", RATE_WRITE},
+		{"POST", "/auth", RATE_AUTH},
+		{"POST", apiVersion + "/auth", RATE_AUTH},
+		{"GET", "/auth", RATE_READ},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest(test.method, test.path, nil)
+		if class := rateClass(r); class != test.class {
+			t.Errorf("rateClass(%s %s) = %q, want %q", test.method, test.path, class, test.class)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		trustProxy bool
+		forwarded  string
+		ip         string
+	}{
+		{false, "", "192.0.2.1"},
+		{false, "203.0.113.7", "192.0.2.1"},
+		{true, "", "192.0.2.1"},
+		{true, "203.0.113.7, 10.0.0.1", "203.0.113.7"},
+	}
+	for _, test := range tests {
+		l := newRateLimiter(newMemoryRateStore(), 0, 0, 0, 0, test.trustProxy)
+		r := &http.Request{RemoteAddr: "192.0.2.1:51234", Header: http.Header{}}
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if ip := l.clientIP(r); ip != test.ip {
+			t.Errorf("clientIP(trust %v, %q) = %q, want %q", test.trustProxy, test.forwarded, ip, test.ip)
+		}
+	}
+}
+
+// busyRateStore fails like a bucket that kept changing while it was updated
+type busyRateStore struct{}
+
+func (busyRateStore) TakeToken(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	return false, 0, db.ErrRateBucketBusy
+}
+
+func (busyRateStore) PurgeRateBuckets(before time.Time) (int, error) {
+	return 0, nil
+}
+
+func TestRateLimiterBusyBucket(t *testing.T) {
+	l := newRateLimiter(busyRateStore{}, 0, 1, 0, 0, false)
+	rndr := &fakeRender{}
+	if !l.take(httptest.NewRecorder(), RATE_WRITE, "user:alice", rndr) || rndr.status != 0 {
+		t.Errorf("request was rejected (%d) because its bucket was busy", rndr.status)
+	}
+	l.Wait()
+}
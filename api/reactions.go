@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+const maxReactionLength = 32
+
+// reactionName normalizes a reaction name, accepting emoji as well as
+// names such as "+1" or ":ack:".  It returns "" for invalid names.
+func reactionName(name string) string {
+	name = strings.Trim(strings.TrimSpace(name), ":")
+	if name == "" || utf8.RuneCountInString(name) > maxReactionLength {
+		return ""
+	}
+	for _, r := range name {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`/\?#%:"'<>`, r) {
+			return ""
+		}
+	}
+	return name
+}
+
+// summarizePosts fills in the reaction summaries of posts
+func summarizePosts(posts []*dialogue.Post) {
+	for _, p := range posts {
+		p.SummarizeReactions()
+	}
+}
+
+func (api *dialogueApi) PostReaction(params martini.Params, session sessions.Session, rndr render.Render) {
+	api.react(params, session, true, rndr)
+}
+
+func (api *dialogueApi) DeleteReaction(params martini.Params, session sessions.Session, rndr render.Render) {
+	api.react(params, session, false, rndr)
+}
+
+// react adds or removes a reaction and returns the updated reaction
+func (api *dialogueApi) react(params martini.Params, session sessions.Session, add bool, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	name := reactionName(params["name"])
+	if name == "" {
+		e := ApiError{
+			Message: fmt.Sprintf("invalid reaction: %s", params["name"]),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	post, err := api.rdb.GetPost(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if _, ok := api.checkTopicAccess(post.TopicId, username, true, rndr); !ok {
+		return
+	}
+	eventType := dialogue.EVENT_REACTION_ADDED
+	if add {
+		post, err = api.rdb.AddReaction(id, name, username)
+	} else {
+		eventType = dialogue.EVENT_REACTION_REMOVED
+		post, err = api.rdb.RemoveReaction(id, name, username)
+	}
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error updating reaction: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	users := post.ReactionUsers[name]
+	if users == nil {
+		users = []string{}
+	}
+	reaction := &dialogue.Reaction{
+		Name:  name,
+		Count: len(users),
+		Users: users,
+	}
+	api.publishInTopic(post.TopicId, eventType, &dialogue.ReactionEvent{
+		PostId:   post.Id,
+		TopicId:  post.TopicId,
+		Name:     name,
+		Username: username,
+		Count:    reaction.Count,
+	})
+	rndr.JSON(200, reaction)
+}
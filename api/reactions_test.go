@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestReactionName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"+1", "+1"},
+		{":ack:", "ack"},
+		{" heart ", "heart"},
+		{"❤️", "❤️"},
+		{"", ""},
+		{"::", ""},
+		{"thumbs up", ""},
+		{"a/b", ""},
+		{"a%2Fb", ""},
+		{"a:b", ""},
+		{"<b>", ""},
+		{"x\ty", ""},
+		{"abcdefghijklmnopqrstuvwxyz012345", "abcdefghijklmnopqrstuvwxyz012345"},
+		{"abcdefghijklmnopqrstuvwxyz0123456", ""},
+	}
+	for _, test := range tests {
+		if got := reactionName(test.name); got != test.want {
+			t.Errorf("reactionName(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/mailer"
+)
+
+type (
+	// reminder notifies assignees of topics that are due soon or overdue
+	reminder struct {
+		api      *dialogueApi
+		mailer   mailer.Mailer
+		from     string
+		lead     time.Duration
+		interval time.Duration
+		beat     *heartbeat
+		stop     chan bool
+		done     chan bool
+	}
+)
+
+func newReminder(api *dialogueApi, m mailer.Mailer, from string, lead time.Duration, interval time.Duration) *reminder {
+	return &reminder{
+		api:      api,
+		mailer:   m,
+		from:     from,
+		lead:     lead,
+		interval: interval,
+		beat:     newHeartbeat(interval),
+		stop:     make(chan bool),
+		done:     make(chan bool),
+	}
+}
+
+// Run checks for due topics every interval until Stop is called
+func (rm *reminder) Run() {
+	defer close(rm.done)
+	t := time.NewTicker(rm.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			rm.check(time.Now())
+			rm.beat.Beat(time.Now())
+		case <-rm.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run and waits for it to return
+func (rm *reminder) Stop() {
+	close(rm.stop)
+	<-rm.done
+}
+
+func (rm *reminder) check(now time.Time) {
+	topics, err := rm.api.rdb.GetTopics()
+	if err != nil {
+		log.Errorf("Error getting topics for reminders: %s", err)
+		return
+	}
+	for _, t := range topics {
+		if t.Closed || t.Archived || t.Due == nil || len(t.Assignees) == 0 {
+			continue
+		}
+		var message string
+		var overdue bool
+		switch {
+		case t.IsOverdue(now) && !t.OverdueReminderSent:
+			message = fmt.Sprintf("%s is overdue (due %s)", t.Title, t.Due.Format("Jan 2 15:04"))
+			overdue = true
+		case !t.IsOverdue(now) && t.Due.Sub(now) <= rm.lead && !t.DueReminderSent:
+			message = fmt.Sprintf("%s is due %s", t.Title, t.Due.Format("Jan 2 15:04"))
+		default:
+			continue
+		}
+		// claim the reminder first so that it is sent once, even with
+		// several api replicas
+		claimed, err := rm.api.rdb.ClaimTopicReminder(t.Id, overdue)
+		if err != nil {
+			log.Errorf("Error claiming topic reminder: %s", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		for _, username := range t.Assignees {
+			rm.notify(username, t, message)
+		}
+	}
+}
+
+func (rm *reminder) notify(username string, topic *dialogue.Topic, message string) {
+	entry := &dialogue.InboxEntry{
+		Username: username,
+		Kind:     dialogue.INBOX_REMINDER,
+		TopicId:  topic.Id,
+		Message:  message,
+	}
+	if err := rm.api.rdb.SaveInboxEntry(entry); err != nil {
+		log.Errorf("Error saving reminder for %s: %s", username, err)
+		return
+	}
+	rm.api.events.Publish(username, dialogue.EVENT_INBOX_CREATED, entry)
+	if rm.mailer == nil {
+		return
+	}
+	user, err := rm.api.rdb.GetUser(username)
+	if err != nil {
+		log.Errorf("Error getting user for reminder: %s", err)
+		return
+	}
+	if user == nil || user.Email == "" {
+		return
+	}
+	msg := &mailer.Message{
+		From:    rm.from,
+		To:      []string{user.Email},
+		Subject: fmt.Sprintf("[dialogue] Reminder: %s", message),
+		Text:    fmt.Sprintf("Hello %s,\n\n%s.\n", username, message),
+	}
+	if err := rm.mailer.Send(msg); err != nil {
+		log.Errorf("Error sending reminder to %s: %s", username, err)
+	}
+}
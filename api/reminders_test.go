@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"net/mail"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/mailer"
+)
+
+// fakeMailer keeps sent messages
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []*mailer.Message
+}
+
+func (m *fakeMailer) Send(msg *mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestReminderCheck(t *testing.T) {
+	now := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	due := now.Add(time.Hour)
+	later := now.Add(time.Hour * 48)
+	rdb := newFakeDb()
+	rdb.users["alice"] = &dialogue.User{Username: "alice", Email: "alice@example.com"}
+	rdb.addTopic(&dialogue.Topic{Id: "t1", Title: "Ship it\r\nBcc: eve@example.com", Due: &due, Assignees: []string{"alice", "bob"}})
+	rdb.addTopic(&dialogue.Topic{Id: "t2", Title: "Closed", Due: &due, Assignees: []string{"alice"}, Closed: true})
+	rdb.addTopic(&dialogue.Topic{Id: "t3", Title: "Later", Due: &later, Assignees: []string{"alice"}})
+	m := &fakeMailer{}
+	rm := newReminder(&dialogueApi{rdb: rdb, events: newEventHub()}, m, "dialogue@example.com", time.Hour*24, time.Minute)
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		inbox   int
+		sent    int
+		subject string
+	}{
+		{"due soon", now, 2, 1, "[dialogue] Reminder: Ship it  Bcc: eve@example.com is due Oct 20 10:00"},
+		{"already reminded", now.Add(time.Minute), 2, 1, ""},
+		{"overdue", now.Add(time.Hour * 2), 4, 2, "[dialogue] Reminder: Ship it  Bcc: eve@example.com is overdue (due Oct 20 10:00)"},
+		{"already overdue", now.Add(time.Hour * 3), 4, 2, ""},
+	}
+	for _, test := range tests {
+		rm.check(test.now)
+		// bob has no email address, so only the inbox entry is created
+		if len(rdb.inbox) != test.inbox || len(m.sent) != test.sent {
+			t.Fatalf("%s: %d inbox entries and %d emails, want %d and %d", test.name, len(rdb.inbox), len(m.sent), test.inbox, test.sent)
+		}
+		if test.subject == "" {
+			continue
+		}
+		b, err := m.sent[len(m.sent)-1].Bytes()
+		if err != nil {
+			t.Fatalf("%s: Bytes: %s", test.name, err)
+		}
+		parsed, err := mail.ReadMessage(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: unable to parse message: %s", test.name, err)
+		}
+		if got := parsed.Header.Get("Subject"); got != test.subject {
+			t.Errorf("%s: Subject = %q, want %q", test.name, got, test.subject)
+		}
+		if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+			t.Errorf("%s: topic title added a header: Bcc: %s", test.name, bcc)
+		}
+	}
+}
+
+func TestReminderStop(t *testing.T) {
+	rdb := newFakeDb()
+	rm := newReminder(&dialogueApi{rdb: rdb, events: newEventHub()}, &fakeMailer{}, "dialogue@example.com", time.Hour, time.Millisecond)
+	returned := make(chan bool)
+	go func() {
+		rm.Run()
+		close(returned)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	rm.Stop()
+	// Stop waits for Run, so nothing uses the database afterwards
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return")
+	}
+}
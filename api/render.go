@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/markdown"
+	"github.com/martini-contrib/render"
+)
+
+const (
+	// renderVersion is included in the cache key for rendered posts; bump
+	// it when the renderer output changes to re-render cached posts
+	renderVersion = "2"
+
+	// maxRefs limits the topic and post ids looked up for one post
+	maxRefs = 20
+
+	formatMarkdown = "markdown"
+	formatHTML     = "html"
+	formatText     = "text"
+)
+
+// contentHash identifies post content for the rendered HTML cache
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(renderVersion + "\x00" + content))
+	return hex.EncodeToString(sum[:])
+}
+
+// formatTag returns the entity tag suffix for a post format, so that the
+// formats of a post are cached separately
+func formatTag(format string) []string {
+	switch format {
+	case "", formatMarkdown:
+		return nil
+	case formatHTML:
+		return []string{formatHTML + renderVersion}
+	}
+	return []string{format}
+}
+
+// renderOptions links topic and post ids in topics that author can read
+// and expands mentions of known users
+func (api *dialogueApi) renderOptions(author string, mentions []string) markdown.Options {
+	known := map[string]bool{}
+	for _, m := range mentions {
+		known[m] = true
+	}
+	var tree categoryTree
+	refs := map[string]string{}
+	return markdown.Options{
+		Ref: func(id string) string {
+			if href, ok := refs[id]; ok {
+				return href
+			}
+			if len(refs) >= maxRefs {
+				return ""
+			}
+			href, err := api.resolveRef(id, author, &tree)
+			if err != nil {
+				log.Errorf("Error resolving reference %s: %s", id, err)
+			}
+			refs[id] = href
+			return href
+		},
+		Mention: func(username string) bool {
+			return known[username]
+		},
+	}
+}
+
+// resolveRef returns the url for a topic or post id, or "" if it doesn't
+// exist or is in a topic that username can't read.  The category tree is
+// loaded the first time it is needed.
+func (api *dialogueApi) resolveRef(id string, username string, tree *categoryTree) (string, error) {
+	href := "/topics/" + id
+	topic, err := api.rdb.GetTopic(id)
+	if err != nil {
+		return "", err
+	}
+	if topic == nil {
+		post, err := api.rdb.GetPost(id)
+		if err != nil || post == nil {
+			return "", err
+		}
+		if topic, err = api.rdb.GetTopic(post.TopicId); err != nil || topic == nil {
+			return "", err
+		}
+		href = "/topics/" + post.TopicId + "#" + post.Id
+	}
+	if *tree == nil {
+		if *tree, err = loadCategoryTree(api.rdb); err != nil {
+			return "", err
+		}
+	}
+	if !tree.canRead(topic.CategoryId, username) {
+		return "", nil
+	}
+	return href, nil
+}
+
+// renderPost renders the post content to HTML and updates the cache
+// fields.  It returns false if the cached HTML was already current.
+func (api *dialogueApi) renderPost(post *dialogue.Post) bool {
+	hash := contentHash(post.Content)
+	if post.HtmlHash == hash {
+		return false
+	}
+	post.Html = markdown.HTML(post.Content, api.renderOptions(post.Author, post.Mentions))
+	post.HtmlHash = hash
+	return true
+}
+
+// formatPosts replaces the content of posts with the requested format.
+// HTML is served from the cache, which is refreshed for posts whose
+// content has changed since they were rendered.
+func (api *dialogueApi) formatPosts(posts []*dialogue.Post, format string, rndr render.Render) bool {
+	switch format {
+	case "", formatMarkdown:
+	case formatHTML:
+		for _, p := range posts {
+			if api.renderPost(p) {
+				if err := api.rdb.UpdatePostHtml(p.Id, p.Html, p.HtmlHash); err != nil {
+					log.Errorf("Error caching rendered post %s: %s", p.Id, err)
+				}
+			}
+			p.Content = p.Html
+		}
+	case formatText:
+		for _, p := range posts {
+			p.Content = markdown.Text(p.Content, markdown.Options{})
+		}
+	default:
+		e := ApiError{
+			Message: fmt.Sprintf("unknown format: %s", format),
+		}
+		rndr.JSON(400, e)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-martini/martini"
+)
+
+const apiVersion = "/v1"
+
+// apiRoutes registers each route under the api version prefix and at its
+// original, unversioned path.  The unversioned paths are deprecated and
+// point clients to the versioned path.
+type apiRoutes struct {
+	router martini.Router
+}
+
+func (rt apiRoutes) Get(path string, h ...martini.Handler) {
+	rt.router.Get(apiVersion+path, h...)
+	rt.router.Get(path, deprecated(h)...)
+}
+
+func (rt apiRoutes) Post(path string, h ...martini.Handler) {
+	rt.router.Post(apiVersion+path, h...)
+	rt.router.Post(path, deprecated(h)...)
+}
+
+func (rt apiRoutes) Put(path string, h ...martini.Handler) {
+	rt.router.Put(apiVersion+path, h...)
+	rt.router.Put(path, deprecated(h)...)
+}
+
+func (rt apiRoutes) Delete(path string, h ...martini.Handler) {
+	rt.router.Delete(apiVersion+path, h...)
+	rt.router.Delete(path, deprecated(h)...)
+}
+
+func deprecated(h []martini.Handler) []martini.Handler {
+	return append([]martini.Handler{deprecatedRoute}, h...)
+}
+
+func deprecatedRoute(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", apiVersion, r.URL.Path))
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+// PostSearch searches topic titles and post content.  The query is
+// specified with q; label and labelMode restrict results as for GET /topics
+// and format selects the format of post content as for GET /topics/:id.
+func (api *dialogueApi) PostSearch(r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if !validateRequest(r, searchSchema, rndr) {
+		return
+	}
+	query := r.FormValue("q")
+	res, err := api.rdb.Search(query, r.Form["label"], r.FormValue("labelMode") != "or")
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error searching: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	// only return results from categories the user can read; archived
+	// topics remain searchable
+	topics, err := api.findTopics(username, url.Values{"archived": {"all"}})
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error searching: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	readable := map[string]bool{}
+	for _, t := range topics {
+		readable[t.Id] = true
+	}
+	result := &dialogue.SearchResult{
+		Topics: []*dialogue.Topic{},
+		Posts:  []*dialogue.Post{},
+	}
+	for _, t := range res.Topics {
+		if readable[t.Id] {
+			result.Topics = append(result.Topics, t)
+		}
+	}
+	for _, p := range res.Posts {
+		if readable[p.TopicId] {
+			result.Posts = append(result.Posts, p)
+		}
+	}
+	if !api.formatPosts(result.Posts, r.FormValue("format"), rndr) {
+		return
+	}
+	summarizePosts(result.Posts)
+	rndr.JSON(200, result)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+func (api *dialogueApi) GetSubscriptions(session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	subs, err := api.rdb.GetSubscriptions(username)
+	if err != nil {
+		e := ApiError{
+			Message: "Error getting subscriptions",
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	rndr.JSON(200, subs)
+}
+
+func (api *dialogueApi) PostSubscriptions(w http.ResponseWriter, r *http.Request, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	if !validateRequest(r, subscriptionSchema, rndr) {
+		return
+	}
+	topicId := r.FormValue("topicId")
+	mode := r.FormValue("mode")
+	if mode == "" {
+		mode = dialogue.DELIVERY_DAILY
+	}
+	if topicId != "" {
+		if _, ok := api.checkTopicAccess(topicId, username, false, rndr); !ok {
+			return
+		}
+	}
+	subs, err := api.rdb.GetSubscriptions(username)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting subscriptions: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	// change the delivery mode of an existing subscription
+	for _, sub := range subs {
+		if sub.TopicId == topicId {
+			sub.Mode = mode
+			if err := api.rdb.UpdateSubscription(sub); err != nil {
+				e := ApiError{
+					Message: fmt.Sprintf("Error updating subscription: %s", err),
+				}
+				rndr.JSON(500, e)
+				return
+			}
+			w.WriteHeader(204)
+			return
+		}
+	}
+	sub := &dialogue.Subscription{
+		Username:         username,
+		TopicId:          topicId,
+		Mode:             mode,
+		UnsubscribeToken: api.auth.GenerateToken(),
+	}
+	if err := api.rdb.SaveSubscription(sub); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error saving subscription: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) DeleteSubscription(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	sub, err := api.rdb.GetSubscription(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting subscription: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if sub == nil || sub.Username != username {
+		e := ApiError{
+			Message: "subscription not found",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if err := api.rdb.DeleteSubscription(id); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error deleting subscription: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// unsubscribePage is shown to people following the unsubscribe link of a
+// notification email.  Confirm adds a form that posts back to the link.
+var unsubscribePage = template.Must(template.New("unsubscribe").Parse(`<html>
+<body>
+<p>{{.Message}}</p>
+{{if .Confirm}}<form method="post">
+<button type="submit">Unsubscribe</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+func writeUnsubscribePage(w http.ResponseWriter, status int, message string, confirm bool) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	unsubscribePage.Execute(w, struct {
+		Message string
+		Confirm bool
+	}{message, confirm})
+}
+
+// GetUnsubscribe asks to confirm removing the subscription for the token
+// included in notification emails.  Mail scanners and prefetchers follow
+// links, so the subscription is only removed by PostUnsubscribe.  It does
+// not require authentication.
+func (api *dialogueApi) GetUnsubscribe(w http.ResponseWriter, params martini.Params) {
+	sub, err := api.rdb.GetSubscriptionByToken(params["token"])
+	if err != nil {
+		log.Errorf("Error getting subscription: %s", err)
+		writeUnsubscribePage(w, 500, "Error getting the subscription; please try again later.", false)
+		return
+	}
+	if sub == nil {
+		writeUnsubscribePage(w, 404, "This subscription was not found.  You may have unsubscribed already.", false)
+		return
+	}
+	message := "Stop receiving emails about new posts in all topics?"
+	if sub.TopicId != "" {
+		topic, err := api.rdb.GetTopic(sub.TopicId)
+		if err != nil {
+			log.Errorf("Error getting topic: %s", err)
+			writeUnsubscribePage(w, 500, "Error getting the subscription; please try again later.", false)
+			return
+		}
+		message = "Stop receiving emails about new posts in this topic?"
+		if topic != nil {
+			message = fmt.Sprintf("Stop receiving emails about new posts in \"%s\"?", topic.Title)
+		}
+	}
+	writeUnsubscribePage(w, 200, message, true)
+}
+
+// PostUnsubscribe removes the subscription for the token included in
+// notification emails, either from the confirmation page or by a mail
+// client's one-click unsubscribe (RFC 8058).  It does not require
+// authentication.
+func (api *dialogueApi) PostUnsubscribe(w http.ResponseWriter, params martini.Params) {
+	sub, err := api.rdb.GetSubscriptionByToken(params["token"])
+	if err != nil {
+		log.Errorf("Error getting subscription: %s", err)
+		writeUnsubscribePage(w, 500, "Error getting the subscription; please try again later.", false)
+		return
+	}
+	if sub == nil {
+		writeUnsubscribePage(w, 404, "This subscription was not found.  You may have unsubscribed already.", false)
+		return
+	}
+	if err := api.rdb.DeleteSubscription(sub.Id); err != nil {
+		log.Errorf("Error deleting subscription: %s", err)
+		writeUnsubscribePage(w, 500, "Error removing the subscription; please try again later.", false)
+		return
+	}
+	writeUnsubscribePage(w, 200, "You have been unsubscribed.", false)
+}
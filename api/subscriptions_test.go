@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.topics["t1"] = &dialogue.Topic{Id: "t1", Title: "Release <planning>"}
+	rdb.subs["s1"] = &dialogue.Subscription{Id: "s1", TopicId: "t1", UnsubscribeToken: "token"}
+	api := &dialogueApi{rdb: rdb}
+	params := martini.Params{"token": "token"}
+
+	// following the link only asks to confirm
+	w := httptest.NewRecorder()
+	api.GetUnsubscribe(w, params)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `<form method="post">`) {
+		t.Fatalf("GET returned %d:\n%s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "Release &lt;planning&gt;") {
+		t.Errorf("confirmation does not name the escaped topic:\n%s", w.Body)
+	}
+	if _, ok := rdb.subs["s1"]; !ok {
+		t.Fatalf("GET removed the subscription")
+	}
+
+	w = httptest.NewRecorder()
+	api.PostUnsubscribe(w, params)
+	if w.Code != 200 || strings.Contains(w.Body.String(), "<form") {
+		t.Errorf("POST returned %d:\n%s", w.Code, w.Body)
+	}
+	if _, ok := rdb.subs["s1"]; ok {
+		t.Errorf("POST did not remove the subscription")
+	}
+
+	for _, get := range []bool{true, false} {
+		w = httptest.NewRecorder()
+		if get {
+			api.GetUnsubscribe(w, params)
+		} else {
+			api.PostUnsubscribe(w, params)
+		}
+		if w.Code != 404 {
+			t.Errorf("unknown token (GET %v) returned %d, want 404", get, w.Code)
+		}
+	}
+}
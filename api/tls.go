@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+type (
+	// certLoader holds the server certificate and the CAs for client
+	// certificates.  They are read again on Reload, so certificates can
+	// be renewed without a restart.
+	certLoader struct {
+		certFile string
+		keyFile  string
+		caFile   string
+		mu       sync.RWMutex
+		config   *tls.Config
+	}
+)
+
+func newCertLoader(certFile, keyFile, caFile string) (*certLoader, error) {
+	l := &certLoader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads the certificate, key and client CAs.  The current ones
+// are kept if they can't be read.
+func (l *certLoader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	// clients must present a certificate signed by one of the CAs
+	if l.caFile != "" {
+		pem, err := ioutil.ReadFile(l.caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in " + l.caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	l.mu.Lock()
+	l.config = config
+	l.mu.Unlock()
+	return nil
+}
+
+// Config returns the server's TLS config, which uses the certificates
+// that were loaded last for each new connection
+func (l *certLoader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			c := l.current()
+			return &c.Certificates[0], nil
+		},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return l.current(), nil
+		},
+	}
+}
+
+func (l *certLoader) current() *tls.Config {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.config
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate and its key for name to dir
+func writeCert(t *testing.T, dir string, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %s", err)
+	}
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// servedName returns the common name of the certificate the config serves
+func servedName(t *testing.T, config *tls.Config) string {
+	cert, err := config.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate: %s", err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate: %s", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertLoaderReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dialogue-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "one.example.com")
+	l, err := newCertLoader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatalf("newCertLoader: %s", err)
+	}
+	config := l.Config()
+	if name := servedName(t, config); name != "one.example.com" {
+		t.Errorf("serving %s, want one.example.com", name)
+	}
+
+	// connections after a reload get the renewed certificate
+	writeCert(t, dir, "two.example.com")
+	if err := l.Reload(); err != nil {
+		t.Fatalf("Reload: %s", err)
+	}
+	if name := servedName(t, config); name != "two.example.com" {
+		t.Errorf("serving %s after reload, want two.example.com", name)
+	}
+
+	// a broken certificate keeps the current one
+	if err := ioutil.WriteFile(certFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Reload(); err == nil {
+		t.Errorf("Reload accepted a broken certificate")
+	}
+	if name := servedName(t, config); name != "two.example.com" {
+		t.Errorf("serving %s after a failed reload, want two.example.com", name)
+	}
+}
+
+func TestCertLoaderClientCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dialogue-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile := writeCert(t, dir, "api.example.com")
+	l, err := newCertLoader(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatalf("newCertLoader: %s", err)
+	}
+	config, err := l.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetConfigForClient: %s", err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Errorf("client certificates are not required: %v", config.ClientAuth)
+	}
+
+	if _, err := newCertLoader(certFile, keyFile, keyFile); err == nil {
+		t.Errorf("newCertLoader accepted a CA file without certificates")
+	}
+	if _, err := newCertLoader(certFile, keyFile, filepath.Join(dir, "missing.pem")); err == nil {
+		t.Errorf("newCertLoader accepted a missing CA file")
+	}
+}
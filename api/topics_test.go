@@ -0,0 +1,255 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+)
+
+// fakeRender records the last JSON response.  Other methods are not used
+// by the handlers under test.
+type fakeRender struct {
+	render.Render
+	mu     sync.Mutex
+	status int
+	v      interface{}
+}
+
+func (f *fakeRender) JSON(status int, v interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.status = status
+	f.v = v
+}
+
+// topicIds returns the ids of topics joined with commas
+func topicIds(topics []*dialogue.Topic) string {
+	ids := []string{}
+	for _, t := range topics {
+		ids = append(ids, t.Id)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestFindTopicsUnread(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["private"] = &dialogue.Category{Id: "private", Permissions: &dialogue.Permissions{Read: []string{"bob"}}}
+	rdb.addTopic(&dialogue.Topic{Id: "t1"})
+	rdb.addTopic(&dialogue.Topic{Id: "t2"})
+	rdb.addTopic(&dialogue.Topic{Id: "t3", CategoryId: "private"})
+	rdb.unread["t1"] = 2
+	rdb.unread["t3"] = 1
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "t1,t2"},
+		{"unread=true", "t1"},
+		{"unread=false", "t1,t2"},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		topics, err := api.findTopics("alice", query)
+		if err != nil {
+			t.Fatalf("findTopics(%q): %s", test.query, err)
+		}
+		if got := topicIds(topics); got != test.want {
+			t.Errorf("findTopics(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+	topics, err := api.findTopics("alice", url.Values{})
+	if err != nil {
+		t.Fatalf("findTopics: %s", err)
+	}
+	for _, topic := range topics {
+		want := rdb.unread[topic.Id]
+		if topic.UnreadCount != want || topic.HasUnread != (want > 0) {
+			t.Errorf("%s: unread count %d (%v), want %d", topic.Id, topic.UnreadCount, topic.HasUnread, want)
+		}
+	}
+}
+
+func TestFindTopicsArchived(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.addTopic(&dialogue.Topic{Id: "t1"})
+	rdb.addTopic(&dialogue.Topic{Id: "t2", Archived: true})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "t1"},
+		{"archived=false", "t1"},
+		{"archived=true", "t2"},
+		{"archived=all", "t1,t2"},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		topics, err := api.findTopics("alice", query)
+		if err != nil {
+			t.Fatalf("findTopics(%q): %s", test.query, err)
+		}
+		if got := topicIds(topics); got != test.want {
+			t.Errorf("findTopics(%q) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestCheckTopicAccess(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["readonly"] = &dialogue.Category{Id: "readonly", Permissions: &dialogue.Permissions{Post: []string{"bob"}}}
+	rdb.categories["private"] = &dialogue.Category{Id: "private", Permissions: &dialogue.Permissions{Read: []string{"bob"}}}
+	rdb.addTopic(&dialogue.Topic{Id: "open"})
+	rdb.addTopic(&dialogue.Topic{Id: "archived", Archived: true})
+	rdb.addTopic(&dialogue.Topic{Id: "closed", Closed: true})
+	rdb.addTopic(&dialogue.Topic{Id: "readonly", CategoryId: "readonly"})
+	rdb.addTopic(&dialogue.Topic{Id: "private", CategoryId: "private"})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		topicId string
+		post    bool
+		status  int
+	}{
+		{"open", false, 0},
+		{"open", true, 0},
+		{"archived", false, 0},
+		{"archived", true, 409},
+		{"closed", false, 0},
+		{"closed", true, 409},
+		{"readonly", false, 0},
+		{"readonly", true, 403},
+		{"private", false, 404},
+		{"missing", false, 404},
+	}
+	for _, test := range tests {
+		rndr := &fakeRender{}
+		topic, ok := api.checkTopicAccess(test.topicId, "alice", test.post, rndr)
+		if ok != (test.status == 0) || rndr.status != test.status {
+			t.Errorf("%s (post %v): ok %v, status %d, want %d", test.topicId, test.post, ok, rndr.status, test.status)
+		}
+		if ok && topic.Id != test.topicId {
+			t.Errorf("%s: returned topic %s", test.topicId, topic.Id)
+		}
+	}
+}
+
+func TestPutTopicClosed(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.addTopic(&dialogue.Topic{Id: "t1", Title: "closed", Closed: true})
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		form   url.Values
+		status int
+		closed bool
+	}{
+		{url.Values{"title": {"renamed"}}, 409, true},
+		{url.Values{"closed": {"true"}}, 409, true},
+		{url.Values{"closed": {"false"}, "title": {"reopened"}}, 204, false},
+		{url.Values{"closed": {"true"}}, 204, true},
+	}
+	for i, test := range tests {
+		r, _ := http.NewRequest("PUT", "/topics/t1", strings.NewReader(test.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		api.PutTopic(w, r, martini.Params{"topicId": "t1"}, fakeSession{username: "alice"}, rndr)
+		status := rndr.status
+		if status == 0 {
+			status = w.Code
+		}
+		if status != test.status || rdb.topics["t1"].Closed != test.closed {
+			t.Errorf("%d: %v: status %d, closed %v, want %d, %v", i, test.form, status, rdb.topics["t1"].Closed, test.status, test.closed)
+		}
+	}
+	if title := rdb.topics["t1"].Title; title != "reopened" {
+		t.Errorf("title = %q, want reopened", title)
+	}
+}
+
+func TestPostTopics(t *testing.T) {
+	rdb := newFakeDb()
+	rdb.categories["team"] = &dialogue.Category{Id: "team", Permissions: &dialogue.Permissions{Post: []string{"bob"}}}
+	api := &dialogueApi{rdb: rdb, events: newEventHub()}
+
+	tests := []struct {
+		form   url.Values
+		status int
+	}{
+		{url.Values{"title": {"Release planning"}}, 201},
+		{url.Values{"title": {"Release planning"}}, 409},
+		{url.Values{"title": {"Team"}, "categoryId": {"team"}}, 403},
+		{url.Values{"title": {""}}, 422},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("POST", "/topics", strings.NewReader(test.form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		api.PostTopics(w, r, fakeSession{username: "alice"}, rndr)
+		if rndr.status != test.status {
+			t.Errorf("%v: status %d, want %d", test.form, rndr.status, test.status)
+			continue
+		}
+		if test.status != 201 {
+			continue
+		}
+		topic, ok := rndr.v.(*dialogue.Topic)
+		if !ok || topic.Id == "" || topic.Title != test.form.Get("title") || topic.CategoryId != dialogue.DEFAULT_CATEGORY {
+			t.Errorf("%v: created %+v", test.form, rndr.v)
+			continue
+		}
+		if loc := w.Header().Get("Location"); loc != "/v1/topics/"+topic.Id {
+			t.Errorf("%v: Location = %q", test.form, loc)
+		}
+	}
+}
+
+func TestGetTopicStatus(t *testing.T) {
+	rdb := newFakeDb()
+	created := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	rdb.addTopic(&dialogue.Topic{Id: "open", Created: created})
+	rdb.addTopic(&dialogue.Topic{Id: "closed", Closed: true, Created: created})
+	rdb.addTopic(&dialogue.Topic{Id: "archived", Closed: true, Archived: true, Created: created})
+	rdb.posts["p1"] = &dialogue.Post{Id: "p1", TopicId: "open", Created: created.Add(time.Hour)}
+	rdb.posts["p2"] = &dialogue.Post{Id: "p2", TopicId: "open", Created: created.Add(2 * time.Hour)}
+	api := &dialogueApi{rdb: rdb}
+
+	tests := []struct {
+		id     string
+		status string
+		posts  int
+		last   time.Time
+	}{
+		{"open", dialogue.TOPIC_OPEN, 2, created.Add(2 * time.Hour)},
+		{"closed", dialogue.TOPIC_CLOSED, 0, created},
+		{"archived", dialogue.TOPIC_ARCHIVED, 0, created},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", "/topics/"+test.id, nil)
+		w := httptest.NewRecorder()
+		rndr := &fakeRender{}
+		api.GetTopic(w, r, martini.Params{"topicId": test.id}, fakeSession{username: "alice"}, rndr)
+		detail, ok := rndr.v.(*dialogue.TopicDetail)
+		if rndr.status != 200 || !ok {
+			t.Errorf("%s: status %d, %+v", test.id, rndr.status, rndr.v)
+			continue
+		}
+		if detail.Status != test.status || detail.PostCount != test.posts || !detail.LastActivity.Equal(test.last) {
+			t.Errorf("%s: status %s, %d posts, last activity %s", test.id, detail.Status, detail.PostCount, detail.LastActivity)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/ehazlett/dialogue/db"
+	"github.com/go-martini/martini"
+	"github.com/martini-contrib/render"
+	"github.com/martini-contrib/sessions"
+)
+
+type (
+	// purger permanently deletes trash and audit entries older than their
+	// retention periods (unless they are 0) and attachments that are no
+	// longer used
+	purger struct {
+		rdb            db.Db
+		attachments    *attachmentStore
+		retention      time.Duration
+		auditRetention time.Duration
+		interval       time.Duration
+		beat           *heartbeat
+		stop           chan bool
+		done           chan bool
+	}
+)
+
+func newPurger(rdb db.Db, attachments *attachmentStore, retention time.Duration, auditRetention time.Duration, interval time.Duration) *purger {
+	return &purger{
+		rdb:            rdb,
+		attachments:    attachments,
+		retention:      retention,
+		auditRetention: auditRetention,
+		interval:       interval,
+		beat:           newHeartbeat(interval),
+		stop:           make(chan bool),
+		done:           make(chan bool),
+	}
+}
+
+// Run purges expired trash and attachments every interval until Stop is
+// called
+func (p *purger) Run() {
+	defer close(p.done)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.purge(time.Now())
+			p.beat.Beat(time.Now())
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop stops Run and waits for it to return
+func (p *purger) Stop() {
+	close(p.stop)
+	<-p.done
+}
+
+func (p *purger) purge(now time.Time) {
+	if p.retention > 0 {
+		n, err := p.rdb.PurgeTrash(now.Add(-p.retention))
+		if err != nil {
+			log.Errorf("Error purging trash: %s", err)
+			return
+		}
+		if n > 0 {
+			log.Infof("Purged %d items from the trash", n)
+		}
+	}
+	n, err := p.attachments.purge(p.rdb, now)
+	if err != nil {
+		log.Errorf("Error purging attachments: %s", err)
+		return
+	}
+	if n > 0 {
+		log.Infof("Purged %d unused attachments", n)
+	}
+	if p.auditRetention > 0 {
+		n, err := p.rdb.PurgeAuditEntries(now.Add(-p.auditRetention))
+		if err != nil {
+			log.Errorf("Error purging audit log: %s", err)
+			return
+		}
+		if n > 0 {
+			log.Infof("Purged %d audit entries", n)
+		}
+	}
+}
+
+// canRestore reports whether username may see and restore an item from
+// the trash.  Users can restore what they deleted; the admin can restore
+// anything.
+func (t categoryTree) canRestore(categoryId string, deletedBy string, username string) bool {
+	if isAdmin(username) {
+		return true
+	}
+	return deletedBy == username && t.canRead(categoryId, username)
+}
+
+// GetTrash returns the deleted topics and posts the user can restore
+func (api *dialogueApi) GetTrash(session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	trash, err := api.rdb.GetTrash()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting trash: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	res := &dialogue.Trash{
+		Topics: []*dialogue.Topic{},
+		Posts:  []*dialogue.Post{},
+	}
+	for _, t := range trash.Topics {
+		if tree.canRestore(t.CategoryId, t.DeletedBy, username) {
+			res.Topics = append(res.Topics, t)
+		}
+	}
+	// the topics of deleted posts are loaded at once
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, p := range trash.Posts {
+		if !seen[p.TopicId] {
+			seen[p.TopicId] = true
+			ids = append(ids, p.TopicId)
+		}
+	}
+	topics, err := api.rdb.GetTopicsById(ids)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topics: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	categories := map[string]string{}
+	for _, t := range topics {
+		categories[t.Id] = t.CategoryId
+	}
+	for _, p := range trash.Posts {
+		categoryId, ok := categories[p.TopicId]
+		if !ok && !isAdmin(username) {
+			// posts in deleted topics are restored with the topic
+			continue
+		}
+		if tree.canRestore(categoryId, p.DeletedBy, username) {
+			res.Posts = append(res.Posts, p)
+		}
+	}
+	rndr.JSON(200, res)
+}
+
+func (api *dialogueApi) PostTrashTopicRestore(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	topic, err := api.rdb.GetDeletedTopic(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topic: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if topic == nil || !tree.canRestore(topic.CategoryId, topic.DeletedBy, username) {
+		e := ApiError{
+			Message: "topic not found in trash",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if err := api.rdb.RestoreTopic(id); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error restoring topic: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (api *dialogueApi) PostTrashPostRestore(w http.ResponseWriter, params martini.Params, session sessions.Session, rndr render.Render) {
+	username := session.Get("username").(string)
+	id := params["id"]
+	post, err := api.rdb.GetDeletedPost(id)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if post == nil {
+		e := ApiError{
+			Message: "post not found in trash",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	topic, err := api.rdb.GetTopic(post.TopicId)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting topic: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if topic == nil {
+		e := ApiError{
+			Message: "the topic for this post is deleted; restore the topic first",
+		}
+		rndr.JSON(409, e)
+		return
+	}
+	tree, err := api.getCategoryTree()
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error getting categories: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if !tree.canRestore(topic.CategoryId, post.DeletedBy, username) {
+		e := ApiError{
+			Message: "post not found in trash",
+		}
+		rndr.JSON(404, e)
+		return
+	}
+	if err := api.rdb.RestorePost(id); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error restoring post: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// DeleteTrash permanently deletes trash.  Only items deleted longer than
+// olderThan (i.e. 720h) ago are purged if it is specified.
+func (api *dialogueApi) DeleteTrash(r *http.Request, session sessions.Session, rndr render.Render) {
+	before := time.Now()
+	if v := r.FormValue("olderThan"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			e := ApiError{
+				Message: fmt.Sprintf("invalid olderThan: %s", err),
+			}
+			rndr.JSON(400, e)
+			return
+		}
+		before = before.Add(-d)
+	}
+	n, err := api.rdb.PurgeTrash(before)
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error purging trash: %s", err),
+		}
+		rndr.JSON(500, e)
+		return
+	}
+	if _, err := api.attachments.purge(api.rdb, time.Now()); err != nil {
+		log.Errorf("Error purging attachments: %s", err)
+	}
+	api.audit(r, dialogue.AUDIT_TRASH_PURGED, session.Get("username").(string), "", map[string]string{"before": before.Format(time.RFC3339), "purged": strconv.Itoa(n)})
+	rndr.JSON(200, map[string]int{"purged": n})
+}
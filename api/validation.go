@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ehazlett/dialogue"
+	"github.com/martini-contrib/render"
+)
+
+const maxJSONBody = 1 << 20
+
+type (
+	// fieldRule describes the values accepted for a request field
+	fieldRule struct {
+		Required  bool
+		MaxLength int
+		OneOf     []string
+		Kind      string
+	}
+	// schema maps request fields to their rules.  Fields not in the
+	// schema are not checked.
+	schema map[string]fieldRule
+)
+
+// field kinds
+const (
+	kindString   = ""
+	kindBool     = "bool"
+	kindInt      = "int"
+	kindTime     = "time"
+	kindDuration = "duration"
+	kindEmail    = "email"
+	kindLine     = "line" // text without control characters such as line breaks
+)
+
+var (
+	priorities = []string{
+		dialogue.PRIORITY_LOW,
+		dialogue.PRIORITY_NORMAL,
+		dialogue.PRIORITY_HIGH,
+		dialogue.PRIORITY_URGENT,
+	}
+	newTopicSchema = schema{
+		"title": {Required: true, MaxLength: 200, Kind: kindLine},
+	}
+	topicSchema = schema{
+		"title":    {MaxLength: 200, Kind: kindLine},
+		"closed":   {Kind: kindBool},
+		"priority": {OneOf: priorities},
+		"due":      {Kind: kindTime},
+	}
+	postSchema = schema{
+		"draft":     {Kind: kindBool},
+		"publishAt": {Kind: kindTime},
+	}
+	draftSchema = postSchema
+	authSchema  = schema{
+		"username": {Required: true},
+		"password": {Required: true},
+	}
+	newUserSchema = schema{
+		"username": {Required: true, MaxLength: 64},
+		"password": {Required: true},
+		"email":    {Kind: kindEmail},
+	}
+	userSchema = schema{
+		"email": {Kind: kindEmail},
+	}
+	subscriptionSchema = schema{
+		"mode": {OneOf: []string{
+			dialogue.DELIVERY_IMMEDIATE,
+			dialogue.DELIVERY_HOURLY,
+			dialogue.DELIVERY_DAILY,
+		}},
+	}
+	pollSchema = schema{
+		"question":  {Required: true, MaxLength: 500},
+		"option":    {MaxLength: 200},
+		"multiple":  {Kind: kindBool},
+		"anonymous": {Kind: kindBool},
+		"closesAt":  {Kind: kindTime},
+		"closesIn":  {Kind: kindDuration},
+	}
+	voteSchema = schema{
+		"option": {Required: true, Kind: kindInt},
+	}
+	postsQuerySchema = schema{
+		"since": {Kind: kindTime},
+		"until": {Kind: kindTime},
+		"limit": {Kind: kindInt},
+	}
+	auditQuerySchema = postsQuerySchema
+	searchSchema     = schema{
+		"q": {Required: true},
+	}
+)
+
+// validate returns a message for each invalid field in form
+func (s schema) validate(form url.Values) map[string]string {
+	fields := map[string]string{}
+	for name, rule := range s {
+		values, ok := form[name]
+		if !ok || len(values) == 0 || (len(values) == 1 && strings.TrimSpace(values[0]) == "") {
+			if rule.Required {
+				fields[name] = "required"
+			}
+			continue
+		}
+		for _, v := range values {
+			if msg := rule.check(v); msg != "" {
+				fields[name] = msg
+				break
+			}
+		}
+	}
+	return fields
+}
+
+func (r fieldRule) check(v string) string {
+	if r.MaxLength > 0 && len([]rune(v)) > r.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", r.MaxLength)
+	}
+	if len(r.OneOf) > 0 {
+		valid := false
+		for _, o := range r.OneOf {
+			if v == o {
+				valid = true
+			}
+		}
+		if !valid {
+			return "must be one of: " + strings.Join(r.OneOf, ", ")
+		}
+	}
+	if v == "" {
+		return ""
+	}
+	switch r.Kind {
+	case kindBool:
+		if v != "true" && v != "false" {
+			return "must be true or false"
+		}
+	case kindInt:
+		if _, err := strconv.Atoi(v); err != nil {
+			return "must be an integer"
+		}
+	case kindTime:
+		if _, err := parseTime(v); err != nil {
+			return "must be an RFC 3339 time (i.e. 2026-10-20T09:00:00Z) or a local time (i.e. 2026-10-20 09:00)"
+		}
+	case kindDuration:
+		if _, err := time.ParseDuration(v); err != nil {
+			return "must be a duration (i.e. 48h)"
+		}
+	case kindEmail:
+		if a, err := mail.ParseAddress(v); err != nil || a.Address != v {
+			return "must be an email address"
+		}
+	case kindLine:
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return "must not contain control characters"
+		}
+	}
+	return ""
+}
+
+// validateRequest parses the request and checks it against s.  If the
+// request is invalid, an error with the invalid fields is rendered (422)
+// and false is returned.
+func validateRequest(r *http.Request, s schema, rndr render.Render) bool {
+	if err := r.ParseForm(); err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error parsing request: %s", err),
+		}
+		rndr.JSON(400, e)
+		return false
+	}
+	if fields := s.validate(r.Form); len(fields) > 0 {
+		e := ApiError{
+			Message: "invalid request",
+			Details: fields,
+		}
+		rndr.JSON(422, e)
+		return false
+	}
+	return true
+}
+
+// jsonBody allows handlers to read application/json request bodies with
+// r.FormValue.  The fields of a JSON object are added to r.Form and
+// r.PostForm: strings are used as they are, numbers and booleans are
+// formatted and arrays become repeated values.
+func jsonBody(r *http.Request, rndr render.Render) {
+	if r.Body == nil || r.Method == "GET" || r.Method == "HEAD" {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return
+	}
+	form, err := decodeJSONForm(io.LimitReader(r.Body, maxJSONBody))
+	if err != nil {
+		e := ApiError{
+			Message: fmt.Sprintf("Error parsing request: %s", err),
+		}
+		rndr.JSON(400, e)
+		return
+	}
+	r.PostForm = form
+	r.Form = url.Values{}
+	for k, v := range form {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+}
+
+func decodeJSONForm(body io.Reader) (url.Values, error) {
+	var obj map[string]interface{}
+	d := json.NewDecoder(body)
+	d.UseNumber()
+	if err := d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("invalid JSON object: %s", err)
+	}
+	form := url.Values{}
+	for k, v := range obj {
+		values, err := jsonValues(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", k, err)
+		}
+		form[k] = values
+	}
+	return form, nil
+}
+
+func jsonValues(v interface{}) ([]string, error) {
+	switch v := v.(type) {
+	case nil:
+		return []string{""}, nil
+	case string:
+		return []string{v}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case json.Number:
+		return []string{v.String()}, nil
+	case []interface{}:
+		values := []string{}
+		for _, e := range v {
+			switch e.(type) {
+			case []interface{}, map[string]interface{}:
+				return nil, fmt.Errorf("nested values are not supported")
+			}
+			ev, err := jsonValues(e)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, ev...)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("objects are not supported")
+}
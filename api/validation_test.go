@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopicTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		ok    bool
+	}{
+		{"Release planning", true},
+		{"Réunion — 2026", true},
+		{"Hi\r\nBcc: eve@example.com", false},
+		{"Hi\nthere", false},
+		{"tab\there", false},
+		{"null\x00", false},
+	}
+	for _, test := range tests {
+		for _, s := range []schema{newTopicSchema, topicSchema} {
+			fields := s.validate(url.Values{"title": {test.title}})
+			if _, invalid := fields["title"]; invalid == test.ok {
+				t.Errorf("title %q: validate = %v, want ok %v", test.title, fields, test.ok)
+			}
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := schema{
+		"title":    {Required: true, MaxLength: 5},
+		"priority": {OneOf: []string{"low", "high"}},
+		"closed":   {Kind: kindBool},
+		"count":    {Kind: kindInt},
+		"at":       {Kind: kindTime},
+		"every":    {Kind: kindDuration},
+		"email":    {Kind: kindEmail},
+	}
+	tests := []struct {
+		name   string
+		form   url.Values
+		fields map[string]string
+	}{
+		{"valid", url.Values{
+			"title":    {"héllo"},
+			"priority": {"low"},
+			"closed":   {"false"},
+			"count":    {"-3"},
+			"at":       {"2026-10-20 09:00"},
+			"every":    {"48h"},
+			"email":    {"alice@example.com"},
+			"other":    {"not checked"},
+		}, nil},
+		{"missing", url.Values{}, map[string]string{"title": "required"}},
+		{"blank", url.Values{"title": {"  "}}, map[string]string{"title": "required"}},
+		{"too long", url.Values{"title": {"hello!"}}, map[string]string{"title": "must be at most 5 characters"}},
+		{"empty optional", url.Values{"title": {"a"}, "closed": {""}, "email": {""}}, nil},
+		{"one of", url.Values{"title": {"a"}, "priority": {"urgent"}}, map[string]string{"priority": "must be one of: low, high"}},
+		{"repeated", url.Values{"title": {"a"}, "priority": {"low", "urgent"}}, map[string]string{"priority": "must be one of: low, high"}},
+		{"bool", url.Values{"title": {"a"}, "closed": {"yes"}}, map[string]string{"closed": "must be true or false"}},
+		{"int", url.Values{"title": {"a"}, "count": {"1.5"}}, map[string]string{"count": "must be an integer"}},
+		{"time", url.Values{"title": {"a"}, "at": {"20.10.2026"}}, map[string]string{"at": "must be an RFC 3339 time (i.e. 2026-10-20T09:00:00Z) or a local time (i.e. 2026-10-20 09:00)"}},
+		{"duration", url.Values{"title": {"a"}, "every": {"2 days"}}, map[string]string{"every": "must be a duration (i.e. 48h)"}},
+		{"email", url.Values{"title": {"a"}, "email": {"Alice <alice@example.com>"}}, map[string]string{"email": "must be an email address"}},
+		{"several", url.Values{"count": {"x"}}, map[string]string{"title": "required", "count": "must be an integer"}},
+	}
+	for _, test := range tests {
+		fields := s.validate(test.form)
+		if len(fields) != len(test.fields) {
+			t.Errorf("%s: validate = %v, want %v", test.name, fields, test.fields)
+			continue
+		}
+		for k, v := range test.fields {
+			if fields[k] != v {
+				t.Errorf("%s: %s = %q, want %q", test.name, k, fields[k], v)
+			}
+		}
+	}
+}
+
+func TestDecodeJSONForm(t *testing.T) {
+	form, err := decodeJSONForm(strings.NewReader(`{"title": "a", "closed": true, "count": 12, "tags": ["x", 1], "due": null}`))
+	if err != nil {
+		t.Fatalf("decodeJSONForm: %s", err)
+	}
+	want := url.Values{
+		"title":  {"a"},
+		"closed": {"true"},
+		"count":  {"12"},
+		"tags":   {"x", "1"},
+		"due":    {""},
+	}
+	for k, v := range want {
+		if strings.Join(form[k], "|") != strings.Join(v, "|") {
+			t.Errorf("%s = %q, want %q", k, form[k], v)
+		}
+	}
+	for _, body := range []string{`[1]`, `{"a": {"b": 1}}`, `{"a": [[1]]}`, `{"a":`} {
+		if _, err := decodeJSONForm(strings.NewReader(body)); err == nil {
+			t.Errorf("decodeJSONForm(%q) succeeded", body)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		v    string
+		want time.Time
+		ok   bool
+	}{
+		{"2026-10-20T09:00:00Z", time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC), true},
+		{"2026-10-20T09:00:00+02:00", time.Date(2026, 10, 20, 7, 0, 0, 0, time.UTC), true},
+		{"2026-10-20 09:00", time.Date(2026, 10, 20, 9, 0, 0, 0, time.Local), true},
+		{"2026-10-20", time.Date(2026, 10, 20, 0, 0, 0, 0, time.Local), true},
+		{"2026-10-20 9am", time.Time{}, false},
+		{"tomorrow", time.Time{}, false},
+	}
+	for _, test := range tests {
+		got, err := parseTime(test.v)
+		if (err == nil) != test.ok || !got.Equal(test.want) {
+			t.Errorf("parseTime(%q) = %s, %v, want %s", test.v, got, err, test.want)
+		}
+		// the validation schema accepts the same times
+		fields := topicSchema.validate(url.Values{"due": {test.v}})
+		if _, invalid := fields["due"]; invalid == test.ok {
+			t.Errorf("due %q: validate = %v, want ok %v", test.v, fields, test.ok)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package blob
+
+import (
+	"errors"
+	"io"
+)
+
+type (
+	// Store holds the contents of attachments.  Keys are generated by the
+	// api and contain only letters, digits and dashes.
+	Store interface {
+		Put(key string, r io.Reader, size int64) error
+		Get(key string) (io.ReadCloser, error)
+		Delete(key string) error
+	}
+)
+
+var (
+	ErrNotFound = errors.New("blob not found")
+)
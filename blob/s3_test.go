@@ -0,0 +1,204 @@
+package blob
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// fakeS3 is a minimal stand-in for an S3 service.  It checks request
+// signatures and keeps objects in memory.
+type fakeS3 struct {
+	bucket  string
+	region  string
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3(bucket string, region string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		region:  region,
+		objects: map[string][]byte{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		w.WriteHeader(403)
+		fmt.Fprintf(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>%s</Message></Error>", err)
+		return
+	}
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(404)
+		fmt.Fprint(w, "<Error><Code>NoSuchBucket</Code></Error>")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case "PUT":
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(400)
+			return
+		}
+		if int64(len(data)) != r.ContentLength {
+			w.WriteHeader(400)
+			fmt.Fprint(w, "<Error><Code>IncompleteBody</Code></Error>")
+			return
+		}
+		f.objects[key] = data
+	case "GET":
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(404)
+			fmt.Fprint(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Write(data)
+	case "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(204)
+	default:
+		w.WriteHeader(405)
+	}
+}
+
+// verify recomputes the AWS signature version 4 of a request
+func (f *fakeS3) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	amzDate := r.Header.Get("X-Amz-Date")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if amzDate == "" || payloadHash == "" {
+		return fmt.Errorf("missing x-amz-date or x-amz-content-sha256")
+	}
+	if r.Method != "PUT" && payloadHash != emptyPayloadHash {
+		return fmt.Errorf("unexpected payload hash %s", payloadHash)
+	}
+	scope := amzDate[:8] + "/" + f.region + "/s3/aws4_request"
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	if fields["Credential"] != testAccessKey+"/"+scope {
+		return fmt.Errorf("unexpected credential %q", fields["Credential"])
+	}
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	var canonical bytes.Buffer
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", r.Method, r.URL.EscapedPath(), r.URL.RawQuery)
+	for _, h := range signed {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		fmt.Fprintf(&canonical, "%s:%s\n", h, strings.TrimSpace(v))
+	}
+	fmt.Fprintf(&canonical, "\n%s\n%s", fields["SignedHeaders"], payloadHash)
+	sum := sha256.Sum256(canonical.Bytes())
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + testSecretKey)
+	for _, s := range []string{amzDate[:8], f.region, "s3", "aws4_request", toSign} {
+		m := hmac.New(sha256.New, key)
+		m.Write([]byte(s))
+		key = m.Sum(nil)
+	}
+	if fields["Signature"] != hex.EncodeToString(key) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+func newTestS3Store(t *testing.T, fake *fakeS3, secretKey string) (Store, func()) {
+	srv := httptest.NewServer(fake)
+	s, err := NewS3Store(srv.URL, fake.bucket, fake.region, testAccessKey, secretKey)
+	if err != nil {
+		srv.Close()
+		t.Fatalf("NewS3Store: %s", err)
+	}
+	return s, srv.Close
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	fake := newFakeS3("attachments", "eu-west-1")
+	s, done := newTestS3Store(t, fake, testSecretKey)
+	defer done()
+
+	data := []byte("hello attachments")
+	if err := s.Put("1f0c2d7e-5b3a", bytes.NewReader(data), int64(len(data))); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+	if _, ok := fake.objects["1f0c2d7e-5b3a"]; !ok {
+		t.Fatalf("object was not stored under its key: %v", fake.objects)
+	}
+	rc, err := s.Get("1f0c2d7e-5b3a")
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	got, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatalf("reading object: %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get returned %q, want %q", got, data)
+	}
+	if err := s.Delete("1f0c2d7e-5b3a"); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if _, err := s.Get("1f0c2d7e-5b3a"); err != ErrNotFound {
+		t.Errorf("Get after Delete returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3StoreErrors(t *testing.T) {
+	fake := newFakeS3("attachments", "us-east-1")
+	s, done := newTestS3Store(t, fake, "wrong-secret")
+	defer done()
+
+	err := s.Put("key", strings.NewReader("x"), 1)
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a bad secret returned %v, want a 403 with the error body", err)
+	}
+	if len(fake.objects) != 0 {
+		t.Errorf("object was stored despite a bad signature")
+	}
+}
+
+func TestNewS3Store(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		bucket   string
+		ok       bool
+	}{
+		{"https://s3.amazonaws.com", "attachments", true},
+		{"http://localhost:9000/", "attachments", true},
+		{"localhost:9000", "attachments", false},
+		{"https://s3.amazonaws.com", "", false},
+		{"://bad", "attachments", false},
+	}
+	for _, test := range tests {
+		_, err := NewS3Store(test.endpoint, test.bucket, "", testAccessKey, testSecretKey)
+		if (err == nil) != test.ok {
+			t.Errorf("NewS3Store(%q, %q) returned %v", test.endpoint, test.bucket, err)
+		}
+	}
+}
@@ -4,13 +4,21 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
+	"github.com/ehazlett/dialogue"
 	"github.com/ehazlett/dialogue/client"
+	"github.com/ehazlett/dialogue/markdown"
 	"github.com/howeyc/gopass"
 )
 
@@ -99,109 +107,1048 @@ func cliLogin(c *cli.Context) {
 	log.Info("Login successful")
 }
 
+// fatalChanged exits with err, explaining errors caused by someone else
+// changing a resource since the version the command was run for
+func fatalChanged(err error, resource string) {
+	if client.Cause(err) == client.ErrPreconditionFailed {
+		log.Fatalf("The %s has been changed by someone else since it was read; check the changes and run the command again", resource)
+	}
+	log.Fatal(err)
+}
+
 func cliDeleteTopic(c *cli.Context) {
 	id := c.String("id")
 	if id == "" {
-		log.Fatal("You must specify a topic ID")
+		log.Fatal("You must specify a topic ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	version := c.Int("version")
+	if version < 0 {
+		t, err := client.GetTopic(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		version = t.Version
+	}
+	if err := client.DeleteTopic(id, version); err != nil {
+		fatalChanged(err, "topic")
+	}
+}
+
+func cliCreateTopic(c *cli.Context) {
+	title := c.String("title")
+	if title == "" {
+		log.Fatal("You must specify a title")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topic, err := client.CreateTopic(title, c.String("category"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Bool("quiet") {
+		fmt.Println(topic.Id)
+		return
+	}
+	fmt.Printf("Created topic %s\n", topic.Id)
+}
+
+func cliListTopics(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	filter := url.Values{}
+	if c.Bool("unread") {
+		filter.Set("unread", "true")
+	}
+	if c.Bool("archived") {
+		filter.Set("archived", "true")
+	}
+	if category := c.String("category"); category != "" {
+		filter.Set("category", category)
+		if c.Bool("recursive") {
+			filter.Set("recursive", "true")
+		}
+	}
+	if labels := c.StringSlice("label"); len(labels) > 0 {
+		filter["label"] = labels
+		if c.Bool("any") {
+			filter.Set("labelMode", "or")
+		}
+	}
+	topics, err := client.FindTopics(filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(topics) == 0 {
+		return
+	}
+	w := getTableWriter()
+	fmt.Fprint(w, "\tTitle\tUnread\tLabels\tID\t\n")
+	for _, t := range topics {
+		status := " "
+		if t.HasUnread {
+			status = "*"
+		}
+		title := t.Title
+		if t.Sticky != "" {
+			title = "[sticky] " + title
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%v\t\n", status, title, t.UnreadCount, strings.Join(t.Labels, ","), t.Id)
+	}
+	w.Flush()
+}
+
+func cliShowTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic id")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	t, err := client.GetTopic(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := getTableWriter()
+	fmt.Fprintf(w, "ID:\t%s\n", t.Id)
+	fmt.Fprintf(w, "Title:\t%s\n", t.Title)
+	fmt.Fprintf(w, "Status:\t%s\n", t.Status)
+	fmt.Fprintf(w, "Category:\t%s\n", t.CategoryId)
+	fmt.Fprintf(w, "Priority:\t%s\n", t.Priority)
+	if len(t.Assignees) > 0 {
+		fmt.Fprintf(w, "Assignees:\t%s\n", strings.Join(t.Assignees, ", "))
+	}
+	if len(t.Labels) > 0 {
+		fmt.Fprintf(w, "Labels:\t%s\n", strings.Join(t.Labels, ", "))
+	}
+	if t.Due != nil {
+		fmt.Fprintf(w, "Due:\t%s\n", t.Due.Local().Format("Jan 2 15:04"))
+	}
+	fmt.Fprintf(w, "Created:\t%s\n", t.Created.Local().Format("Jan 2 15:04"))
+	fmt.Fprintf(w, "Version:\t%d\n", t.Version)
+	fmt.Fprintf(w, "Posts:\t%d\n", t.PostCount)
+	if t.LastActivity != nil {
+		fmt.Fprintf(w, "Last activity:\t%s\n", t.LastActivity.Local().Format("Jan 2 15:04"))
+	}
+	w.Flush()
+}
+
+func cliArchiveTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Bool("restore") {
+		err = client.UnarchiveTopic(id)
+	} else {
+		err = client.ArchiveTopic(id)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliPinTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Bool("remove") {
+		err = client.UnpinTopic(id)
+	} else {
+		err = client.PinTopic(id, c.Bool("global"))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliPinPost(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a post ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Bool("remove") {
+		err = client.UnpinPost(id)
+	} else {
+		err = client.PinPost(id)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliMoveTopic(c *cli.Context) {
+	id := c.String("id")
+	category := c.String("category")
+	if id == "" || category == "" {
+		log.Fatal("You must specify a topic ID and category")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.MoveTopic(id, category); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliListCategories(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cats, err := client.GetCategories()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(cats) == 0 {
+		return
+	}
+	children := map[string][]*dialogue.Category{}
+	ids := map[string]bool{}
+	for _, cat := range cats {
+		ids[cat.Id] = true
+	}
+	for _, cat := range cats {
+		parent := cat.ParentId
+		// show categories with an unreadable parent at the top level
+		if !ids[parent] {
+			parent = ""
+		}
+		children[parent] = append(children[parent], cat)
+	}
+	w := getTableWriter()
+	fmt.Fprint(w, "Name\tDescription\tID\t\n")
+	var list func(parent string, depth int)
+	list = func(parent string, depth int) {
+		for _, cat := range children[parent] {
+			fmt.Fprintf(w, "%s%s\t%s\t%s\t\n", strings.Repeat("  ", depth), cat.Name, cat.Description, cat.Id)
+			list(cat.Id, depth+1)
+		}
+	}
+	list("", 0)
+	w.Flush()
+}
+
+func cliCreateCategory(c *cli.Context) {
+	name := c.String("name")
+	if name == "" {
+		log.Fatal("You must specify a name")
+	}
+	var read, post, moderate []string
+	if v := c.StringSlice("read"); len(v) > 0 {
+		read = v
+	}
+	if v := c.StringSlice("post"); len(v) > 0 {
+		post = v
+	}
+	if v := c.StringSlice("moderate"); len(v) > 0 {
+		moderate = v
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.CreateCategory(name, c.String("description"), c.String("parent"), read, post, moderate); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliListTrash(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	trash, err := client.GetTrash()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(trash.Topics) == 0 && len(trash.Posts) == 0 {
+		return
+	}
+	w := getTableWriter()
+	fmt.Fprint(w, "Type\tTitle/Content\tDeleted\tBy\tID\t\n")
+	for _, t := range trash.Topics {
+		fmt.Fprintf(w, "topic\t%s\t%s\t%s\t%s\t\n", t.Title, t.DeletedAt.Format("2006-01-02 15:04"), t.DeletedBy, t.Id)
+	}
+	for _, p := range trash.Posts {
+		content := []rune(strings.Replace(p.Content, "\n", " ", -1))
+		if len(content) > 40 {
+			content = append(content[:40], []rune("...")...)
+		}
+		fmt.Fprintf(w, "post\t%s\t%s\t%s\t%s\t\n", string(content), p.DeletedAt.Format("2006-01-02 15:04"), p.DeletedBy, p.Id)
+	}
+	w.Flush()
+}
+
+func cliRestoreTrash(c *cli.Context) {
+	topicId := c.String("topic")
+	postId := c.String("post")
+	if (topicId == "") == (postId == "") {
+		log.Fatal("You must specify either a topic or post ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if topicId != "" {
+		err = client.RestoreTopic(topicId)
+	} else {
+		err = client.RestorePost(postId)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliPurgeTrash(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	n, err := client.PurgeTrash(c.String("older-than"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Infof("Purged %d items", n)
+}
+
+func cliAddTopicLabel(c *cli.Context) {
+	id := c.String("id")
+	label := c.String("label")
+	if id == "" || label == "" {
+		log.Fatal("You must specify a topic ID and label")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.AddTopicLabel(id, label); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliRemoveTopicLabel(c *cli.Context) {
+	id := c.String("id")
+	label := c.String("label")
+	if id == "" || label == "" {
+		log.Fatal("You must specify a topic ID and label")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.RemoveTopicLabel(id, label); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliListLabels(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	labels, err := client.GetLabels()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(labels) == 0 {
+		return
+	}
+	w := getTableWriter()
+	fmt.Fprint(w, "Name\tColor\tDescription\t\n")
+	for _, l := range labels {
+		fmt.Fprintf(w, "%s\t%s\t%s\t\n", l.Name, l.Color, l.Description)
+	}
+	w.Flush()
+}
+
+func cliCreateLabel(c *cli.Context) {
+	name := c.String("name")
+	if name == "" {
+		log.Fatal("You must specify a name")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.CreateLabel(name, c.String("color"), c.String("description")); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliUpdateLabel(c *cli.Context) {
+	name := c.String("name")
+	if name == "" {
+		log.Fatal("You must specify a name")
+	}
+	vals := url.Values{}
+	for _, f := range []string{"rename", "color", "description"} {
+		if v := c.String(f); v != "" {
+			vals.Set(f, v)
+		}
+	}
+	if v := vals.Get("rename"); v != "" {
+		vals.Del("rename")
+		vals.Set("name", v)
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.UpdateLabel(name, vals); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliDeleteLabel(c *cli.Context) {
+	name := c.String("name")
+	if name == "" {
+		log.Fatal("You must specify a name")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.DeleteLabel(name); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliSearch(c *cli.Context) {
+	query := c.String("query")
+	if query == "" {
+		log.Fatal("You must specify a query")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := client.Search(query, c.StringSlice("label"), c.Bool("any"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := getTableWriter()
+	for _, t := range res.Topics {
+		fmt.Fprintf(w, "topic\t%s\t%s\t\n", t.Title, t.Id)
+	}
+	for _, p := range res.Posts {
+		fmt.Fprintf(w, "post\t%s\t%s\t\n", p.Content, p.Id)
+	}
+	w.Flush()
+}
+
+func cliReadTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.MarkTopicRead(id); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliAssignTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.AssignTopic(id, c.StringSlice("user")); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliDueTopic(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a topic ID")
+	}
+	vals := url.Values{}
+	if c.Bool("clear") {
+		vals.Set("due", "")
+	} else if due := c.String("due"); due != "" {
+		t, err := parseLocalTime(due)
+		if err != nil {
+			log.Fatal(err)
+		}
+		vals.Set("due", t.Format(time.RFC3339))
+	}
+	if priority := c.String("priority"); priority != "" {
+		vals.Set("priority", priority)
+	}
+	if len(vals) == 0 {
+		log.Fatal("You must specify a due date or priority")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	version := c.Int("version")
+	if version < 0 {
+		t, err := client.GetTopic(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		version = t.Version
+	}
+	if err := client.UpdateTopic(id, version, vals); err != nil {
+		fatalChanged(err, "topic")
+	}
+}
+
+type topicsByDue []*dialogue.Topic
+
+func (t topicsByDue) Len() int      { return len(t) }
+func (t topicsByDue) Swap(i, j int) { t[i], t[j] = t[j], t[i] }
+func (t topicsByDue) Less(i, j int) bool {
+	if t[i].Due == nil || t[j].Due == nil {
+		return t[j].Due == nil && t[i].Due != nil
+	}
+	return t[i].Due.Before(*t[j].Due)
+}
+
+func cliTodo(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics, err := client.GetAssignedTopics()
+	if err != nil {
+		log.Fatal(err)
+	}
+	var todo []*dialogue.Topic
+	for _, t := range topics {
+		if !t.Closed || c.Bool("all") {
+			todo = append(todo, t)
+		}
+	}
+	if len(todo) == 0 {
+		return
+	}
+	sort.Sort(topicsByDue(todo))
+	now := time.Now()
+	w := getTableWriter()
+	fmt.Fprint(w, "\tDue\tPriority\tTitle\tID\t\n")
+	for _, t := range todo {
+		status, due := " ", "-"
+		if t.IsOverdue(now) {
+			status = "!"
+		}
+		if t.Due != nil {
+			due = t.Due.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", status, due, t.Priority, t.Title, t.Id)
+	}
+	w.Flush()
+}
+
+func cliCreatePost(c *cli.Context) {
+	content := c.String("content")
+	topicId := c.String("topicId")
+	attachments := c.StringSlice("attach")
+	if topicId == "" || (content == "" && len(attachments) == 0) {
+		log.Fatal("You must specify a topic id and content")
+	}
+	var publishAt *time.Time
+	if at := c.String("at"); at != "" {
+		t, err := parseLocalTime(at)
+		if err != nil {
+			log.Fatal(err)
+		}
+		publishAt = &t
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var post *dialogue.Post
+	if c.Bool("draft") || publishAt != nil {
+		post, err = client.CreateDraft(topicId, content, attachments, publishAt)
+	} else {
+		post, err = client.CreatePost(topicId, content, attachments)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c.Bool("quiet") {
+		fmt.Println(post.Id)
+		return
+	}
+	fmt.Printf("Created post %s\n", post.Id)
+}
+
+// parseLocalTime parses a time such as "2026-10-20 09:00" in the local
+// time zone, or an RFC 3339 time
+func parseLocalTime(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q (use i.e. \"2026-10-20 09:00\")", s)
+	}
+	return t, nil
+}
+
+func cliListDrafts(c *cli.Context) {
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	drafts, err := client.GetDrafts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(drafts) == 0 {
+		return
+	}
+	w := getTableWriter()
+	fmt.Fprint(w, "Status\tContent\tTopic\tID\t\n")
+	for _, d := range drafts {
+		status := d.Status
+		if d.PublishAt != nil {
+			status = d.PublishAt.Local().Format("Jan 2 15:04")
+		}
+		content := []rune(strings.Replace(d.Content, "\n", " ", -1))
+		if len(content) > 40 {
+			content = append(content[:37], []rune("...")...)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", status, string(content), d.TopicId, d.Id)
+	}
+	w.Flush()
+}
+
+func cliEditDraft(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a draft ID")
+	}
+	vals := url.Values{}
+	if c.IsSet("content") {
+		vals.Set("content", c.String("content"))
+	}
+	if at := c.String("at"); at != "" {
+		t, err := parseLocalTime(at)
+		if err != nil {
+			log.Fatal(err)
+		}
+		vals.Set("publishAt", t.Format(time.RFC3339))
+	}
+	if c.Bool("unschedule") {
+		vals.Set("draft", "true")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	version := c.Int("version")
+	if version < 0 {
+		p, err := client.GetDraft(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		version = p.Version
+	}
+	if err := client.UpdateDraft(id, version, vals); err != nil {
+		fatalChanged(err, "draft")
+	}
+}
+
+func cliPublishDraft(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a draft ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.PublishDraft(id); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliDeleteDraft(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a draft ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	version := c.Int("version")
+	if version < 0 {
+		p, err := client.GetDraft(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		version = p.Version
+	}
+	if err := client.DeleteDraft(id, version); err != nil {
+		fatalChanged(err, "draft")
+	}
+}
+
+func cliListPosts(c *cli.Context) {
+	topicId := c.String("topicId")
+	showIds := c.Bool("ids")
+	if topicId == "" {
+		log.Fatal("You must specify a topic id")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	posts, err := client.GetPosts(topicId)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printPosts(posts, showIds, c.Bool("raw"))
+}
+
+func cliShowPost(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a post id")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	post, err := client.GetPost(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Topic: %s\n\n", post.TopicId)
+	printPosts([]*dialogue.Post{post}, true, c.Bool("raw"))
+}
+
+// printPosts prints posts with their content rendered for the terminal,
+// or as it was written if raw is true
+func printPosts(posts []*dialogue.Post, showIds bool, raw bool) {
+	if len(posts) == 0 {
+		return
+	}
+	if raw {
+		w := getTableWriter()
+		for _, p := range posts {
+			fmt.Fprintf(w, "%v\t -%s", p.Content, p.Author)
+			if showIds {
+				fmt.Fprintf(w, "\t%s", p.Id)
+				if len(p.Attachments) > 0 {
+					fmt.Fprintf(w, "\tattachments: %s", strings.Join(p.Attachments, ","))
+				}
+			}
+			fmt.Fprint(w, "\n")
+		}
+		w.Flush()
+		return
+	}
+	// render the Markdown content, using escape codes only on a terminal
+	renderContent := markdown.Text
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		renderContent = markdown.Terminal
+	}
+	for i, p := range posts {
+		if i > 0 {
+			fmt.Println()
+		}
+		header := fmt.Sprintf("%s (%s)", p.Author, p.Created.Local().Format("Jan 2 15:04"))
+		if p.Pinned {
+			header = "[pinned] " + header
+		}
+		if showIds {
+			header += " " + p.Id
+			if len(p.Attachments) > 0 {
+				header += " attachments: " + strings.Join(p.Attachments, ",")
+			}
+		}
+		fmt.Println(header)
+		for _, l := range strings.Split(renderContent(p.Content, markdown.Options{}), "\n") {
+			fmt.Println("  " + l)
+		}
+		if len(p.Reactions) > 0 {
+			var reactions []string
+			for _, r := range p.Reactions {
+				reactions = append(reactions, fmt.Sprintf("%s %d", r.Name, r.Count))
+			}
+			fmt.Println("  [" + strings.Join(reactions, "] [") + "]")
+		}
+	}
+}
+
+func cliGetAttachment(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify an attachment ID")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a, err := client.GetAttachment(id)
+	if err != nil {
+		log.Fatal(err)
+	}
+	output := c.String("output")
+	if output == "" {
+		output = filepath.Base(a.Name)
+	}
+	var w io.Writer = os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := client.DownloadAttachment(id, w); err != nil {
+		log.Fatal(err)
+	}
+	if output != "-" {
+		log.Infof("Saved %s (%d bytes, sha256 %s)", output, a.Size, a.Checksum)
+	}
+}
+
+func cliDeletePost(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a post ID")
 	}
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := client.DeleteTopic(id); err != nil {
-		log.Fatal(err)
+	version := c.Int("version")
+	if version < 0 {
+		p, err := client.GetPost(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		version = p.Version
+	}
+	if err := client.DeletePost(id, version); err != nil {
+		fatalChanged(err, "post")
 	}
 }
 
-func cliCreateTopic(c *cli.Context) {
-	title := c.String("title")
-	if title == "" {
-		log.Fatal("You must specify a title")
+func cliReact(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a post ID")
+	}
+	name := c.String("name")
+	if name == "" {
+		log.Fatal("You must specify a reaction name")
 	}
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := client.CreateTopic(title); err != nil {
+	reaction, err := client.React(id, name, c.Bool("remove"))
+	if err != nil {
 		log.Fatal(err)
 	}
+	fmt.Printf("%s: %d (%s)\n", reaction.Name, reaction.Count, strings.Join(reaction.Users, ", "))
 }
 
-func cliListTopics(c *cli.Context) {
+func cliCreatePoll(c *cli.Context) {
+	topicId := c.String("topicId")
+	question := c.String("question")
+	if topicId == "" || question == "" {
+		log.Fatal("You must specify a topic id and question")
+	}
+	options := c.StringSlice("option")
+	if len(options) < 2 {
+		log.Fatal("You must specify at least two options")
+	}
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	topics, err := client.GetTopics()
-	if err != nil {
+	if err := client.CreatePoll(topicId, question, options, c.Bool("multiple"), c.Bool("anonymous"), c.String("closes-in")); err != nil {
 		log.Fatal(err)
 	}
-	if len(topics) == 0 {
-		return
+}
+
+func cliVotePoll(c *cli.Context) {
+	id := c.String("id")
+	if id == "" {
+		log.Fatal("You must specify a poll ID")
 	}
-	w := getTableWriter()
-	fmt.Fprint(w, "Title\tID\t\n")
-	for _, t := range topics {
-		fmt.Fprintf(w, "%s\t%v\t\n", t.Title, t.Id)
+	// options are numbered from 1 as shown by polls show
+	var choices []int
+	for _, o := range c.StringSlice("option") {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid option: %s", o)
+		}
+		choices = append(choices, n-1)
 	}
-	w.Flush()
+	if len(choices) == 0 {
+		log.Fatal("You must specify an option")
+	}
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
+	}
+	poll, err := client.Vote(id, choices)
+	if err != nil {
+		log.Fatal(err)
+	}
+	printPoll(poll)
 }
 
-func cliCreatePost(c *cli.Context) {
-	content := c.String("content")
+func cliShowPolls(c *cli.Context) {
+	id := c.String("id")
 	topicId := c.String("topicId")
-	if content == "" || topicId == "" {
-		log.Fatal("You must specify a topic id and content")
+	if id == "" && topicId == "" {
+		log.Fatal("You must specify a poll ID or topic id")
 	}
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := client.CreatePost(topicId, content); err != nil {
-		log.Fatal(err)
+	var polls []*dialogue.Poll
+	if id != "" {
+		poll, err := client.GetPoll(id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		polls = append(polls, poll)
+	} else {
+		polls, err = client.GetPolls(topicId)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	for i, p := range polls {
+		if i > 0 {
+			fmt.Println()
+		}
+		printPoll(p)
 	}
 }
 
-func cliListPosts(c *cli.Context) {
-	topicId := c.String("topicId")
-	showIds := c.Bool("ids")
-	if topicId == "" {
-		log.Fatal("You must specify a topic id")
+func printPoll(p *dialogue.Poll) {
+	status := "open"
+	switch {
+	case p.Closed:
+		status = "closed"
+	case p.ClosesAt != nil:
+		status = "closes " + p.ClosesAt.Local().Format("Jan 2 15:04")
+	}
+	fmt.Printf("%s (%s, %d voters) %s\n", p.Question, status, p.Voters, p.Id)
+	mine := map[int]bool{}
+	for _, i := range p.MyVote {
+		mine[i] = true
 	}
+	w := getTableWriter()
+	for i, r := range p.Results {
+		marker := " "
+		if mine[i] {
+			marker = "*"
+		}
+		fmt.Fprintf(w, "%s %d.\t%s\t%d\t%s\n", marker, i+1, r.Option, r.Votes, strings.Join(r.Voters, ","))
+	}
+	w.Flush()
+}
+
+func cliInbox(c *cli.Context) {
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	posts, err := client.GetPosts(topicId)
+	if c.Bool("read-all") || c.String("read") != "" {
+		if err := client.MarkInboxRead(c.String("read")); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	entries, err := client.GetInbox(!c.Bool("all"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	if len(posts) == 0 {
+	if len(entries) == 0 {
 		return
 	}
 	w := getTableWriter()
-	for _, p := range posts {
-		fmt.Fprintf(w, "%v\t -%s", p.Content, p.Author)
-		if showIds {
-			fmt.Fprintf(w, "\t%s", p.Id)
+	fmt.Fprint(w, "\tFrom\tTopic\tPost\tID\t\n")
+	for _, e := range entries {
+		status := "*"
+		if e.Read {
+			status = " "
 		}
-		fmt.Fprint(w, "\n")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", status, e.Author, e.TopicId, e.PostId, e.Id)
 	}
 	w.Flush()
 }
 
-func cliDeletePost(c *cli.Context) {
-	id := c.String("id")
-	if id == "" {
-		log.Fatal("You must specify a post ID")
+func cliSubscribe(c *cli.Context) {
+	topicId := c.String("topicId")
+	mode := c.String("mode")
+	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
+	if err != nil {
+		log.Fatal(err)
 	}
+	if err := client.Subscribe(topicId, mode); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cliUnsubscribe(c *cli.Context) {
+	topicId := c.String("topicId")
 	client, err := client.NewDialogueClient(URL, USERNAME, TOKEN)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := client.DeletePost(id); err != nil {
+	subs, err := client.GetSubscriptions()
+	if err != nil {
 		log.Fatal(err)
 	}
+	for _, s := range subs {
+		if s.TopicId == topicId {
+			if err := client.DeleteSubscription(s.Id); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+	log.Fatal("You are not subscribed")
 }
 
 func main() {
@@ -235,13 +1182,24 @@ func main() {
 					Action:    cliCreateTopic,
 					Flags: []cli.Flag{
 						cli.StringFlag{"title, t", "", "Topic title"},
+						cli.StringFlag{"category, c", "", "Category ID (default: default)"},
+						cli.BoolFlag{"quiet, q", "Only print the topic ID"},
 					},
 				},
 				{
 					Name:      "delete",
 					ShortName: "d",
-					Usage:     "delete a topic",
+					Usage:     "move a topic to the trash",
 					Action:    cliDeleteTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.IntFlag{"version", -1, "Only change the topic if it is still at this version"},
+					},
+				},
+				{
+					Name:   "show",
+					Usage:  "show a topic and its activity",
+					Action: cliShowTopic,
 					Flags: []cli.Flag{
 						cli.StringFlag{"id, i", "", "Topic ID"},
 					},
@@ -251,6 +1209,98 @@ func main() {
 					ShortName: "l",
 					Usage:     "list topics",
 					Action:    cliListTopics,
+					Flags: []cli.Flag{
+						cli.BoolFlag{"unread, u", "Only show topics with unread posts"},
+						cli.StringSliceFlag{"label, l", &cli.StringSlice{}, "Only show topics with this label (repeatable)"},
+						cli.BoolFlag{"any", "Match topics with any of the labels instead of all"},
+						cli.StringFlag{"category, c", "", "Only show topics in this category"},
+						cli.BoolFlag{"recursive, r", "Include topics in subcategories"},
+						cli.BoolFlag{"archived", "Only show archived topics"},
+					},
+				},
+				{
+					Name:   "archive",
+					Usage:  "archive a topic, making it read-only",
+					Action: cliArchiveTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.BoolFlag{"restore", "Restore an archived topic to active"},
+					},
+				},
+				{
+					Name:   "pin",
+					Usage:  "make a topic sticky so it is listed first",
+					Action: cliPinTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.BoolFlag{"global", "List the topic first in all topic lists (admin only)"},
+						cli.BoolFlag{"remove", "Remove the sticky flag"},
+					},
+				},
+				{
+					Name:      "move",
+					ShortName: "m",
+					Usage:     "move a topic to another category",
+					Action:    cliMoveTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.StringFlag{"category, c", "", "Category ID"},
+					},
+				},
+				{
+					Name:  "label",
+					Usage: "add or remove topic labels",
+					Subcommands: []cli.Command{
+						{
+							Name:   "add",
+							Usage:  "add a label to a topic",
+							Action: cliAddTopicLabel,
+							Flags: []cli.Flag{
+								cli.StringFlag{"id, i", "", "Topic ID"},
+								cli.StringFlag{"label, l", "", "Label name"},
+							},
+						},
+						{
+							Name:   "remove",
+							Usage:  "remove a label from a topic",
+							Action: cliRemoveTopicLabel,
+							Flags: []cli.Flag{
+								cli.StringFlag{"id, i", "", "Topic ID"},
+								cli.StringFlag{"label, l", "", "Label name"},
+							},
+						},
+					},
+				},
+				{
+					Name:      "assign",
+					ShortName: "a",
+					Usage:     "assign users to a topic (no users clears assignees)",
+					Action:    cliAssignTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.StringSliceFlag{"user, u", &cli.StringSlice{}, "Assignee username (repeatable)"},
+					},
+				},
+				{
+					Name:   "due",
+					Usage:  "set the due date and priority of a topic",
+					Action: cliDueTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+						cli.StringFlag{"due, d", "", "Due date (i.e. \"2026-10-20 09:00\")"},
+						cli.StringFlag{"priority, p", "", "Priority (low, normal, high, urgent)"},
+						cli.BoolFlag{"clear", "Remove the due date"},
+						cli.IntFlag{"version", -1, "Only change the topic if it is still at this version"},
+					},
+				},
+				{
+					Name:      "read",
+					ShortName: "r",
+					Usage:     "mark a topic as read",
+					Action:    cliReadTopic,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Topic ID"},
+					},
 				},
 			},
 		},
@@ -267,15 +1317,48 @@ func main() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"topicId, i", "", "Topic ID"},
 						cli.StringFlag{"content, c", "", "Post content"},
+						cli.StringSliceFlag{"attach, a", &cli.StringSlice{}, "Attach a file (repeatable)"},
+						cli.BoolFlag{"draft", "Save as a draft instead of publishing"},
+						cli.StringFlag{"at", "", "Publish at this time (i.e. \"2026-10-20 09:00\")"},
+						cli.BoolFlag{"quiet, q", "Only print the post ID"},
 					},
 				},
 				{
 					Name:      "delete",
 					ShortName: "d",
-					Usage:     "delete a post",
+					Usage:     "move a post to the trash",
 					Action:    cliDeletePost,
 					Flags: []cli.Flag{
 						cli.StringFlag{"id, i", "", "Post ID"},
+						cli.IntFlag{"version", -1, "Only change the post if it is still at this version"},
+					},
+				},
+				{
+					Name:   "show",
+					Usage:  "show a post",
+					Action: cliShowPost,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Post ID"},
+						cli.BoolFlag{"raw", "Show unrendered content"},
+					},
+				},
+				{
+					Name:   "react",
+					Usage:  "add or remove a reaction on a post",
+					Action: cliReact,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Post ID"},
+						cli.StringFlag{"name, n", "", "Reaction (i.e. +1, ack or an emoji)"},
+						cli.BoolFlag{"remove", "Remove the reaction"},
+					},
+				},
+				{
+					Name:   "pin",
+					Usage:  "pin a post to the top of its topic",
+					Action: cliPinPost,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Post ID"},
+						cli.BoolFlag{"remove", "Unpin the post"},
 					},
 				},
 				{
@@ -286,10 +1369,251 @@ func main() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"topicId, i", "", "Topic ID"},
 						cli.BoolFlag{"ids", "Show post ids"},
+						cli.BoolFlag{"raw", "Show unrendered content in a table"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "drafts",
+			Usage: "Draft and Scheduled Post Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "list drafts and scheduled posts",
+					Action:    cliListDrafts,
+				},
+				{
+					Name:   "edit",
+					Usage:  "edit or reschedule a draft",
+					Action: cliEditDraft,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Draft ID"},
+						cli.StringFlag{"content, c", "", "Post content"},
+						cli.StringFlag{"at", "", "Publish at this time (i.e. \"2026-10-20 09:00\")"},
+						cli.BoolFlag{"unschedule", "Keep the post as a draft instead of publishing it"},
+						cli.IntFlag{"version", -1, "Only change the draft if it is still at this version"},
+					},
+				},
+				{
+					Name:   "publish",
+					Usage:  "publish a draft now",
+					Action: cliPublishDraft,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Draft ID"},
+					},
+				},
+				{
+					Name:      "delete",
+					ShortName: "d",
+					Usage:     "delete a draft",
+					Action:    cliDeleteDraft,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Draft ID"},
+						cli.IntFlag{"version", -1, "Only change the draft if it is still at this version"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "polls",
+			Usage: "Poll Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:   "create",
+					Usage:  "create a poll in a topic",
+					Action: cliCreatePoll,
+					Flags: []cli.Flag{
+						cli.StringFlag{"topicId, i", "", "Topic ID"},
+						cli.StringFlag{"question, q", "", "Question"},
+						cli.StringSliceFlag{"option, o", &cli.StringSlice{}, "Option (repeatable)"},
+						cli.BoolFlag{"multiple", "Allow choosing more than one option"},
+						cli.BoolFlag{"anonymous", "Hide who voted for each option"},
+						cli.StringFlag{"closes-in", "", "Close the poll after this long (i.e. 48h)"},
+					},
+				},
+				{
+					Name:   "vote",
+					Usage:  "vote in a poll",
+					Action: cliVotePoll,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Poll ID"},
+						cli.StringSliceFlag{"option, o", &cli.StringSlice{}, "Option number (repeatable for multiple choice polls)"},
+					},
+				},
+				{
+					Name:   "show",
+					Usage:  "show poll results",
+					Action: cliShowPolls,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Poll ID"},
+						cli.StringFlag{"topicId, t", "", "Show all polls in a topic"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "attachments",
+			Usage: "Attachment Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:   "get",
+					Usage:  "download an attachment",
+					Action: cliGetAttachment,
+					Flags: []cli.Flag{
+						cli.StringFlag{"id, i", "", "Attachment ID"},
+						cli.StringFlag{"output, o", "", "Output file (default: the attachment name; - for stdout)"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "trash",
+			Usage: "Trash Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "list deleted topics and posts",
+					Action:    cliListTrash,
+				},
+				{
+					Name:      "restore",
+					ShortName: "r",
+					Usage:     "restore a deleted topic or post",
+					Action:    cliRestoreTrash,
+					Flags: []cli.Flag{
+						cli.StringFlag{"topic, t", "", "Topic ID"},
+						cli.StringFlag{"post, p", "", "Post ID"},
+					},
+				},
+				{
+					Name:   "purge",
+					Usage:  "permanently delete trash (admin only)",
+					Action: cliPurgeTrash,
+					Flags: []cli.Flag{
+						cli.StringFlag{"older-than, o", "", "Only purge items deleted longer ago than this (i.e. 720h)"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "categories",
+			Usage: "Category Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "list categories",
+					Action:    cliListCategories,
+				},
+				{
+					Name:      "create",
+					ShortName: "c",
+					Usage:     "create a category (admin only)",
+					Action:    cliCreateCategory,
+					Flags: []cli.Flag{
+						cli.StringFlag{"name, n", "", "Category name"},
+						cli.StringFlag{"description, d", "", "Category description"},
+						cli.StringFlag{"parent, p", "", "Parent category ID"},
+						cli.StringSliceFlag{"read", &cli.StringSlice{}, "User allowed to read the category (repeatable, default: inherited)"},
+						cli.StringSliceFlag{"post", &cli.StringSlice{}, "User allowed to create topics and posts (repeatable, default: inherited)"},
+						cli.StringSliceFlag{"moderate", &cli.StringSlice{}, "User allowed to pin posts and make topics sticky (repeatable, default: inherited)"},
+					},
+				},
+			},
+		},
+		{
+			Name:  "labels",
+			Usage: "Label Commands",
+			Subcommands: []cli.Command{
+				{
+					Name:      "list",
+					ShortName: "l",
+					Usage:     "list labels",
+					Action:    cliListLabels,
+				},
+				{
+					Name:      "create",
+					ShortName: "c",
+					Usage:     "create a label (admin only)",
+					Action:    cliCreateLabel,
+					Flags: []cli.Flag{
+						cli.StringFlag{"name, n", "", "Label name"},
+						cli.StringFlag{"color, c", "", "Label color (i.e. #ff0000)"},
+						cli.StringFlag{"description, d", "", "Label description"},
+					},
+				},
+				{
+					Name:      "update",
+					ShortName: "u",
+					Usage:     "update a label (admin only)",
+					Action:    cliUpdateLabel,
+					Flags: []cli.Flag{
+						cli.StringFlag{"name, n", "", "Label name"},
+						cli.StringFlag{"rename", "", "New label name"},
+						cli.StringFlag{"color, c", "", "Label color (i.e. #ff0000)"},
+						cli.StringFlag{"description, d", "", "Label description"},
+					},
+				},
+				{
+					Name:      "delete",
+					ShortName: "d",
+					Usage:     "delete a label and remove it from all topics (admin only)",
+					Action:    cliDeleteLabel,
+					Flags: []cli.Flag{
+						cli.StringFlag{"name, n", "", "Label name"},
 					},
 				},
 			},
 		},
+		{
+			Name:   "search",
+			Usage:  "search topics and posts",
+			Action: cliSearch,
+			Flags: []cli.Flag{
+				cli.StringFlag{"query, q", "", "Search query"},
+				cli.StringSliceFlag{"label, l", &cli.StringSlice{}, "Only search topics with this label (repeatable)"},
+				cli.BoolFlag{"any", "Match topics with any of the labels instead of all"},
+			},
+		},
+		{
+			Name:   "todo",
+			Usage:  "show topics assigned to you",
+			Action: cliTodo,
+			Flags: []cli.Flag{
+				cli.BoolFlag{"all, a", "Include closed topics"},
+			},
+		},
+		{
+			Name:      "inbox",
+			ShortName: "i",
+			Usage:     "show mentions (unread only unless --all)",
+			Action:    cliInbox,
+			Flags: []cli.Flag{
+				cli.BoolFlag{"all, a", "Show read entries"},
+				cli.StringFlag{"read, r", "", "Mark an entry as read"},
+				cli.BoolFlag{"read-all", "Mark all entries as read"},
+			},
+		},
+		{
+			Name:   "subscribe",
+			Usage:  "subscribe to new posts by email",
+			Action: cliSubscribe,
+			Flags: []cli.Flag{
+				cli.StringFlag{"topicId, i", "", "Topic ID (default: all topics)"},
+				cli.StringFlag{"mode, m", "daily", "Delivery mode (immediate, hourly, daily)"},
+			},
+		},
+		{
+			Name:   "unsubscribe",
+			Usage:  "unsubscribe from new posts",
+			Action: cliUnsubscribe,
+			Flags: []cli.Flag{
+				cli.StringFlag{"topicId, i", "", "Topic ID (default: all topics)"},
+			},
+		},
 	}
 	// run
 	app.Run(os.Args)
@@ -5,10 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ehazlett/dialogue"
 )
@@ -27,13 +33,12 @@ type (
 	authResponse struct {
 		Token string `json:"token"`
 	}
-	apiError struct {
-		Error string `json:"error"`
-	}
 )
 
+const apiVersion = "/v1"
+
 func Authenticate(baseUrl, username, password string) (string, error) {
-	baseUrl = baseUrl + "/auth"
+	baseUrl = baseUrl + apiVersion + "/auth"
 	resp, err := http.PostForm(baseUrl, url.Values{"username": {username}, "password": {password}})
 	if err != nil {
 		return "", err
@@ -42,6 +47,9 @@ func Authenticate(baseUrl, username, password string) (string, error) {
 	if resp.StatusCode == 401 {
 		return "", ErrLoginFailed
 	}
+	if resp.StatusCode != 200 {
+		return "", getApiErrorFromResponse(resp)
+	}
 	var r authResponse
 	contents, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
@@ -62,19 +70,24 @@ func NewDialogueClient(url, username, token string) (*client, error) {
 	return c, nil
 }
 
-func getApiErrorFromResponse(resp *http.Response) apiError {
+// getApiErrorFromResponse returns an *Error for the error response
+func getApiErrorFromResponse(resp *http.Response) error {
+	defer resp.Body.Close()
 	dec := json.NewDecoder(resp.Body)
-	var apiErr apiError
-	if err := dec.Decode(&apiErr); err != nil {
-		apiErr = apiError{
-			Error: fmt.Sprintf("Unable to parse response: %s", err),
-		}
+	apiErr := &Error{}
+	if err := dec.Decode(apiErr); err != nil {
+		apiErr.Message = fmt.Sprintf("Unable to parse response: %s", err)
+	}
+	apiErr.StatusCode = resp.StatusCode
+	apiErr.Err = errorFromCode(apiErr.Code, resp.StatusCode)
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(s) * time.Second
 	}
 	return apiErr
 }
 
 func (c *client) buildUrl(path string) string {
-	return fmt.Sprintf("%s%s", c.baseUrl, path)
+	return fmt.Sprintf("%s%s%s", c.baseUrl, apiVersion, path)
 }
 
 func (c *client) doRequest(method, path string) (*http.Response, error) {
@@ -92,9 +105,66 @@ func (c *client) doRequest(method, path string) (*http.Response, error) {
 }
 
 func (c *client) postRequest(path string, data url.Values) (*http.Response, error) {
+	return c.formRequest("POST", path, data)
+}
+
+func (c *client) putRequest(path string, data url.Values) (*http.Response, error) {
+	return c.formRequest("PUT", path, data)
+}
+
+// uploadRequest posts the form values and the files at paths as
+// multipart/form-data "file" fields
+func (c *client) uploadRequest(path string, data url.Values, paths []string) (*http.Response, error) {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	for k, vals := range data {
+		for _, v := range vals {
+			if err := w.WriteField(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		part, err := w.CreateFormFile("file", filepath.Base(p))
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{}
+	req, err := http.NewRequest("POST", c.buildUrl(path), body)
+	if err != nil {
+		return nil, err
+	}
+	// add auth headers
+	req.Header.Add("X-Auth-User", c.username)
+	req.Header.Add("X-Auth-Token", c.token)
+	req.Header.Add("Content-Type", w.FormDataContentType())
+	resp, err := client.Do(req)
+	return resp, err
+}
+
+func (c *client) formRequest(method, path string, data url.Values) (*http.Response, error) {
+	return c.versionedRequest(method, path, -1, data)
+}
+
+// versionedRequest sends a form request that only succeeds if the
+// resource is still at version.  A negative version sends the request
+// unconditionally.
+func (c *client) versionedRequest(method, path string, version int, data url.Values) (*http.Response, error) {
 	url := c.buildUrl(path)
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, strings.NewReader(data.Encode()))
+	req, err := http.NewRequest(method, url, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, err
 	}
@@ -102,16 +172,31 @@ func (c *client) postRequest(path string, data url.Values) (*http.Response, erro
 	req.Header.Add("X-Auth-User", c.username)
 	req.Header.Add("X-Auth-Token", c.token)
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if version >= 0 {
+		req.Header.Add("If-Match", fmt.Sprintf("\"%d\"", version))
+	}
 	resp, err := client.Do(req)
 	return resp, err
 }
 
 func (c *client) GetTopics() ([]*dialogue.Topic, error) {
+	return c.getTopics("/topics")
+}
+
+// GetUnreadTopics returns topics with posts the current user has not read
+func (c *client) GetUnreadTopics() ([]*dialogue.Topic, error) {
+	return c.getTopics("/topics?unread=true")
+}
+
+func (c *client) getTopics(path string) ([]*dialogue.Topic, error) {
 	var topics []*dialogue.Topic
-	resp, err := c.doRequest("GET", "/topics")
+	resp, err := c.doRequest("GET", path)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
 	contents, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	cb := bytes.NewBufferString(string(contents))
@@ -122,54 +207,773 @@ func (c *client) GetTopics() ([]*dialogue.Topic, error) {
 	return topics, nil
 }
 
-func (c *client) DeleteTopic(id string) error {
-	resp, err := c.doRequest("DELETE", "/topics/"+id)
+// DeleteTopic moves a topic to the trash if it is still at version
+func (c *client) DeleteTopic(id string, version int) error {
+	resp, err := c.versionedRequest("DELETE", "/topics/"+id, version, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// FindTopics returns topics matching the GET /topics query parameters in
+// filter (i.e. unread, assignee, label, labelMode, category, recursive and
+// archived)
+func (c *client) FindTopics(filter url.Values) ([]*dialogue.Topic, error) {
+	return c.getTopics("/topics?" + filter.Encode())
+}
+
+func (c *client) AddTopicLabel(id string, label string) error {
+	resp, err := c.postRequest("/topics/"+id+"/labels", url.Values{"label": {label}})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+func (c *client) RemoveTopicLabel(id string, label string) error {
+	resp, err := c.doRequest("DELETE", "/topics/"+id+"/labels/"+url.PathEscape(label))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// GetAssignedTopics returns topics assigned to the current user
+func (c *client) GetAssignedTopics() ([]*dialogue.Topic, error) {
+	return c.getTopics("/topics?assignee=me")
+}
+
+// UpdateTopic updates the topic fields present in vals if the topic is
+// still at version.  ErrPreconditionFailed is returned if it has changed.
+func (c *client) UpdateTopic(id string, version int, vals url.Values) error {
+	resp, err := c.versionedRequest("PUT", "/topics/"+id, version, vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// updateTopic updates the current version of a topic
+func (c *client) updateTopic(id string, vals url.Values) error {
+	topic, err := c.GetTopic(id)
+	if err != nil {
+		return err
+	}
+	return c.UpdateTopic(id, topic.Version, vals)
+}
+
+// AssignTopic replaces the assignees of a topic
+func (c *client) AssignTopic(id string, assignees []string) error {
+	if len(assignees) == 0 {
+		// an empty value clears the assignees
+		assignees = []string{""}
+	}
+	return c.updateTopic(id, url.Values{"assignee": assignees})
+}
+
+// ArchiveTopic makes a topic read-only and hides it from topic lists
+func (c *client) ArchiveTopic(id string) error {
+	resp, err := c.postRequest("/topics/"+id+"/archive", url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// UnarchiveTopic restores an archived topic to active
+func (c *client) UnarchiveTopic(id string) error {
+	resp, err := c.doRequest("DELETE", "/topics/"+id+"/archive")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// PinTopic lists a topic first in its category, or in all topic lists if
+// global is true
+func (c *client) PinTopic(id string, global bool) error {
+	scope := dialogue.STICKY_CATEGORY
+	if global {
+		scope = dialogue.STICKY_GLOBAL
+	}
+	resp, err := c.postRequest("/topics/"+id+"/sticky", url.Values{"scope": {scope}})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// UnpinTopic returns a sticky topic to its usual place in topic lists
+func (c *client) UnpinTopic(id string) error {
+	resp, err := c.doRequest("DELETE", "/topics/"+id+"/sticky")
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != 204 {
-		apiErr := getApiErrorFromResponse(resp)
-		return errors.New(apiErr.Error)
+		return getApiErrorFromResponse(resp)
 	}
 	return nil
 }
 
-func (c *client) CreateTopic(title string) error {
+// PinPost pins a post to the top of its topic
+func (c *client) PinPost(id string) error {
+	resp, err := c.postRequest("/posts/"+id+"/pin", url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// UnpinPost unpins a post
+func (c *client) UnpinPost(id string) error {
+	resp, err := c.doRequest("DELETE", "/posts/"+id+"/pin")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// MoveTopic moves a topic to another category
+func (c *client) MoveTopic(id string, categoryId string) error {
+	return c.updateTopic(id, url.Values{"categoryId": {categoryId}})
+}
+
+// MarkTopicRead marks all posts in a topic as read
+func (c *client) MarkTopicRead(id string) error {
+	resp, err := c.postRequest("/topics/"+id+"/read", url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// CreateTopic creates a topic in the category (the default category if
+// categoryId is empty) and returns it
+func (c *client) CreateTopic(title string, categoryId string) (*dialogue.Topic, error) {
 	vals := url.Values{
 		"title": {title},
 	}
+	if categoryId != "" {
+		vals.Set("categoryId", categoryId)
+	}
 	resp, err := c.postRequest("/topics", vals)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 201 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var topic *dialogue.Topic
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&topic); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+// CreatePost creates a post with the files at the paths in attachments
+// attached and returns it
+func (c *client) CreatePost(topicId string, content string, attachments []string) (*dialogue.Post, error) {
+	return c.createPost(topicId, url.Values{"content": {content}}, attachments)
+}
+
+// CreateDraft saves a post that is only visible to its author until it
+// is published.  If publishAt is not nil, the post is published then.
+func (c *client) CreateDraft(topicId string, content string, attachments []string, publishAt *time.Time) (*dialogue.Post, error) {
+	vals := url.Values{
+		"content": {content},
+		"draft":   {"true"},
+	}
+	if publishAt != nil {
+		vals.Set("publishAt", publishAt.Format(time.RFC3339))
+	}
+	return c.createPost(topicId, vals, attachments)
+}
+
+func (c *client) createPost(topicId string, vals url.Values, attachments []string) (*dialogue.Post, error) {
+	var resp *http.Response
+	var err error
+	if len(attachments) > 0 {
+		resp, err = c.uploadRequest("/topics/"+topicId, vals, attachments)
+	} else {
+		resp, err = c.postRequest("/topics/"+topicId, vals)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 201 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var post *dialogue.Post
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// GetTopic returns a topic with its status and activity
+func (c *client) GetTopic(id string) (*dialogue.TopicDetail, error) {
+	var topic *dialogue.TopicDetail
+	resp, err := c.doRequest("GET", "/topics/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&topic); err != nil {
+		return nil, err
+	}
+	return topic, nil
+}
+
+func (c *client) GetPosts(topicId string) ([]*dialogue.Post, error) {
+	return c.getPosts("/topics/" + topicId + "/posts")
+}
+
+// FindPosts returns posts matching the GET /posts query parameters in
+// filter (i.e. author, since, until, topicId and limit)
+func (c *client) FindPosts(filter url.Values) ([]*dialogue.Post, error) {
+	return c.getPosts("/posts?" + filter.Encode())
+}
+
+func (c *client) getPosts(path string) ([]*dialogue.Post, error) {
+	var posts []*dialogue.Post
+	resp, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (c *client) GetPost(id string) (*dialogue.Post, error) {
+	var post *dialogue.Post
+	resp, err := c.doRequest("GET", "/posts/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// DeletePost moves a post to the trash if it is still at version
+func (c *client) DeletePost(id string, version int) error {
+	resp, err := c.versionedRequest("DELETE", "/posts/"+id, version, nil)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != 204 {
-		apiErr := getApiErrorFromResponse(resp)
-		return errors.New(apiErr.Error)
+		return getApiErrorFromResponse(resp)
 	}
 	return nil
 }
 
-func (c *client) CreatePost(topicId string, content string) error {
+// React adds the named reaction to a post, or removes it if remove is
+// true, and returns the updated reaction
+func (c *client) React(postId string, name string, remove bool) (*dialogue.Reaction, error) {
+	method := "POST"
+	if remove {
+		method = "DELETE"
+	}
+	resp, err := c.doRequest(method, "/posts/"+postId+"/reactions/"+url.PathEscape(name))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var reaction *dialogue.Reaction
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&reaction); err != nil {
+		return nil, err
+	}
+	return reaction, nil
+}
+
+func (c *client) GetSubscriptions() ([]*dialogue.Subscription, error) {
+	var subs []*dialogue.Subscription
+	resp, err := c.doRequest("GET", "/subscriptions")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&subs); err != nil {
+		return nil, err
+	}
+	return subs, nil
+}
+
+// Subscribe subscribes to new posts in a topic.  An empty topicId
+// subscribes to all topics.
+func (c *client) Subscribe(topicId string, mode string) error {
 	vals := url.Values{
-		"content": {content},
+		"topicId": {topicId},
+		"mode":    {mode},
 	}
-	resp, err := c.postRequest("/topics/"+topicId, vals)
+	resp, err := c.postRequest("/subscriptions", vals)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != 204 {
-		apiErr := getApiErrorFromResponse(resp)
-		return errors.New(apiErr.Error)
+		return getApiErrorFromResponse(resp)
 	}
 	return nil
 }
 
-func (c *client) GetPosts(topicId string) ([]*dialogue.Post, error) {
+func (c *client) DeleteSubscription(id string) error {
+	resp, err := c.doRequest("DELETE", "/subscriptions/"+id)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+func (c *client) GetInbox(unreadOnly bool) ([]*dialogue.InboxEntry, error) {
+	var entries []*dialogue.InboxEntry
+	path := "/inbox"
+	if unreadOnly {
+		path += "?unread=true"
+	}
+	resp, err := c.doRequest("GET", path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// MarkInboxRead marks an inbox entry as read.  If id is empty, all entries
+// are marked as read.
+func (c *client) MarkInboxRead(id string) error {
+	path := "/inbox/read"
+	if id != "" {
+		path = "/inbox/" + id + "/read"
+	}
+	resp, err := c.postRequest(path, url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+func (c *client) GetLabels() ([]*dialogue.Label, error) {
+	var labels []*dialogue.Label
+	resp, err := c.doRequest("GET", "/labels")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&labels); err != nil {
+		return nil, err
+	}
+	return labels, nil
+}
+
+func (c *client) CreateLabel(name, color, description string) error {
+	vals := url.Values{
+		"name":        {name},
+		"color":       {color},
+		"description": {description},
+	}
+	resp, err := c.postRequest("/labels", vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// UpdateLabel updates the label fields present in vals
+func (c *client) UpdateLabel(name string, vals url.Values) error {
+	resp, err := c.putRequest("/labels/"+url.PathEscape(name), vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+func (c *client) DeleteLabel(name string) error {
+	resp, err := c.doRequest("DELETE", "/labels/"+url.PathEscape(name))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+func (c *client) GetAttachment(id string) (*dialogue.Attachment, error) {
+	resp, err := c.doRequest("GET", "/attachments/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var a *dialogue.Attachment
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// DownloadAttachment writes the contents of an attachment to w
+func (c *client) DownloadAttachment(id string, w io.Writer) error {
+	resp, err := c.doRequest("GET", "/attachments/"+id+"/content")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return getApiErrorFromResponse(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// GetTrash returns the deleted topics and posts the current user can
+// restore
+func (c *client) GetTrash() (*dialogue.Trash, error) {
+	resp, err := c.doRequest("GET", "/trash")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var trash *dialogue.Trash
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&trash); err != nil {
+		return nil, err
+	}
+	return trash, nil
+}
+
+func (c *client) RestoreTopic(id string) error {
+	return c.restore("/trash/topics/" + id + "/restore")
+}
+
+func (c *client) RestorePost(id string) error {
+	return c.restore("/trash/posts/" + id + "/restore")
+}
+
+func (c *client) restore(path string) error {
+	resp, err := c.postRequest(path, url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// PurgeTrash permanently deletes trash older than olderThan (i.e. "720h"),
+// or all trash if olderThan is empty.  It returns the number of items
+// removed.
+func (c *client) PurgeTrash(olderThan string) (int, error) {
+	path := "/trash"
+	if olderThan != "" {
+		path += "?olderThan=" + url.QueryEscape(olderThan)
+	}
+	resp, err := c.doRequest("DELETE", path)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != 200 {
+		return 0, getApiErrorFromResponse(resp)
+	}
+	var res map[string]int
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&res); err != nil {
+		return 0, err
+	}
+	return res["purged"], nil
+}
+
+func (c *client) GetCategories() ([]*dialogue.Category, error) {
+	var cats []*dialogue.Category
+	resp, err := c.doRequest("GET", "/categories")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&cats); err != nil {
+		return nil, err
+	}
+	return cats, nil
+}
+
+// CreateCategory creates a category.  The read, post and moderate lists
+// restrict access to the category; nil inherits the parent's permissions.
+func (c *client) CreateCategory(name, description, parentId string, read, post, moderate []string) error {
+	vals := url.Values{
+		"name":        {name},
+		"description": {description},
+		"parentId":    {parentId},
+	}
+	if read != nil {
+		vals["read"] = read
+	}
+	if post != nil {
+		vals["post"] = post
+	}
+	if moderate != nil {
+		vals["moderate"] = moderate
+	}
+	resp, err := c.postRequest("/categories", vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// GetCategoryTopics returns the topics in a category, including those in
+// subcategories if recursive is true
+func (c *client) GetCategoryTopics(id string, recursive bool) ([]*dialogue.Topic, error) {
+	path := "/categories/" + url.PathEscape(id) + "/topics"
+	if recursive {
+		path += "?recursive=true"
+	}
+	return c.getTopics(path)
+}
+
+// Search returns topics and posts matching query, optionally restricted
+// to topics with all (or any, if matchAny is true) of the labels
+func (c *client) Search(query string, labels []string, matchAny bool) (*dialogue.SearchResult, error) {
+	vals := url.Values{
+		"q":     {query},
+		"label": labels,
+	}
+	if matchAny {
+		vals.Set("labelMode", "or")
+	}
+	resp, err := c.postRequest("/search", vals)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var res *dialogue.SearchResult
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// CreatePoll creates a poll in a topic.  closesIn is an optional duration
+// (i.e. 48h) after which the poll stops accepting votes.
+func (c *client) CreatePoll(topicId string, question string, options []string, multiple bool, anonymous bool, closesIn string) error {
+	vals := url.Values{
+		"question":  {question},
+		"option":    options,
+		"multiple":  {strconv.FormatBool(multiple)},
+		"anonymous": {strconv.FormatBool(anonymous)},
+	}
+	if closesIn != "" {
+		vals.Set("closesIn", closesIn)
+	}
+	resp, err := c.postRequest("/topics/"+topicId+"/polls", vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// GetPolls returns the polls in a topic with their results
+func (c *client) GetPolls(topicId string) ([]*dialogue.Poll, error) {
+	var polls []*dialogue.Poll
+	resp, err := c.doRequest("GET", "/topics/"+topicId+"/polls")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&polls); err != nil {
+		return nil, err
+	}
+	return polls, nil
+}
+
+func (c *client) GetPoll(id string) (*dialogue.Poll, error) {
+	resp, err := c.doRequest("GET", "/polls/"+id)
+	if err != nil {
+		return nil, err
+	}
+	return decodePoll(resp)
+}
+
+// Vote votes for the options (zero based indexes) in a poll, replacing an
+// earlier vote, and returns the updated results
+func (c *client) Vote(id string, choices []int) (*dialogue.Poll, error) {
+	vals := url.Values{}
+	for _, i := range choices {
+		vals.Add("option", strconv.Itoa(i))
+	}
+	resp, err := c.postRequest("/polls/"+id+"/vote", vals)
+	if err != nil {
+		return nil, err
+	}
+	return decodePoll(resp)
+}
+
+func decodePoll(resp *http.Response) (*dialogue.Poll, error) {
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	var poll *dialogue.Poll
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&poll); err != nil {
+		return nil, err
+	}
+	return poll, nil
+}
+
+// GetDrafts returns the user's drafts and scheduled posts
+func (c *client) GetDrafts() ([]*dialogue.Post, error) {
 	var posts []*dialogue.Post
-	resp, err := c.doRequest("GET", "/topics/"+topicId)
+	resp, err := c.doRequest("GET", "/drafts")
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
 	contents, err := ioutil.ReadAll(resp.Body)
 	defer resp.Body.Close()
 	cb := bytes.NewBufferString(string(contents))
@@ -180,14 +984,58 @@ func (c *client) GetPosts(topicId string) ([]*dialogue.Post, error) {
 	return posts, nil
 }
 
-func (c *client) DeletePost(id string) error {
-	resp, err := c.doRequest("DELETE", "/posts/"+id)
+func (c *client) GetDraft(id string) (*dialogue.Post, error) {
+	var post *dialogue.Post
+	resp, err := c.doRequest("GET", "/drafts/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, getApiErrorFromResponse(resp)
+	}
+	contents, err := ioutil.ReadAll(resp.Body)
+	defer resp.Body.Close()
+	cb := bytes.NewBufferString(string(contents))
+	d := json.NewDecoder(cb)
+	if err := d.Decode(&post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
+
+// UpdateDraft updates a draft with the specified values (content,
+// publishAt or draft=true) if it is still at version
+func (c *client) UpdateDraft(id string, version int, vals url.Values) error {
+	resp, err := c.versionedRequest("PUT", "/drafts/"+id, version, vals)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// PublishDraft publishes a draft or scheduled post immediately
+func (c *client) PublishDraft(id string) error {
+	resp, err := c.postRequest("/drafts/"+id+"/publish", url.Values{})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 204 {
+		return getApiErrorFromResponse(resp)
+	}
+	return nil
+}
+
+// DeleteDraft permanently deletes a draft if it is still at version
+func (c *client) DeleteDraft(id string, version int) error {
+	resp, err := c.versionedRequest("DELETE", "/drafts/"+id, version, nil)
 	if err != nil {
 		return err
 	}
 	if resp.StatusCode != 204 {
-		apiErr := getApiErrorFromResponse(resp)
-		return errors.New(apiErr.Error)
+		return getApiErrorFromResponse(resp)
 	}
 	return nil
 }
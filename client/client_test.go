@@ -0,0 +1,156 @@
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// recordServer returns a client for a server that answers every request
+// with status and body and records the escaped request paths
+func recordServer(t *testing.T, status int, body string) (*client, *[]string, func()) {
+	paths := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.EscapedPath())
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	c, err := NewDialogueClient(srv.URL, "alice", "token")
+	if err != nil {
+		t.Fatalf("NewDialogueClient: %s", err)
+	}
+	return c, &paths, srv.Close
+}
+
+func TestLabelPaths(t *testing.T) {
+	c, paths, done := recordServer(t, 204, "")
+	defer done()
+
+	if err := c.RemoveTopicLabel("t1", "needs review"); err != nil {
+		t.Errorf("RemoveTopicLabel: %s", err)
+	}
+	if err := c.UpdateLabel("a+b", nil); err != nil {
+		t.Errorf("UpdateLabel: %s", err)
+	}
+	if err := c.DeleteLabel("a?b"); err != nil {
+		t.Errorf("DeleteLabel: %s", err)
+	}
+	want := []string{
+		"DELETE /v1/topics/t1/labels/needs%20review",
+		"PUT /v1/labels/a+b",
+		"DELETE /v1/labels/a%3Fb",
+	}
+	if len(*paths) != len(want) {
+		t.Fatalf("requests = %v, want %v", *paths, want)
+	}
+	for i, p := range *paths {
+		if p != want[i] {
+			t.Errorf("request %d = %q, want %q", i, p, want[i])
+		}
+	}
+}
+
+func TestReactPath(t *testing.T) {
+	c, paths, done := recordServer(t, 200, `{"name":"\u2764\ufe0f","count":1}`)
+	defer done()
+
+	if _, err := c.React("p1", "\u2764\ufe0f", false); err != nil {
+		t.Errorf("React: %s", err)
+	}
+	if _, err := c.React("p1", "+1", true); err != nil {
+		t.Errorf("React: %s", err)
+	}
+	want := []string{
+		"POST /v1/posts/p1/reactions/%E2%9D%A4%EF%B8%8F",
+		"DELETE /v1/posts/p1/reactions/+1",
+	}
+	if strings.Join(*paths, "\n") != strings.Join(want, "\n") {
+		t.Errorf("requests = %v, want %v", *paths, want)
+	}
+}
+
+func TestGettersCheckStatus(t *testing.T) {
+	c, _, done := recordServer(t, 401, `{"code":"unauthorized","message":"invalid token"}`)
+	defer done()
+
+	getters := map[string]func() error{
+		"GetTopics":        func() error { _, err := c.GetTopics(); return err },
+		"GetSubscriptions": func() error { _, err := c.GetSubscriptions(); return err },
+		"GetInbox":         func() error { _, err := c.GetInbox(false); return err },
+		"GetLabels":        func() error { _, err := c.GetLabels(); return err },
+		"GetCategories":    func() error { _, err := c.GetCategories(); return err },
+		"GetPoll":          func() error { _, err := c.GetPoll("p1"); return err },
+	}
+	for name, get := range getters {
+		if err := get(); Cause(err) != ErrUnauthorized {
+			t.Errorf("%s returned %v, want ErrUnauthorized", name, err)
+		}
+	}
+}
+
+func TestCreateTopic(t *testing.T) {
+	c, paths, done := recordServer(t, 201, `{"id":"t1","title":"Release planning","categoryId":"general"}`)
+	defer done()
+
+	topic, err := c.CreateTopic("Release planning", "")
+	if err != nil {
+		t.Fatalf("CreateTopic: %s", err)
+	}
+	if topic.Id != "t1" || topic.Title != "Release planning" {
+		t.Errorf("CreateTopic = %+v", topic)
+	}
+	if len(*paths) != 1 || (*paths)[0] != "POST /v1/topics" {
+		t.Errorf("requests = %v", *paths)
+	}
+}
+
+func TestCreateTopicConflict(t *testing.T) {
+	c, _, done := recordServer(t, 409, `{"code":"conflict","message":"topic exists"}`)
+	defer done()
+
+	if topic, err := c.CreateTopic("Release planning", ""); topic != nil || Cause(err) != ErrConflict {
+		t.Errorf("CreateTopic = %v, %v, want ErrConflict", topic, err)
+	}
+}
+
+func TestCreatePost(t *testing.T) {
+	c, paths, done := recordServer(t, 201, `{"id":"p1","topicId":"t1","content":"hello"}`)
+	defer done()
+
+	post, err := c.CreatePost("t1", "hello", nil)
+	if err != nil {
+		t.Fatalf("CreatePost: %s", err)
+	}
+	if post.Id != "p1" || post.TopicId != "t1" {
+		t.Errorf("CreatePost = %+v", post)
+	}
+	if len(*paths) != 1 || (*paths)[0] != "POST /v1/topics/t1" {
+		t.Errorf("requests = %v", *paths)
+	}
+}
+
+func TestGetTopicAndPost(t *testing.T) {
+	c, paths, done := recordServer(t, 200, `{"id":"x1","title":"Release planning","status":"closed","postCount":3,"topicId":"t1"}`)
+	defer done()
+
+	topic, err := c.GetTopic("x1")
+	if err != nil {
+		t.Fatalf("GetTopic: %s", err)
+	}
+	if topic.Id != "x1" || topic.Status != "closed" || topic.PostCount != 3 {
+		t.Errorf("GetTopic = %+v", topic)
+	}
+	post, err := c.GetPost("x1")
+	if err != nil {
+		t.Fatalf("GetPost: %s", err)
+	}
+	if post.Id != "x1" || post.TopicId != "t1" {
+		t.Errorf("GetPost = %+v", post)
+	}
+	want := "GET /v1/topics/x1,GET /v1/posts/x1"
+	if got := strings.Join(*paths, ","); got != want {
+		t.Errorf("requests = %s, want %s", got, want)
+	}
+}
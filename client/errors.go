@@ -0,0 +1,110 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Errors returned by the api.  Use Cause to get the kind of an error
+// returned by the client.
+var (
+	ErrBadRequest         = errors.New("bad request")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrForbidden          = errors.New("forbidden")
+	ErrNotFound           = errors.New("not found")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrVersionRequired    = errors.New("version required")
+	ErrTooLarge           = errors.New("request too large")
+	ErrInvalidRequest     = errors.New("invalid request")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrServer             = errors.New("server error")
+	ErrUnavailable        = errors.New("service unavailable")
+)
+
+var errorCodes = map[string]error{
+	"bad_request":           ErrBadRequest,
+	"unauthorized":          ErrUnauthorized,
+	"forbidden":             ErrForbidden,
+	"not_found":             ErrNotFound,
+	"conflict":              ErrConflict,
+	"precondition_failed":   ErrPreconditionFailed,
+	"precondition_required": ErrVersionRequired,
+	"too_large":             ErrTooLarge,
+	"invalid_request":       ErrInvalidRequest,
+	"rate_limited":          ErrRateLimited,
+	"internal_error":        ErrServer,
+	"unavailable":           ErrUnavailable,
+}
+
+// statusErrors are used for responses without a known code
+var statusErrors = map[int]error{
+	400: ErrBadRequest,
+	401: ErrUnauthorized,
+	403: ErrForbidden,
+	404: ErrNotFound,
+	409: ErrConflict,
+	412: ErrPreconditionFailed,
+	413: ErrTooLarge,
+	422: ErrInvalidRequest,
+	428: ErrVersionRequired,
+	429: ErrRateLimited,
+	503: ErrUnavailable,
+}
+
+// Error is an error response from the api.  Err is the Err* value for
+// the error code.  RetryAfter is set for ErrRateLimited.
+type Error struct {
+	Err        error             `json:"-"`
+	StatusCode int               `json:"-"`
+	RetryAfter time.Duration     `json:"-"`
+	Code       string            `json:"code"`
+	Message    string            `json:"message"`
+	Details    map[string]string `json:"details"`
+	RequestId  string            `json:"requestId"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Err.Error()
+	}
+	if len(e.Details) > 0 {
+		fields := []string{}
+		for k, v := range e.Details {
+			fields = append(fields, fmt.Sprintf("%s: %s", k, v))
+		}
+		sort.Strings(fields)
+		msg = fmt.Sprintf("%s (%s)", msg, strings.Join(fields, ", "))
+	}
+	return msg
+}
+
+// Is reports whether target is the kind of the error
+func (e *Error) Is(target error) bool {
+	return e.Err == target
+}
+
+// Cause returns the Err* value for errors from the api and err otherwise
+func Cause(err error) error {
+	if e, ok := err.(*Error); ok {
+		return e.Err
+	}
+	return err
+}
+
+func errorFromCode(code string, status int) error {
+	if err, ok := errorCodes[code]; ok {
+		return err
+	}
+	if err, ok := statusErrors[status]; ok {
+		return err
+	}
+	if status >= 500 {
+		return ErrServer
+	}
+	return ErrBadRequest
+}
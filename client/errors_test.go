@@ -0,0 +1,83 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorFromCode(t *testing.T) {
+	tests := []struct {
+		code   string
+		status int
+		want   error
+	}{
+		{"rate_limited", 429, ErrRateLimited},
+		{"not_found", 400, ErrNotFound},
+		{"precondition_required", 428, ErrVersionRequired},
+		{"", 401, ErrUnauthorized},
+		{"unknown", 409, ErrConflict},
+		{"", 500, ErrServer},
+		{"", 502, ErrServer},
+		{"", 503, ErrUnavailable},
+		{"", 418, ErrBadRequest},
+	}
+	for _, test := range tests {
+		if got := errorFromCode(test.code, test.status); got != test.want {
+			t.Errorf("errorFromCode(%q, %d) = %v, want %v", test.code, test.status, got, test.want)
+		}
+	}
+}
+
+func TestGetApiErrorFromResponse(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 429,
+		Header:     http.Header{"Retry-After": {"7"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"code":"rate_limited","message":"slow down","requestId":"r1"}`)),
+	}
+	err := getApiErrorFromResponse(resp)
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("error %T is not an *Error", err)
+	}
+	if e.Err != ErrRateLimited || e.StatusCode != 429 || e.RetryAfter != 7*time.Second || e.RequestId != "r1" {
+		t.Errorf("error = %+v", e)
+	}
+	if Cause(err) != ErrRateLimited || !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer) {
+		t.Errorf("%v is not only ErrRateLimited", err)
+	}
+	if Cause(fmt.Errorf("other")) == nil {
+		t.Errorf("Cause dropped an error that is not from the api")
+	}
+
+	resp = &http.Response{
+		StatusCode: 502,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader("<html>bad gateway</html>")),
+	}
+	err = getApiErrorFromResponse(resp)
+	if Cause(err) != ErrServer || !strings.HasPrefix(err.Error(), "Unable to parse response") {
+		t.Errorf("unparsable response: %v (%v)", err, Cause(err))
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want string
+	}{
+		{&Error{Err: ErrNotFound, Message: "topic not found"}, "topic not found"},
+		{&Error{Err: ErrNotFound}, "not found"},
+		{&Error{Err: ErrInvalidRequest, Message: "invalid request", Details: map[string]string{"title": "required", "due": "must be a time"}},
+			"invalid request (due: must be a time, title: required)"},
+	}
+	for _, test := range tests {
+		if got := test.err.Error(); got != test.want {
+			t.Errorf("Error() = %q, want %q", got, test.want)
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package dialogue
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 type (
 	Authorization struct {
@@ -11,19 +14,421 @@ type (
 	User struct {
 		Id       string `json:"id" gorethink:"id,omitempty"`
 		Username string `json:"username" gorethink:"username"`
-		Password string `json:"password" gorethink:"password"`
+		Password string `json:"-" gorethink:"password"`
+		Email    string `json:"email" gorethink:"email"`
+		Version  int    `json:"version" gorethink:"version"`
 	}
 	Topic struct {
-		Id      string    `json:"id" gorethink:"id,omitempty"`
-		Title   string    `json:"title" gorethink:"title"`
-		Closed  bool      `json:"closed" gorethink:"closed"`
-		Created time.Time `json:"created" gorethink:"created"`
+		Id                  string     `json:"id" gorethink:"id,omitempty"`
+		Title               string     `json:"title" gorethink:"title"`
+		Closed              bool       `json:"closed" gorethink:"closed"`
+		Created             time.Time  `json:"created" gorethink:"created"`
+		Assignees           []string   `json:"assignees" gorethink:"assignees"`
+		Due                 *time.Time `json:"due,omitempty" gorethink:"due,omitempty"`
+		Priority            string     `json:"priority" gorethink:"priority"`
+		Labels              []string   `json:"labels" gorethink:"labels"`
+		CategoryId          string     `json:"categoryId" gorethink:"categoryId"`
+		Archived            bool       `json:"archived" gorethink:"archived"`
+		ArchivedAt          *time.Time `json:"archivedAt,omitempty" gorethink:"archivedAt,omitempty"`
+		Sticky              string     `json:"sticky,omitempty" gorethink:"sticky,omitempty"`
+		DeletedAt           *time.Time `json:"deletedAt,omitempty" gorethink:"deletedAt,omitempty"`
+		DeletedBy           string     `json:"deletedBy,omitempty" gorethink:"deletedBy,omitempty"`
+		DueReminderSent     bool       `json:"-" gorethink:"dueReminderSent,omitempty"`
+		OverdueReminderSent bool       `json:"-" gorethink:"overdueReminderSent,omitempty"`
+		UnreadCount         int        `json:"unreadCount" gorethink:"-"`
+		HasUnread           bool       `json:"hasUnread" gorethink:"-"`
+		Version             int        `json:"version" gorethink:"version"`
 	}
 	Post struct {
-		Id      string    `json:"id" gorethink:"id,omitempty"`
-		TopicId string    `json:"topicId" gorethink:"topicId"`
-		Author  string    `json:"author" gorethink:"author"`
-		Content string    `json:"content" gorethink:"content"`
-		Created time.Time `json:"created" gorethink:"created"`
+		Id          string     `json:"id" gorethink:"id,omitempty"`
+		TopicId     string     `json:"topicId" gorethink:"topicId"`
+		Author      string     `json:"author" gorethink:"author"`
+		Content     string     `json:"content" gorethink:"content"`
+		Mentions    []string   `json:"mentions,omitempty" gorethink:"mentions"`
+		Attachments []string   `json:"attachments,omitempty" gorethink:"attachments,omitempty"`
+		Status      string     `json:"status,omitempty" gorethink:"status,omitempty"`
+		PublishAt   *time.Time `json:"publishAt,omitempty" gorethink:"publishAt,omitempty"`
+		Updated     *time.Time `json:"updated,omitempty" gorethink:"updated,omitempty"`
+		Pinned      bool       `json:"pinned" gorethink:"pinned"`
+		PinnedBy    string     `json:"pinnedBy,omitempty" gorethink:"pinnedBy,omitempty"`
+		Created     time.Time  `json:"created" gorethink:"created"`
+		DeletedAt   *time.Time `json:"deletedAt,omitempty" gorethink:"deletedAt,omitempty"`
+		DeletedBy   string     `json:"deletedBy,omitempty" gorethink:"deletedBy,omitempty"`
+		// Html caches the rendered content; HtmlHash identifies the content
+		// (and renderer version) it was rendered from
+		Html     string `json:"-" gorethink:"html,omitempty"`
+		HtmlHash string `json:"-" gorethink:"htmlHash,omitempty"`
+		// Unannounced is set when a draft or scheduled post is published
+		// and cleared by whoever announces it
+		Unannounced bool `json:"-" gorethink:"unannounced,omitempty"`
+		// ReactionUsers holds the users for each reaction; Reactions is
+		// the summary returned by the api
+		ReactionUsers map[string][]string `json:"-" gorethink:"reactions,omitempty"`
+		Reactions     []*Reaction         `json:"reactions,omitempty" gorethink:"-"`
+		Version       int                 `json:"version" gorethink:"version"`
+	}
+	Reaction struct {
+		Name  string   `json:"name"`
+		Count int      `json:"count"`
+		Users []string `json:"users"`
+	}
+	// Poll is a question attached to a topic.  Votes holds the options
+	// chosen by each user; the results are computed from it by Tally.
+	Poll struct {
+		Id        string           `json:"id" gorethink:"id,omitempty"`
+		TopicId   string           `json:"topicId" gorethink:"topicId"`
+		Question  string           `json:"question" gorethink:"question"`
+		Options   []string         `json:"options" gorethink:"options"`
+		Multiple  bool             `json:"multiple" gorethink:"multiple"`
+		Anonymous bool             `json:"anonymous" gorethink:"anonymous"`
+		ClosesAt  *time.Time       `json:"closesAt,omitempty" gorethink:"closesAt,omitempty"`
+		Author    string           `json:"author" gorethink:"author"`
+		Created   time.Time        `json:"created" gorethink:"created"`
+		Votes     map[string][]int `json:"-" gorethink:"votes"`
+		Results   []*PollResult    `json:"results" gorethink:"-"`
+		Voters    int              `json:"voters" gorethink:"-"`
+		Closed    bool             `json:"closed" gorethink:"-"`
+		MyVote    []int            `json:"myVote,omitempty" gorethink:"-"`
+	}
+	PollResult struct {
+		Option string   `json:"option"`
+		Votes  int      `json:"votes"`
+		Voters []string `json:"voters,omitempty"`
+	}
+	ReactionEvent struct {
+		PostId   string `json:"postId"`
+		TopicId  string `json:"topicId"`
+		Name     string `json:"name"`
+		Username string `json:"username"`
+		Count    int    `json:"count"`
+	}
+	// Attachment describes a file attached to a post.  The contents are
+	// kept in a blob store under Key.
+	Attachment struct {
+		Id          string    `json:"id" gorethink:"id,omitempty"`
+		PostId      string    `json:"postId" gorethink:"postId"`
+		Name        string    `json:"name" gorethink:"name"`
+		Size        int64     `json:"size" gorethink:"size"`
+		ContentType string    `json:"contentType" gorethink:"contentType"`
+		Checksum    string    `json:"checksum" gorethink:"checksum"`
+		Uploader    string    `json:"uploader" gorethink:"uploader"`
+		Key         string    `json:"-" gorethink:"key"`
+		Created     time.Time `json:"created" gorethink:"created"`
+	}
+	// InboxEntry notifies a user of activity that involves them, such as
+	// being mentioned in a post
+	InboxEntry struct {
+		Id       string    `json:"id" gorethink:"id,omitempty"`
+		Username string    `json:"username" gorethink:"username"`
+		Kind     string    `json:"kind" gorethink:"kind"`
+		TopicId  string    `json:"topicId" gorethink:"topicId"`
+		PostId   string    `json:"postId" gorethink:"postId"`
+		Author   string    `json:"author" gorethink:"author"`
+		Message  string    `json:"message,omitempty" gorethink:"message"`
+		Read     bool      `json:"read" gorethink:"read"`
+		Created  time.Time `json:"created" gorethink:"created"`
+	}
+	// Label categorizes topics.  Labels are managed by admins and attached
+	// to topics by name.
+	Label struct {
+		Id          string    `json:"id" gorethink:"id,omitempty"`
+		Name        string    `json:"name" gorethink:"name"`
+		Color       string    `json:"color" gorethink:"color"`
+		Description string    `json:"description" gorethink:"description"`
+		Created     time.Time `json:"created" gorethink:"created"`
+	}
+	// Category groups topics.  Categories can be nested by setting
+	// ParentId.
+	Category struct {
+		Id          string       `json:"id" gorethink:"id,omitempty"`
+		Name        string       `json:"name" gorethink:"name"`
+		Description string       `json:"description" gorethink:"description"`
+		ParentId    string       `json:"parentId" gorethink:"parentId"`
+		Permissions *Permissions `json:"permissions,omitempty" gorethink:"permissions,omitempty"`
+		Created     time.Time    `json:"created" gorethink:"created"`
+	}
+	// Permissions restrict who can read and post in a category's topics.
+	// An empty list allows all users.  Moderators can pin posts and make
+	// topics sticky; an empty list leaves moderation to admin.  Categories
+	// without permissions inherit them from their parent.
+	Permissions struct {
+		Read     []string `json:"read" gorethink:"read"`
+		Post     []string `json:"post" gorethink:"post"`
+		Moderate []string `json:"moderate" gorethink:"moderate"`
+	}
+	// TopicDetail is a topic with a summary of its activity.  Status is
+	// open, closed or archived.
+	TopicDetail struct {
+		*Topic
+		Status       string     `json:"status"`
+		PostCount    int        `json:"postCount"`
+		LastActivity *time.Time `json:"lastActivity,omitempty"`
+	}
+	// SearchResult is returned by search queries
+	SearchResult struct {
+		Topics []*Topic `json:"topics"`
+		Posts  []*Post  `json:"posts"`
+	}
+	// Trash holds deleted topics and posts until they are restored or
+	// purged
+	Trash struct {
+		Topics []*Topic `json:"topics"`
+		Posts  []*Post  `json:"posts"`
+	}
+	// ReadMarker records the last time a user read a topic
+	ReadMarker struct {
+		Id       string    `json:"id" gorethink:"id,omitempty"`
+		Username string    `json:"username" gorethink:"username"`
+		TopicId  string    `json:"topicId" gorethink:"topicId"`
+		LastRead time.Time `json:"lastRead" gorethink:"lastRead"`
+	}
+	// Event is sent to clients of the realtime event stream
+	Event struct {
+		Type string      `json:"type"`
+		Data interface{} `json:"data"`
+	}
+	// Subscription delivers new posts to a user by email.  An empty
+	// TopicId subscribes the user to all topics.
+	Subscription struct {
+		Id               string    `json:"id" gorethink:"id,omitempty"`
+		Username         string    `json:"username" gorethink:"username"`
+		TopicId          string    `json:"topicId" gorethink:"topicId"`
+		Mode             string    `json:"mode" gorethink:"mode"`
+		UnsubscribeToken string    `json:"-" gorethink:"unsubscribeToken"`
+		LastSent         time.Time `json:"lastSent" gorethink:"lastSent"`
+		Created          time.Time `json:"created" gorethink:"created"`
+	}
+	// AuditEntry records a security relevant action.  Actor is empty for
+	// actions by clients that are not logged in (i.e. failed logins).
+	AuditEntry struct {
+		Id         string            `json:"id" gorethink:"id,omitempty"`
+		Created    time.Time         `json:"created" gorethink:"created"`
+		Action     string            `json:"action" gorethink:"action"`
+		Actor      string            `json:"actor" gorethink:"actor"`
+		Target     string            `json:"target" gorethink:"target"`
+		RemoteAddr string            `json:"remoteAddr" gorethink:"remoteAddr"`
+		RequestId  string            `json:"requestId" gorethink:"requestId"`
+		Details    map[string]string `json:"details,omitempty" gorethink:"details,omitempty"`
 	}
+	// RateBucket is a token bucket used for rate limiting.  Tokens refill
+	// continuously up to the capacity of the bucket.
+	RateBucket struct {
+		Key     string    `json:"key" gorethink:"id"`
+		Tokens  float64   `json:"tokens" gorethink:"tokens"`
+		Updated time.Time `json:"updated" gorethink:"updated"`
+		Version int       `json:"version" gorethink:"version"`
+	}
+)
+
+const (
+	INBOX_MENTION  = "mention"
+	INBOX_REMINDER = "reminder"
+
+	EVENT_TOPIC_CREATED = "topic.created"
+	EVENT_POST_CREATED  = "post.created"
+	EVENT_INBOX_CREATED = "inbox.created"
+
+	EVENT_REACTION_ADDED   = "reaction.added"
+	EVENT_REACTION_REMOVED = "reaction.removed"
+	EVENT_POLL_CREATED     = "poll.created"
+	EVENT_POLL_VOTED       = "poll.voted"
+)
+
+const (
+	DELIVERY_IMMEDIATE = "immediate"
+	DELIVERY_HOURLY    = "hourly"
+	DELIVERY_DAILY     = "daily"
+)
+
+const (
+	DEFAULT_CATEGORY = "default"
+)
+
+const (
+	// unpublished posts are only visible to their author.  Scheduled posts
+	// are published at PublishAt.
+	POST_DRAFT     = "draft"
+	POST_SCHEDULED = "scheduled"
+)
+
+const (
+	// sticky topics are listed first in their category, or in all lists
+	STICKY_CATEGORY = "category"
+	STICKY_GLOBAL   = "global"
+)
+
+const (
+	TOPIC_OPEN     = "open"
+	TOPIC_CLOSED   = "closed"
+	TOPIC_ARCHIVED = "archived"
 )
+
+const (
+	AUDIT_LOGIN               = "auth.login"
+	AUDIT_LOGIN_FAILED        = "auth.login_failed"
+	AUDIT_USER_CREATED        = "user.created"
+	AUDIT_USER_UPDATED        = "user.updated"
+	AUDIT_USER_DENIED         = "user.update_denied"
+	AUDIT_TOPIC_DELETED       = "topic.deleted"
+	AUDIT_POST_DELETED        = "post.deleted"
+	AUDIT_CATEGORY_DELETED    = "category.deleted"
+	AUDIT_LABEL_DELETED       = "label.deleted"
+	AUDIT_TRASH_PURGED        = "trash.purged"
+	AUDIT_PERMISSIONS_CHANGED = "category.permissions_changed"
+)
+
+const (
+	PRIORITY_LOW    = "low"
+	PRIORITY_NORMAL = "normal"
+	PRIORITY_HIGH   = "high"
+	PRIORITY_URGENT = "urgent"
+)
+
+// ValidPriority returns true if priority is a supported topic priority
+func ValidPriority(priority string) bool {
+	switch priority {
+	case PRIORITY_LOW, PRIORITY_NORMAL, PRIORITY_HIGH, PRIORITY_URGENT:
+		return true
+	}
+	return false
+}
+
+// SummarizeReactions sets Reactions from ReactionUsers, most used first
+func (p *Post) SummarizeReactions() {
+	p.Reactions = nil
+	for name, users := range p.ReactionUsers {
+		if len(users) == 0 {
+			continue
+		}
+		p.Reactions = append(p.Reactions, &Reaction{
+			Name:  name,
+			Count: len(users),
+			Users: users,
+		})
+	}
+	sort.Sort(byReactionCount(p.Reactions))
+}
+
+type byReactionCount []*Reaction
+
+func (r byReactionCount) Len() int      { return len(r) }
+func (r byReactionCount) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byReactionCount) Less(i, j int) bool {
+	if r[i].Count != r[j].Count {
+		return r[i].Count > r[j].Count
+	}
+	return r[i].Name < r[j].Name
+}
+
+// Take refills the bucket for the time since it was last updated, at rate
+// tokens per second up to capacity, and takes a token if one is left.  It
+// returns false if the bucket is empty.
+func (b *RateBucket) Take(capacity, rate float64, now time.Time) bool {
+	if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens += elapsed * rate
+	}
+	if b.Tokens > capacity {
+		b.Tokens = capacity
+	}
+	b.Updated = now
+	if b.Tokens < 1 {
+		return false
+	}
+	b.Tokens--
+	return true
+}
+
+// IsClosed returns true if the poll no longer accepts votes
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosesAt != nil && !now.Before(*p.ClosesAt)
+}
+
+// Tally computes the results of the poll.  Voters are only listed for
+// polls that are not anonymous; MyVote is set to the options chosen by
+// username.
+func (p *Poll) Tally(username string, now time.Time) {
+	p.Results = make([]*PollResult, len(p.Options))
+	for i, o := range p.Options {
+		p.Results[i] = &PollResult{Option: o}
+	}
+	voters := make([]string, 0, len(p.Votes))
+	for u := range p.Votes {
+		voters = append(voters, u)
+	}
+	sort.Strings(voters)
+	for _, u := range voters {
+		for _, i := range p.Votes[u] {
+			if i < 0 || i >= len(p.Results) {
+				continue
+			}
+			p.Results[i].Votes++
+			if !p.Anonymous {
+				p.Results[i].Voters = append(p.Results[i].Voters, u)
+			}
+		}
+	}
+	p.Voters = len(voters)
+	p.Closed = p.IsClosed(now)
+	p.MyVote = p.Votes[username]
+}
+
+// IsAssigned returns true if username is assigned to the topic
+func (t *Topic) IsAssigned(username string) bool {
+	for _, a := range t.Assignees {
+		if a == username {
+			return true
+		}
+	}
+	return false
+}
+
+// HasLabel returns true if the label is attached to the topic
+func (t *Topic) HasLabel(name string) bool {
+	for _, l := range t.Labels {
+		if l == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOverdue returns true if the topic is open and past its due date
+func (t *Topic) IsOverdue(now time.Time) bool {
+	return !t.Closed && t.Due != nil && t.Due.Before(now)
+}
+
+// CanRead returns true if username may read topics
+func (p *Permissions) CanRead(username string) bool {
+	return p == nil || allowed(p.Read, username)
+}
+
+// CanPost returns true if username may create topics and posts
+func (p *Permissions) CanPost(username string) bool {
+	return p == nil || allowed(p.Post, username)
+}
+
+// CanModerate returns true if username may pin posts and make topics sticky
+func (p *Permissions) CanModerate(username string) bool {
+	return p != nil && len(p.Moderate) > 0 && allowed(p.Moderate, username)
+}
+
+func allowed(users []string, username string) bool {
+	if len(users) == 0 {
+		return true
+	}
+	for _, u := range users {
+		if u == username {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidDeliveryMode returns true if mode is a supported subscription mode
+func ValidDeliveryMode(mode string) bool {
+	switch mode {
+	case DELIVERY_IMMEDIATE, DELIVERY_HOURLY, DELIVERY_DAILY:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package dialogue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTopicDue(t *testing.T) {
+	now := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+	tests := []struct {
+		name    string
+		topic   *Topic
+		overdue bool
+	}{
+		{"no due date", &Topic{}, false},
+		{"due later", &Topic{Due: &future}, false},
+		{"due now", &Topic{Due: &now}, false},
+		{"past due", &Topic{Due: &past}, true},
+		{"closed", &Topic{Due: &past, Closed: true}, false},
+	}
+	for _, test := range tests {
+		if got := test.topic.IsOverdue(now); got != test.overdue {
+			t.Errorf("%s: IsOverdue = %v, want %v", test.name, got, test.overdue)
+		}
+	}
+	topic := &Topic{Assignees: []string{"alice", "bob"}}
+	if !topic.IsAssigned("bob") || topic.IsAssigned("carol") {
+		t.Errorf("IsAssigned does not match the assignees %v", topic.Assignees)
+	}
+}
+
+func TestPollTally(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &Poll{
+		Options:  []string{"a", "b", "c"},
+		ClosesAt: &now,
+		Votes: map[string][]int{
+			"bob":   {0, 1},
+			"alice": {1},
+			"carol": {1, 7},
+		},
+	}
+	p.Tally("alice", now)
+	want := []int{1, 3, 0}
+	for i, r := range p.Results {
+		if r.Votes != want[i] {
+			t.Errorf("option %d has %d votes, want %d", i, r.Votes, want[i])
+		}
+	}
+	if got := p.Results[1].Voters; len(got) != 3 || got[0] != "alice" || got[2] != "carol" {
+		t.Errorf("option 1 voters = %v, want sorted voters", got)
+	}
+	if p.Voters != 3 || !p.Closed || len(p.MyVote) != 1 || p.MyVote[0] != 1 {
+		t.Errorf("voters %d, closed %v, my vote %v", p.Voters, p.Closed, p.MyVote)
+	}
+
+	p.Anonymous = true
+	p.Tally("dave", now.Add(-time.Second))
+	if p.Results[1].Voters != nil || p.Closed || p.MyVote != nil {
+		t.Errorf("anonymous open poll: voters %v, closed %v, my vote %v", p.Results[1].Voters, p.Closed, p.MyVote)
+	}
+}
+
+func TestRateBucketTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    time.Duration
+		ok         bool
+		wantTokens float64
+	}{
+		{"full", 5, 0, true, 4},
+		{"last token", 1, 0, true, 0},
+		{"empty", 0, 0, false, 0},
+		{"partial token", 0.5, 0, false, 0.5},
+		{"refilled", 0, 2 * time.Second, true, 1},
+		{"refill capped", 4, time.Minute, true, 4},
+		{"clock went back", 2, -time.Second, true, 1},
+	}
+	for _, test := range tests {
+		b := &RateBucket{Tokens: test.tokens, Updated: start}
+		now := start.Add(test.elapsed)
+		if ok := b.Take(5, 1, now); ok != test.ok {
+			t.Errorf("%s: Take = %v, want %v", test.name, ok, test.ok)
+		}
+		if b.Tokens != test.wantTokens {
+			t.Errorf("%s: %v tokens left, want %v", test.name, b.Tokens, test.wantTokens)
+		}
+		if !b.Updated.Equal(now) {
+			t.Errorf("%s: updated %s, want %s", test.name, b.Updated, now)
+		}
+	}
+}
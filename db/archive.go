@@ -0,0 +1,71 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// getLastPostTimes returns the time of the latest post in each topic
+func (s *Rethinkdb) getLastPostTimes() (map[string]time.Time, error) {
+	times := map[string]time.Time{}
+	res, err := rdb.Table(POST_TABLE).Filter(notDeleted()).Filter(published()).Pluck("topicId", "created").Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get posts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		if p.Created.After(times[p.TopicId]) {
+			times[p.TopicId] = p.Created
+		}
+	}
+	return times, nil
+}
+
+// ArchiveTopics archives active topics created before createdBefore and
+// with no posts since inactiveSince.  A zero time ignores that condition.
+// It returns the number of topics archived.
+func (s *Rethinkdb) ArchiveTopics(createdBefore time.Time, inactiveSince time.Time) (int, error) {
+	topics, err := s.GetTopics()
+	if err != nil {
+		return 0, err
+	}
+	lastPost, err := s.getLastPostTimes()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	count := 0
+	for _, t := range topics {
+		if t.Archived {
+			continue
+		}
+		if !createdBefore.IsZero() && !t.Created.Before(createdBefore) {
+			continue
+		}
+		if !inactiveSince.IsZero() {
+			last := t.Created
+			if p, ok := lastPost[t.Id]; ok && p.After(last) {
+				last = p
+			}
+			if !last.Before(inactiveSince) {
+				continue
+			}
+		}
+		update := map[string]interface{}{
+			"archived":   true,
+			"archivedAt": now,
+		}
+		if _, err := rdb.Table(TOPIC_TABLE).Get(t.Id).Update(nextVersion(update)).Run(s.session); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) SaveAttachment(a *dialogue.Attachment) error {
+	a.Created = time.Now()
+	res, err := rdb.Table(ATTACHMENT_TABLE).Insert(a).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		a.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+func (s *Rethinkdb) UpdateAttachment(a *dialogue.Attachment) error {
+	if _, err := rdb.Table(ATTACHMENT_TABLE).Get(a.Id).Replace(a).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetAttachment(id string) (*dialogue.Attachment, error) {
+	res, err := rdb.Table(ATTACHMENT_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get attachment from db: %s", err)
+		return nil, err
+	}
+	var a *dialogue.Attachment
+	if !res.IsNil() {
+		if err := res.Scan(&a); err != nil {
+			log.Errorf("Unable to get attachment from db: %s", err)
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// GetOrphanedAttachments returns attachments whose post has been purged
+// (or whose draft was deleted), and uploads created before the given time
+// that were never attached to a post
+func (s *Rethinkdb) GetOrphanedAttachments(uploadedBefore time.Time) ([]*dialogue.Attachment, error) {
+	unposted := rdb.Row.Field("postId").Eq("").And(rdb.Row.Field("created").Lt(uploadedBefore))
+	purged := rdb.Row.Field("postId").Ne("").And(rdb.Table(POST_TABLE).Get(rdb.Row.Field("postId")).Eq(nil))
+	res, err := rdb.Table(ATTACHMENT_TABLE).Filter(unposted.Or(purged)).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get orphaned attachments from db: %s", err)
+		return nil, err
+	}
+	var atts []*dialogue.Attachment
+	for res.Next() {
+		var a *dialogue.Attachment
+		if err := res.Scan(&a); err != nil {
+			log.Errorf("Unable to deserialize attachment from db: %s", err)
+			return nil, err
+		}
+		atts = append(atts, a)
+	}
+	return atts, nil
+}
+
+func (s *Rethinkdb) DeleteAttachment(id string) error {
+	if _, err := rdb.Table(ATTACHMENT_TABLE).Get(id).Delete().RunWrite(s.session); err != nil {
+		return err
+	}
+	return nil
+}
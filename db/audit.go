@@ -0,0 +1,68 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) SaveAuditEntry(entry *dialogue.AuditEntry) error {
+	res, err := rdb.Table(AUDIT_TABLE).Insert(entry).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		entry.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+// FindAuditEntries returns the newest audit entries, optionally filtered
+// by action, actor, target and creation time.  Entries are read newest
+// first from the created index, so the table is never sorted in memory.
+func (s *Rethinkdb) FindAuditEntries(action string, actor string, target string, since, until *time.Time, limit int) ([]*dialogue.AuditEntry, error) {
+	lower := time.Unix(0, 0)
+	upper := time.Now().Add(time.Hour)
+	if since != nil {
+		lower = *since
+	}
+	if until != nil {
+		upper = *until
+	}
+	q := rdb.Table(AUDIT_TABLE).Between(lower, upper, rdb.BetweenOpts{Index: "created"}).OrderBy(rdb.OrderByOpts{Index: rdb.Desc("created")})
+	if action != "" {
+		q = q.Filter(map[string]string{"action": action})
+	}
+	if actor != "" {
+		q = q.Filter(map[string]string{"actor": actor})
+	}
+	if target != "" {
+		q = q.Filter(map[string]string{"target": target})
+	}
+	res, err := q.Limit(limit).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get audit entries from db: %s", err)
+		return nil, err
+	}
+	entries := []*dialogue.AuditEntry{}
+	for res.Next() {
+		var e *dialogue.AuditEntry
+		if err := res.Scan(&e); err != nil {
+			log.Errorf("Unable to deserialize audit entry from db: %s", err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// PurgeAuditEntries deletes audit entries created before the given time
+// and returns the number deleted
+func (s *Rethinkdb) PurgeAuditEntries(before time.Time) (int, error) {
+	res, err := rdb.Table(AUDIT_TABLE).Between(time.Unix(0, 0), before, rdb.BetweenOpts{Index: "created"}).Delete().RunWrite(s.session)
+	if err != nil {
+		return 0, err
+	}
+	return res.Deleted, nil
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// migrateCategories creates the default category and moves topics that
+// predate categories into it
+func (s *Rethinkdb) migrateCategories() error {
+	cat, err := s.GetCategory(dialogue.DEFAULT_CATEGORY)
+	if err != nil {
+		return err
+	}
+	if cat == nil {
+		cat = &dialogue.Category{
+			Id:          dialogue.DEFAULT_CATEGORY,
+			Name:        "General",
+			Description: "Topics that don't belong to another category",
+			Created:     time.Now(),
+		}
+		if _, err := rdb.Table(CATEGORY_TABLE).Insert(cat).Run(s.session); err != nil {
+			return err
+		}
+		log.Info("Created default category")
+	}
+	res, err := rdb.Table(TOPIC_TABLE).Filter(rdb.Row.HasFields("categoryId").Not()).Update(map[string]string{"categoryId": dialogue.DEFAULT_CATEGORY}).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Replaced > 0 {
+		log.Infof("Moved %d topics to the default category", res.Replaced)
+	}
+	return nil
+}
+
+func (s *Rethinkdb) SaveCategory(cat *dialogue.Category) error {
+	cat.Created = time.Now()
+	res, err := rdb.Table(CATEGORY_TABLE).Insert(cat).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		cat.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+func (s *Rethinkdb) UpdateCategory(cat *dialogue.Category) error {
+	if _, err := rdb.Table(CATEGORY_TABLE).Get(cat.Id).Replace(cat).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteCategory deletes an empty category
+func (s *Rethinkdb) DeleteCategory(id string) error {
+	tbl := rdb.Table(CATEGORY_TABLE)
+	row, err := tbl.Get(id).RunRow(s.session)
+	if err != nil {
+		return err
+	}
+	if row.IsNil() {
+		return ErrCategoryNotFound
+	}
+	row, err = tbl.Filter(map[string]string{"parentId": id}).RunRow(s.session)
+	if err != nil {
+		return err
+	}
+	if !row.IsNil() {
+		return ErrCategoryNotEmpty
+	}
+	row, err = rdb.Table(TOPIC_TABLE).GetAllByIndex("categoryId", id).RunRow(s.session)
+	if err != nil {
+		return err
+	}
+	if !row.IsNil() {
+		return ErrCategoryNotEmpty
+	}
+	if _, err := tbl.Get(id).Delete().Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetCategory(id string) (*dialogue.Category, error) {
+	res, err := rdb.Table(CATEGORY_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get category from db: %s", err)
+		return nil, err
+	}
+	var cat *dialogue.Category
+	if !res.IsNil() {
+		if err := res.Scan(&cat); err != nil {
+			log.Errorf("Unable to get category from db: %s", err)
+			return nil, err
+		}
+	}
+	return cat, nil
+}
+
+func (s *Rethinkdb) GetCategories() ([]*dialogue.Category, error) {
+	var cats []*dialogue.Category
+	res, err := rdb.Table(CATEGORY_TABLE).OrderBy(rdb.Asc("name")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get categories from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var c *dialogue.Category
+		if err := res.Scan(&c); err != nil {
+			log.Errorf("Unable to deserialize category from db: %s", err)
+			return nil, err
+		}
+		cats = append(cats, c)
+	}
+	return cats, nil
+}
+
+// GetTopicsByCategory returns the topics in any of the categories
+func (s *Rethinkdb) GetTopicsByCategory(ids []string) ([]*dialogue.Topic, error) {
+	var topics []*dialogue.Topic
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id
+	}
+	res, err := rdb.Table(TOPIC_TABLE).GetAllByIndex("categoryId", keys...).Filter(notDeleted()).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get topics from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			log.Errorf("Unable to deserialize topic from db: %s", err)
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
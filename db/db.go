@@ -2,6 +2,7 @@ package db
 
 import (
 	"errors"
+	"sort"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -12,18 +13,90 @@ import (
 type (
 	Db interface {
 		SaveTopic(*dialogue.Topic) error
-		DeleteTopic(string) error
+		UpdateTopic(*dialogue.Topic) error
+		ClaimTopicReminder(string, bool) (bool, error)
+		ResetTopicReminders(string) error
+		DeleteTopic(string, string, int) error
 		GetTopic(string) (*dialogue.Topic, error)
 		GetTopics() ([]*dialogue.Topic, error)
+		GetTopicsById([]string) ([]*dialogue.Topic, error)
 		SavePost(*dialogue.Post) error
-		DeletePost(string) error
+		UpdatePost(*dialogue.Post) error
+		UpdatePostHtml(string, string, string) error
+		DeletePost(string, string, int) error
 		GetPost(string) (*dialogue.Post, error)
 		GetPosts(string) ([]*dialogue.Post, error)
+		FindPosts([]string, string, *time.Time, *time.Time, int) ([]*dialogue.Post, error)
+		GetTopicActivity(string) (int, *time.Time, error)
 		SaveUser(*dialogue.User) error
+		UpdateUser(*dialogue.User) error
 		GetUser(string) (*dialogue.User, error)
+		GetUserByEmail(string) (*dialogue.User, error)
 		DeleteUser(string) error
 		GetAuthorization(string) (*dialogue.Authorization, error)
 		SaveAuthorization(*dialogue.Authorization) error
+		SaveSubscription(*dialogue.Subscription) error
+		UpdateSubscription(*dialogue.Subscription) error
+		DeleteSubscription(string) error
+		GetSubscription(string) (*dialogue.Subscription, error)
+		GetSubscriptionByToken(string) (*dialogue.Subscription, error)
+		GetSubscriptions(string) ([]*dialogue.Subscription, error)
+		GetSubscriptionsByMode(string) ([]*dialogue.Subscription, error)
+		GetPostsSince(string, time.Time) ([]*dialogue.Post, error)
+		SaveInboxEntry(*dialogue.InboxEntry) error
+		GetInboxEntry(string) (*dialogue.InboxEntry, error)
+		GetInbox(string, bool) ([]*dialogue.InboxEntry, error)
+		MarkInboxRead(string, string) error
+		SaveReadMarker(string, string, time.Time) error
+		GetReadMarkers(string) ([]*dialogue.ReadMarker, error)
+		GetUnreadCounts(string, []string) (map[string]int, error)
+		SaveLabel(*dialogue.Label) error
+		UpdateLabel(string, *dialogue.Label) error
+		DeleteLabel(string) error
+		GetLabel(string) (*dialogue.Label, error)
+		GetLabels() ([]*dialogue.Label, error)
+		GetTopicsByLabels([]string, bool) ([]*dialogue.Topic, error)
+		Search(string, []string, bool) (*dialogue.SearchResult, error)
+		SaveCategory(*dialogue.Category) error
+		UpdateCategory(*dialogue.Category) error
+		DeleteCategory(string) error
+		GetCategory(string) (*dialogue.Category, error)
+		GetCategories() ([]*dialogue.Category, error)
+		GetTopicsByCategory([]string) ([]*dialogue.Topic, error)
+		GetDeletedTopic(string) (*dialogue.Topic, error)
+		GetDeletedPost(string) (*dialogue.Post, error)
+		RestoreTopic(string) error
+		RestorePost(string) error
+		GetTrash() (*dialogue.Trash, error)
+		PurgeTrash(time.Time) (int, error)
+		ArchiveTopics(time.Time, time.Time) (int, error)
+		SaveAttachment(*dialogue.Attachment) error
+		UpdateAttachment(*dialogue.Attachment) error
+		GetAttachment(string) (*dialogue.Attachment, error)
+		GetOrphanedAttachments(time.Time) ([]*dialogue.Attachment, error)
+		DeleteAttachment(string) error
+		AddReaction(string, string, string) (*dialogue.Post, error)
+		RemoveReaction(string, string, string) (*dialogue.Post, error)
+		SetPostPinned(string, bool, string) error
+		SavePoll(*dialogue.Poll) error
+		GetPoll(string) (*dialogue.Poll, error)
+		GetPolls(string) ([]*dialogue.Poll, error)
+		SavePollVote(string, string, []int) error
+		GetDraft(string) (*dialogue.Post, error)
+		GetDrafts(string) ([]*dialogue.Post, error)
+		GetDuePosts(time.Time) ([]*dialogue.Post, error)
+		UpdateDraft(*dialogue.Post) (bool, error)
+		DeleteDraft(string, int) error
+		PublishPost(*dialogue.Post) (bool, error)
+		ClaimPostAnnouncement(string) (bool, error)
+		GetUnannouncedPosts(time.Time) ([]*dialogue.Post, error)
+		TakeToken(string, float64, float64, time.Time) (bool, float64, error)
+		PurgeRateBuckets(time.Time) (int, error)
+		SaveAuditEntry(*dialogue.AuditEntry) error
+		FindAuditEntries(string, string, string, *time.Time, *time.Time, int) ([]*dialogue.AuditEntry, error)
+		PurgeAuditEntries(time.Time) (int, error)
+		Ping() error
+		Close() error
 	}
 	Rethinkdb struct {
 		session *rdb.Session
@@ -31,18 +104,36 @@ type (
 )
 
 var (
-	ErrTopicNotFound = errors.New("topic not found")
-	ErrPostNotFound  = errors.New("post not found")
-	ErrUserExists    = errors.New("user exists")
-	ErrTopicExists   = errors.New("topic exists")
-	log              = logrus.New()
+	ErrTopicNotFound        = errors.New("topic not found")
+	ErrPostNotFound         = errors.New("post not found")
+	ErrUserExists           = errors.New("user exists")
+	ErrTopicExists          = errors.New("topic exists")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrSubscriptionExists   = errors.New("subscription exists")
+	ErrLabelNotFound        = errors.New("label not found")
+	ErrLabelExists          = errors.New("label exists")
+	ErrCategoryNotFound     = errors.New("category not found")
+	ErrCategoryNotEmpty     = errors.New("category has topics or subcategories")
+	ErrPollNotFound         = errors.New("poll not found")
+	ErrVersionConflict      = errors.New("changed since it was read")
+	ErrRateBucketBusy       = errors.New("rate limit bucket is too busy to update")
+	log                     = logrus.New()
 )
 
 const (
-	AUTH_TABLE  = "auth"
-	POST_TABLE  = "post"
-	TOPIC_TABLE = "topic"
-	USER_TABLE  = "user"
+	AUTH_TABLE         = "auth"
+	POST_TABLE         = "post"
+	TOPIC_TABLE        = "topic"
+	USER_TABLE         = "user"
+	SUBSCRIPTION_TABLE = "subscription"
+	INBOX_TABLE        = "inbox"
+	READ_TABLE         = "read"
+	LABEL_TABLE        = "label"
+	CATEGORY_TABLE     = "category"
+	ATTACHMENT_TABLE   = "attachment"
+	POLL_TABLE         = "poll"
+	RATE_LIMIT_TABLE   = "ratelimit"
+	AUDIT_TABLE        = "audit"
 )
 
 func NewRethinkdbSession(address string, database string) (*Rethinkdb, error) {
@@ -66,11 +157,42 @@ func NewRethinkdbSession(address string, database string) (*Rethinkdb, error) {
 	rdb.Db(database).TableCreate(TOPIC_TABLE).Run(session)
 	rdb.Db(database).TableCreate(POST_TABLE).Run(session)
 	rdb.Db(database).TableCreate(USER_TABLE).Run(session)
+	rdb.Db(database).TableCreate(SUBSCRIPTION_TABLE).Run(session)
+	rdb.Db(database).TableCreate(INBOX_TABLE).Run(session)
+	rdb.Db(database).TableCreate(READ_TABLE).Run(session)
+	rdb.Db(database).TableCreate(LABEL_TABLE).Run(session)
+	rdb.Db(database).TableCreate(CATEGORY_TABLE).Run(session)
+	rdb.Db(database).TableCreate(ATTACHMENT_TABLE).Run(session)
+	rdb.Db(database).TableCreate(POLL_TABLE).Run(session)
+	rdb.Db(database).TableCreate(RATE_LIMIT_TABLE).Run(session)
+	rdb.Db(database).TableCreate(AUDIT_TABLE).Run(session)
+	// indexes
+	rdb.Db(database).Table(LABEL_TABLE).IndexCreate("name").Run(session)
+	rdb.Db(database).Table(TOPIC_TABLE).IndexCreate("labels", rdb.IndexCreateOpts{Multi: true}).Run(session)
+	rdb.Db(database).Table(TOPIC_TABLE).IndexCreate("categoryId").Run(session)
+	rdb.Db(database).Table(POLL_TABLE).IndexCreate("topicId").Run(session)
+	rdb.Db(database).Table(POST_TABLE).IndexCreate("topicId").Run(session)
+	rdb.Db(database).Table(AUDIT_TABLE).IndexCreate("created").Run(session)
+	// migrations
+	if err := r.migrateCategories(); err != nil {
+		return nil, err
+	}
 	return r, nil
 }
 
+// Ping checks that the database answers queries
+func (s *Rethinkdb) Ping() error {
+	_, err := rdb.Expr(1).RunRow(s.session)
+	return err
+}
+
+// Close closes the connections to the database
+func (s *Rethinkdb) Close() error {
+	return s.session.Close()
+}
+
 func (s *Rethinkdb) topicExists(title string) bool {
-	row, err := rdb.Table(TOPIC_TABLE).Filter(map[string]string{"title": title}).RunRow(s.session)
+	row, err := rdb.Table(TOPIC_TABLE).Filter(map[string]string{"title": title}).Filter(notDeleted()).RunRow(s.session)
 	if err != nil {
 		log.Errorf("Error checking for topic: %s", err)
 		return true
@@ -81,40 +203,85 @@ func (s *Rethinkdb) topicExists(title string) bool {
 func (s *Rethinkdb) SaveTopic(topic *dialogue.Topic) error {
 	if !s.topicExists(topic.Title) {
 		topic.Created = time.Now()
-		if _, err := rdb.Table(TOPIC_TABLE).Insert(topic).Run(s.session); err != nil {
+		if topic.CategoryId == "" {
+			topic.CategoryId = dialogue.DEFAULT_CATEGORY
+		}
+		res, err := rdb.Table(TOPIC_TABLE).Insert(topic).RunWrite(s.session)
+		if err != nil {
 			return err
 		}
+		if len(res.GeneratedKeys) > 0 {
+			topic.Id = res.GeneratedKeys[0]
+		}
 	} else {
 		return ErrTopicExists
 	}
 	return nil
 }
 
+// UpdateTopic saves a topic that was read at topic.Version and increments
+// the version.  ErrVersionConflict is returned if the topic has changed
+// since it was read.  The reminder flags are kept as stored; they are
+// only changed by ClaimTopicReminder and ResetTopicReminders.
 func (s *Rethinkdb) UpdateTopic(topic *dialogue.Topic) error {
-	if _, err := rdb.Table(TOPIC_TABLE).Update(topic).Run(s.session); err != nil {
+	v := topic.Version
+	doc := *topic
+	doc.DueReminderSent = false
+	doc.OverdueReminderSent = false
+	doc.Version = v + 1
+	merged := rdb.Row.Pluck("dueReminderSent", "overdueReminderSent").Merge(doc)
+	res, err := rdb.Table(TOPIC_TABLE).Get(topic.Id).Replace(rdb.Branch(hasVersion(v), merged, rdb.Row)).RunWrite(s.session)
+	if err != nil {
 		return err
 	}
+	if res.Replaced == 0 {
+		return ErrVersionConflict
+	}
+	topic.Version = v + 1
 	return nil
 }
 
-func (s *Rethinkdb) DeleteTopic(id string) error {
-	tbl := rdb.Table(TOPIC_TABLE)
-	row, err := tbl.Get(id).RunRow(s.session)
+// ClaimTopicReminder marks the due (or overdue) reminder of a topic as
+// sent without changing its version.  It returns false if the reminder
+// was already sent, so only one caller sends it.
+func (s *Rethinkdb) ClaimTopicReminder(id string, overdue bool) (bool, error) {
+	field := "dueReminderSent"
+	update := map[string]interface{}{"dueReminderSent": true}
+	if overdue {
+		field = "overdueReminderSent"
+		update["overdueReminderSent"] = true
+	}
+	unsent := rdb.Row.Field(field).Default(false).Eq(false)
+	res, err := rdb.Table(TOPIC_TABLE).Get(id).Update(rdb.Branch(unsent, update, map[string]interface{}{})).RunWrite(s.session)
 	if err != nil {
-		return err
-	}
-	if row.IsNil() {
-		return ErrTopicNotFound
+		return false, err
 	}
-	// delete
-	if _, err := tbl.Get(id).Delete().Run(s.session); err != nil {
+	return res.Replaced > 0, nil
+}
+
+// ResetTopicReminders clears the reminder flags of a topic so that
+// reminders are sent again, i.e. after its due date has changed
+func (s *Rethinkdb) ResetTopicReminders(id string) error {
+	update := map[string]interface{}{"dueReminderSent": false, "overdueReminderSent": false}
+	if _, err := rdb.Table(TOPIC_TABLE).Get(id).Update(update).RunWrite(s.session); err != nil {
 		return err
 	}
-	// remove posts
-	rdb.Table(POST_TABLE).Filter(map[string]string{"topicId": id}).Delete().RunRow(s.session)
 	return nil
 }
 
+// DeleteTopic moves a topic to the trash if it is still at version.  Its
+// posts are left as they are and are hidden along with the topic.
+func (s *Rethinkdb) DeleteTopic(id string, username string, version int) error {
+	topic, err := s.GetTopic(id)
+	if err != nil {
+		return err
+	}
+	if topic == nil {
+		return ErrTopicNotFound
+	}
+	return s.updateVersion(TOPIC_TABLE, id, version, deleted(username))
+}
+
 func (s *Rethinkdb) GetTopic(id string) (*dialogue.Topic, error) {
 	res, err := rdb.Table(TOPIC_TABLE).Get(id).RunRow(s.session)
 	if err != nil {
@@ -128,12 +295,42 @@ func (s *Rethinkdb) GetTopic(id string) (*dialogue.Topic, error) {
 			return nil, err
 		}
 	}
+	if topic != nil && topic.DeletedAt != nil {
+		return nil, nil
+	}
 	return topic, nil
 }
 
+// GetTopicsById returns the topics with the given ids that exist and are
+// not deleted
+func (s *Rethinkdb) GetTopicsById(ids []string) ([]*dialogue.Topic, error) {
+	var topics []*dialogue.Topic
+	if len(ids) == 0 {
+		return topics, nil
+	}
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id
+	}
+	res, err := rdb.Table(TOPIC_TABLE).GetAll(keys...).Filter(notDeleted()).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get topics from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			log.Errorf("Unable to deserialize topic from db: %s", err)
+			return nil, err
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
 func (s *Rethinkdb) GetTopics() ([]*dialogue.Topic, error) {
 	var topics []*dialogue.Topic
-	res, err := rdb.Table(TOPIC_TABLE).OrderBy(rdb.Asc("Created")).Run(s.session)
+	res, err := rdb.Table(TOPIC_TABLE).Filter(notDeleted()).OrderBy(rdb.Asc("created")).Run(s.session)
 	if err != nil {
 		log.Errorf("Unable to get topics from db: %s", err)
 		return nil, err
@@ -151,33 +348,47 @@ func (s *Rethinkdb) GetTopics() ([]*dialogue.Topic, error) {
 
 func (s *Rethinkdb) SavePost(post *dialogue.Post) error {
 	post.Created = time.Now()
-	if _, err := rdb.Table(POST_TABLE).Insert(post).Run(s.session); err != nil {
+	res, err := rdb.Table(POST_TABLE).Insert(post).RunWrite(s.session)
+	if err != nil {
 		return err
 	}
+	if len(res.GeneratedKeys) > 0 {
+		post.Id = res.GeneratedKeys[0]
+	}
 	return nil
 }
 
+// UpdatePost saves a post that was read at post.Version and increments
+// the version.  ErrVersionConflict is returned if the post has changed
+// since it was read.
 func (s *Rethinkdb) UpdatePost(post *dialogue.Post) error {
-	if _, err := rdb.Table(POST_TABLE).Update(post).Run(s.session); err != nil {
+	v := post.Version
+	post.Version++
+	if err := s.replaceVersion(POST_TABLE, post.Id, v, post); err != nil {
+		post.Version = v
+		return err
+	}
+	return nil
+}
+
+// UpdatePostHtml caches the rendered content of a post
+func (s *Rethinkdb) UpdatePostHtml(id string, html string, hash string) error {
+	if _, err := rdb.Table(POST_TABLE).Get(id).Update(map[string]string{"html": html, "htmlHash": hash}).Run(s.session); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (s *Rethinkdb) DeletePost(id string) error {
-	tbl := rdb.Table(POST_TABLE)
-	row, err := tbl.Get(id).RunRow(s.session)
+// DeletePost moves a post to the trash if it is still at version
+func (s *Rethinkdb) DeletePost(id string, username string, version int) error {
+	post, err := s.GetPost(id)
 	if err != nil {
 		return err
 	}
-	if row.IsNil() {
+	if post == nil {
 		return ErrPostNotFound
 	}
-	// delete
-	if _, err := tbl.Get(id).Delete().Run(s.session); err != nil {
-		return err
-	}
-	return nil
+	return s.updateVersion(POST_TABLE, id, version, deleted(username))
 }
 
 func (s *Rethinkdb) GetPost(id string) (*dialogue.Post, error) {
@@ -193,12 +404,55 @@ func (s *Rethinkdb) GetPost(id string) (*dialogue.Post, error) {
 			return nil, err
 		}
 	}
+	if post != nil && (post.DeletedAt != nil || post.Status != "") {
+		return nil, nil
+	}
 	return post, nil
 }
 
+// GetPosts returns the posts in a topic, pinned posts first
 func (s *Rethinkdb) GetPosts(topicId string) ([]*dialogue.Post, error) {
 	var posts []*dialogue.Post
-	res, err := rdb.Table(POST_TABLE).OrderBy(rdb.Asc("Created")).Run(s.session)
+	res, err := rdb.Table(POST_TABLE).Filter(map[string]string{"topicId": topicId}).Filter(notDeleted()).Filter(published()).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get posts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	sort.Stable(pinnedFirst(posts))
+	return posts, nil
+}
+
+// FindPosts returns up to limit posts in the given topics, newest first.
+// Posts can be filtered by author and by the time they were created
+// (since is inclusive, until exclusive).
+func (s *Rethinkdb) FindPosts(topicIds []string, author string, since, until *time.Time, limit int) ([]*dialogue.Post, error) {
+	posts := []*dialogue.Post{}
+	if len(topicIds) == 0 {
+		return posts, nil
+	}
+	ids := []interface{}{}
+	for _, id := range topicIds {
+		ids = append(ids, id)
+	}
+	q := rdb.Table(POST_TABLE).Filter(rdb.Expr(ids).Contains(rdb.Row.Field("topicId"))).Filter(notDeleted()).Filter(published())
+	if author != "" {
+		q = q.Filter(map[string]string{"author": author})
+	}
+	if since != nil {
+		q = q.Filter(rdb.Row.Field("created").Ge(*since))
+	}
+	if until != nil {
+		q = q.Filter(rdb.Row.Field("created").Lt(*until))
+	}
+	res, err := q.OrderBy(rdb.Desc("created")).Limit(limit).Run(s.session)
 	if err != nil {
 		log.Errorf("Unable to get posts from db: %s", err)
 		return nil, err
@@ -214,6 +468,34 @@ func (s *Rethinkdb) GetPosts(topicId string) ([]*dialogue.Post, error) {
 	return posts, nil
 }
 
+// GetTopicActivity returns the number of posts in a topic and the time of
+// the latest one
+func (s *Rethinkdb) GetTopicActivity(topicId string) (int, *time.Time, error) {
+	posts := rdb.Table(POST_TABLE).Filter(map[string]string{"topicId": topicId}).Filter(notDeleted()).Filter(published())
+	row, err := posts.Count().RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to count posts: %s", err)
+		return 0, nil, err
+	}
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return 0, nil, err
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+	row, err = posts.OrderBy(rdb.Desc("created")).Limit(1).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get latest post: %s", err)
+		return 0, nil, err
+	}
+	var p *dialogue.Post
+	if err := row.Scan(&p); err != nil {
+		return 0, nil, err
+	}
+	return count, &p.Created, nil
+}
+
 func (s *Rethinkdb) userExists(username string) bool {
 	row, err := rdb.Table(USER_TABLE).Filter(map[string]string{"username": username}).RunRow(s.session)
 	if err != nil {
@@ -234,8 +516,14 @@ func (s *Rethinkdb) SaveUser(user *dialogue.User) error {
 	return nil
 }
 
+// UpdateUser saves a user that was read at user.Version and increments
+// the version.  ErrVersionConflict is returned if the user has changed
+// since it was read.
 func (s *Rethinkdb) UpdateUser(user *dialogue.User) error {
-	if _, err := rdb.Table(USER_TABLE).Update(user).Run(s.session); err != nil {
+	v := user.Version
+	user.Version++
+	if err := s.replaceVersion(USER_TABLE, user.Id, v, user); err != nil {
+		user.Version = v
 		return err
 	}
 	return nil
@@ -257,6 +545,22 @@ func (s *Rethinkdb) GetUser(username string) (*dialogue.User, error) {
 	return user, nil
 }
 
+func (s *Rethinkdb) GetUserByEmail(email string) (*dialogue.User, error) {
+	res, err := rdb.Table(USER_TABLE).Filter(map[string]string{"email": email}).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get user from db: %s", err)
+		return nil, err
+	}
+	var user *dialogue.User
+	if !res.IsNil() {
+		if err := res.Scan(&user); err != nil {
+			log.Errorf("Unable to get user from db: %s", err)
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
 func (s *Rethinkdb) DeleteUser(username string) error {
 	if _, err := rdb.Table(USER_TABLE).Filter(map[string]string{"username": username}).Delete().Run(s.session); err != nil {
 		return err
@@ -0,0 +1,337 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// The tests in this file need a RethinkDB server.  They are skipped unless
+// DIALOGUE_TEST_RETHINKDB is set to its address (i.e. 127.0.0.1:28015).
+// Each test uses a new database, which is dropped afterwards.
+
+func testDb(t *testing.T) (*Rethinkdb, func()) {
+	address := os.Getenv("DIALOGUE_TEST_RETHINKDB")
+	if address == "" {
+		t.Skip("DIALOGUE_TEST_RETHINKDB is not set")
+	}
+	admin, err := rdb.Connect(rdb.ConnectOpts{Address: address})
+	if err != nil {
+		t.Fatalf("Unable to connect to %s: %s", address, err)
+	}
+	name := fmt.Sprintf("dialogue_test_%d", time.Now().UnixNano())
+	if _, err := rdb.DbCreate(name).Run(admin); err != nil {
+		admin.Close()
+		t.Fatalf("Unable to create database %s: %s", name, err)
+	}
+	s, err := NewRethinkdbSession(address, name)
+	if err != nil {
+		rdb.DbDrop(name).Run(admin)
+		admin.Close()
+		t.Fatalf("NewRethinkdbSession: %s", err)
+	}
+	return s, func() {
+		s.Close()
+		rdb.DbDrop(name).Run(admin)
+		admin.Close()
+	}
+}
+
+// concurrently runs f n times at the same time and counts the calls that
+// returned true
+func concurrently(n int, f func(i int) bool) int {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		count int
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if f(i) {
+				mu.Lock()
+				count++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return count
+}
+
+func TestGetUnreadCounts(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	topics := []*dialogue.Topic{{Title: "read"}, {Title: "unread"}, {Title: "empty"}}
+	for _, topic := range topics {
+		if err := s.SaveTopic(topic); err != nil {
+			t.Fatalf("SaveTopic: %s", err)
+		}
+	}
+	post := func(topic *dialogue.Topic, author string, status string) {
+		p := &dialogue.Post{TopicId: topic.Id, Author: author, Content: "hello", Status: status}
+		if err := s.SavePost(p); err != nil {
+			t.Fatalf("SavePost: %s", err)
+		}
+	}
+	post(topics[0], "bob", "")
+	post(topics[1], "bob", "")
+	time.Sleep(time.Millisecond * 10)
+	if err := s.SaveReadMarker("alice", topics[0].Id, time.Now()); err != nil {
+		t.Fatalf("SaveReadMarker: %s", err)
+	}
+	time.Sleep(time.Millisecond * 10)
+	post(topics[1], "bob", "")
+	post(topics[1], "alice", "")
+	post(topics[1], "bob", dialogue.POST_DRAFT)
+
+	ids := []string{topics[0].Id, topics[1].Id, topics[2].Id}
+	counts, err := s.GetUnreadCounts("alice", ids)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %s", err)
+	}
+	// alice's own posts and drafts are not unread
+	if len(counts) != 1 || counts[topics[1].Id] != 2 {
+		t.Errorf("GetUnreadCounts = %v, want 2 unread posts in %s only", counts, topics[1].Id)
+	}
+}
+
+func TestClaimTopicReminderConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	topic := &dialogue.Topic{Title: "topic"}
+	if err := s.SaveTopic(topic); err != nil {
+		t.Fatalf("SaveTopic: %s", err)
+	}
+	for _, overdue := range []bool{false, true} {
+		claimed := concurrently(10, func(i int) bool {
+			ok, err := s.ClaimTopicReminder(topic.Id, overdue)
+			if err != nil {
+				t.Errorf("ClaimTopicReminder: %s", err)
+			}
+			return ok
+		})
+		if claimed != 1 {
+			t.Errorf("reminder (overdue %v) was claimed %d times, want once", overdue, claimed)
+		}
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	kept := &dialogue.Topic{Title: "kept"}
+	purged := &dialogue.Topic{Title: "purged"}
+	for _, topic := range []*dialogue.Topic{kept, purged} {
+		if err := s.SaveTopic(topic); err != nil {
+			t.Fatalf("SaveTopic: %s", err)
+		}
+		if err := s.SavePost(&dialogue.Post{TopicId: topic.Id, Author: "bob", Content: "hello"}); err != nil {
+			t.Fatalf("SavePost: %s", err)
+		}
+		if err := s.SaveSubscription(&dialogue.Subscription{Username: "alice", TopicId: topic.Id, Mode: "immediate"}); err != nil {
+			t.Fatalf("SaveSubscription: %s", err)
+		}
+		if err := s.SaveReadMarker("alice", topic.Id, time.Now()); err != nil {
+			t.Fatalf("SaveReadMarker: %s", err)
+		}
+		if err := s.SaveInboxEntry(&dialogue.InboxEntry{Username: "alice", Kind: "mention", TopicId: topic.Id}); err != nil {
+			t.Fatalf("SaveInboxEntry: %s", err)
+		}
+	}
+	if err := s.DeleteTopic(purged.Id, "bob", purged.Version); err != nil {
+		t.Fatalf("DeleteTopic: %s", err)
+	}
+	count, err := s.PurgeTrash(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatalf("PurgeTrash: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("PurgeTrash removed %d topics and posts, want 2", count)
+	}
+
+	subs, err := s.GetSubscriptions("alice")
+	if err != nil {
+		t.Fatalf("GetSubscriptions: %s", err)
+	}
+	if len(subs) != 1 || subs[0].TopicId != kept.Id {
+		t.Errorf("subscriptions of the purged topic were kept: %v", subs)
+	}
+	markers, err := s.GetReadMarkers("alice")
+	if err != nil {
+		t.Fatalf("GetReadMarkers: %s", err)
+	}
+	if len(markers) != 1 || markers[0].TopicId != kept.Id {
+		t.Errorf("read markers of the purged topic were kept: %v", markers)
+	}
+	inbox, err := s.GetInbox("alice", false)
+	if err != nil {
+		t.Fatalf("GetInbox: %s", err)
+	}
+	if len(inbox) != 1 || inbox[0].TopicId != kept.Id {
+		t.Errorf("inbox entries of the purged topic were kept: %v", inbox)
+	}
+}
+
+func TestAddReactionConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	post := &dialogue.Post{TopicId: "topic", Author: "alice", Content: "hello"}
+	if err := s.SavePost(post); err != nil {
+		t.Fatalf("SavePost: %s", err)
+	}
+	concurrently(20, func(i int) bool {
+		// the same user twice for each reaction
+		name := []string{"+1", "heart"}[i%2]
+		if _, err := s.AddReaction(post.Id, name, fmt.Sprintf("user%d", i/4)); err != nil {
+			t.Errorf("AddReaction: %s", err)
+		}
+		return true
+	})
+	post, err := s.GetPost(post.Id)
+	if err != nil {
+		t.Fatalf("GetPost: %s", err)
+	}
+	for _, name := range []string{"+1", "heart"} {
+		if users := post.ReactionUsers[name]; len(users) != 5 {
+			t.Errorf("%s reaction has users %v, want 5 distinct users", name, users)
+		}
+	}
+}
+
+func TestSavePollVoteConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	poll := &dialogue.Poll{TopicId: "topic", Question: "?", Options: []string{"a", "b", "c"}, Multiple: true}
+	if err := s.SavePoll(poll); err != nil {
+		t.Fatalf("SavePoll: %s", err)
+	}
+	const voters = 30
+	concurrently(voters*2, func(i int) bool {
+		// every user votes twice; the second vote replaces the first
+		if err := s.SavePollVote(poll.Id, fmt.Sprintf("user%d", i%voters), []int{i % 3}); err != nil {
+			t.Errorf("SavePollVote: %s", err)
+		}
+		return true
+	})
+	poll, err := s.GetPoll(poll.Id)
+	if err != nil {
+		t.Fatalf("GetPoll: %s", err)
+	}
+	poll.Tally("", time.Now())
+	total := 0
+	for _, r := range poll.Results {
+		total += r.Votes
+	}
+	if poll.Voters != voters || total != voters {
+		t.Errorf("%d voters with %d votes, want %d of each", poll.Voters, total, voters)
+	}
+}
+
+func TestPublishPostConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	draft := &dialogue.Post{TopicId: "topic", Author: "alice", Content: "hello", Status: dialogue.POST_DRAFT}
+	if err := s.SavePost(draft); err != nil {
+		t.Fatalf("SavePost: %s", err)
+	}
+	published := concurrently(10, func(i int) bool {
+		post := *draft
+		ok, err := s.PublishPost(&post)
+		if err != nil {
+			t.Errorf("PublishPost: %s", err)
+		}
+		return ok
+	})
+	if published != 1 {
+		t.Errorf("post was published %d times, want once", published)
+	}
+	announced := concurrently(10, func(i int) bool {
+		ok, err := s.ClaimPostAnnouncement(draft.Id)
+		if err != nil {
+			t.Errorf("ClaimPostAnnouncement: %s", err)
+		}
+		return ok
+	})
+	if announced != 1 {
+		t.Errorf("post announcement was claimed %d times, want once", announced)
+	}
+}
+
+func TestUpdateTopicConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	topic := &dialogue.Topic{Title: "topic"}
+	if err := s.SaveTopic(topic); err != nil {
+		t.Fatalf("SaveTopic: %s", err)
+	}
+	read, err := s.GetTopic(topic.Id)
+	if err != nil {
+		t.Fatalf("GetTopic: %s", err)
+	}
+	updated := concurrently(10, func(i int) bool {
+		mine := *read
+		mine.Title = fmt.Sprintf("topic %d", i)
+		err := s.UpdateTopic(&mine)
+		if err != nil && err != ErrVersionConflict {
+			t.Errorf("UpdateTopic: %s", err)
+		}
+		return err == nil
+	})
+	if updated != 1 {
+		t.Errorf("topic was updated %d times at the same version, want once", updated)
+	}
+	topic, err = s.GetTopic(topic.Id)
+	if err != nil {
+		t.Fatalf("GetTopic: %s", err)
+	}
+	if topic.Version != read.Version+1 {
+		t.Errorf("topic is at version %d, want %d", topic.Version, read.Version+1)
+	}
+}
+
+func TestTakeTokenConcurrent(t *testing.T) {
+	s, done := testDb(t)
+	defer done()
+
+	const capacity = 10
+	now := time.Now()
+	// the bucket does not refill, so however busy it is, no more than
+	// capacity tokens are ever taken.  Busy buckets take no token.
+	taken := concurrently(capacity*3, func(i int) bool {
+		ok, _, err := s.TakeToken("write:user:alice", capacity, 0, now)
+		if err != nil && err != ErrRateBucketBusy {
+			t.Errorf("TakeToken: %s", err)
+		}
+		return ok && err == nil
+	})
+	for {
+		ok, _, err := s.TakeToken("write:user:alice", capacity, 0, now)
+		if err != nil {
+			t.Fatalf("TakeToken: %s", err)
+		}
+		if !ok {
+			break
+		}
+		taken++
+	}
+	if taken != capacity {
+		t.Errorf("%d tokens taken, want %d", taken, capacity)
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// published matches posts that are not drafts or scheduled
+func published() rdb.Term {
+	return rdb.Row.Field("status").Default("").Eq("")
+}
+
+// GetDraft returns an unpublished post
+func (s *Rethinkdb) GetDraft(id string) (*dialogue.Post, error) {
+	res, err := rdb.Table(POST_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get draft from db: %s", err)
+		return nil, err
+	}
+	var post *dialogue.Post
+	if !res.IsNil() {
+		if err := res.Scan(&post); err != nil {
+			log.Errorf("Unable to get draft from db: %s", err)
+			return nil, err
+		}
+	}
+	if post != nil && (post.DeletedAt != nil || post.Status == "") {
+		return nil, nil
+	}
+	return post, nil
+}
+
+// GetDrafts returns the unpublished posts of author
+func (s *Rethinkdb) GetDrafts(author string) ([]*dialogue.Post, error) {
+	filter := rdb.Row.Field("author").Eq(author).And(published().Not()).And(notDeleted())
+	return s.getDrafts(filter)
+}
+
+// GetDuePosts returns scheduled posts that should be published by now
+func (s *Rethinkdb) GetDuePosts(now time.Time) ([]*dialogue.Post, error) {
+	filter := rdb.Row.Field("status").Default("").Eq(dialogue.POST_SCHEDULED).And(rdb.Row.Field("publishAt").Le(now)).And(notDeleted())
+	return s.getDrafts(filter)
+}
+
+func (s *Rethinkdb) getDrafts(filter rdb.Term) ([]*dialogue.Post, error) {
+	var posts []*dialogue.Post
+	res, err := rdb.Table(POST_TABLE).Filter(filter).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get drafts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize draft from db: %s", err)
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
+
+// unpublished applies update to a post only while it is unpublished and
+// at version v, so edits cannot race with publishing or with each other.
+// false is returned if the post had been published or changed.
+func (s *Rethinkdb) unpublished(id string, v int, update map[string]interface{}) (bool, error) {
+	unchanged := published().Not().And(hasVersion(v))
+	res, err := rdb.Table(POST_TABLE).Get(id).Update(rdb.Branch(unchanged, nextVersion(update), map[string]interface{}{})).RunWrite(s.session)
+	if err != nil {
+		return false, err
+	}
+	return res.Replaced > 0, nil
+}
+
+// UpdateDraft saves the content, status and publish time of a draft that
+// was read at post.Version.  It returns false if the draft has been
+// published or changed in the meantime.
+func (s *Rethinkdb) UpdateDraft(post *dialogue.Post) (bool, error) {
+	now := time.Now()
+	post.Updated = &now
+	ok, err := s.unpublished(post.Id, post.Version, map[string]interface{}{
+		"content":   post.Content,
+		"status":    post.Status,
+		"publishAt": post.PublishAt,
+		"updated":   post.Updated,
+	})
+	if ok {
+		post.Version++
+	}
+	return ok, err
+}
+
+// DeleteDraft permanently deletes an unpublished post at version.
+// ErrVersionConflict is returned if it has been published or changed.
+func (s *Rethinkdb) DeleteDraft(id string, version int) error {
+	res, err := rdb.Table(POST_TABLE).Get(id).Replace(rdb.Branch(published().Or(hasVersion(version).Not()), rdb.Row, nil)).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Deleted == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// PublishPost publishes a draft or scheduled post, setting its creation
+// time to now.  The status is changed in a single conditional write, so a
+// post is published once even if several api instances try at the same
+// time; only the caller that gets true should announce the post.  false
+// is also returned if the post changed since it was read.
+func (s *Rethinkdb) PublishPost(post *dialogue.Post) (bool, error) {
+	now := time.Now()
+	ok, err := s.unpublished(post.Id, post.Version, map[string]interface{}{
+		"status":      "",
+		"created":     now,
+		"content":     post.Content,
+		"mentions":    post.Mentions,
+		"html":        post.Html,
+		"htmlHash":    post.HtmlHash,
+		"publishAt":   nil,
+		"updated":     nil,
+		"unannounced": true,
+	})
+	if err != nil || !ok {
+		return false, err
+	}
+	post.Unannounced = true
+	post.Version++
+	post.Status = ""
+	post.PublishAt = nil
+	post.Updated = nil
+	post.Created = now
+	return true, nil
+}
+
+// ClaimPostAnnouncement clears the unannounced flag of a published post.
+// It returns true for the one caller that cleared it, which then announces
+// the post.
+func (s *Rethinkdb) ClaimPostAnnouncement(id string) (bool, error) {
+	pending := rdb.Row.Field("unannounced").Default(false)
+	res, err := rdb.Table(POST_TABLE).Get(id).Replace(rdb.Branch(pending, rdb.Row.Without("unannounced"), rdb.Row)).RunWrite(s.session)
+	if err != nil {
+		return false, err
+	}
+	return res.Replaced > 0, nil
+}
+
+// GetUnannouncedPosts returns posts published before the given time that
+// have not been announced, i.e. because the api stopped after publishing
+// them
+func (s *Rethinkdb) GetUnannouncedPosts(before time.Time) ([]*dialogue.Post, error) {
+	var posts []*dialogue.Post
+	filter := rdb.Row.Field("unannounced").Default(false).And(rdb.Row.Field("created").Lt(before))
+	res, err := rdb.Table(POST_TABLE).Filter(filter).Filter(notDeleted()).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get unannounced posts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) SaveInboxEntry(entry *dialogue.InboxEntry) error {
+	entry.Created = time.Now()
+	res, err := rdb.Table(INBOX_TABLE).Insert(entry).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		entry.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetInboxEntry(id string) (*dialogue.InboxEntry, error) {
+	res, err := rdb.Table(INBOX_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get inbox entry from db: %s", err)
+		return nil, err
+	}
+	var entry *dialogue.InboxEntry
+	if !res.IsNil() {
+		if err := res.Scan(&entry); err != nil {
+			log.Errorf("Unable to get inbox entry from db: %s", err)
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// GetInbox returns the inbox entries for a user, newest first
+func (s *Rethinkdb) GetInbox(username string, unreadOnly bool) ([]*dialogue.InboxEntry, error) {
+	var entries []*dialogue.InboxEntry
+	filter := map[string]interface{}{"username": username}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	res, err := rdb.Table(INBOX_TABLE).Filter(filter).OrderBy(rdb.Desc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get inbox from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var e *dialogue.InboxEntry
+		if err := res.Scan(&e); err != nil {
+			log.Errorf("Unable to deserialize inbox entry from db: %s", err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// MarkInboxRead marks an inbox entry as read.  If id is empty, all of the
+// user's entries are marked as read.
+func (s *Rethinkdb) MarkInboxRead(username string, id string) error {
+	filter := map[string]interface{}{"username": username, "read": false}
+	if id != "" {
+		filter["id"] = id
+	}
+	if _, err := rdb.Table(INBOX_TABLE).Filter(filter).Update(map[string]bool{"read": true}).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
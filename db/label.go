@@ -0,0 +1,213 @@
+package db
+
+import (
+	"regexp"
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) SaveLabel(label *dialogue.Label) error {
+	existing, err := s.GetLabel(label.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrLabelExists
+	}
+	label.Created = time.Now()
+	res, err := rdb.Table(LABEL_TABLE).Insert(label).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		label.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+// UpdateLabel updates the label currently named name.  If the label is
+// renamed, topics using it are updated as well.
+func (s *Rethinkdb) UpdateLabel(name string, label *dialogue.Label) error {
+	existing, err := s.GetLabel(name)
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return ErrLabelNotFound
+	}
+	if label.Name != name {
+		other, err := s.GetLabel(label.Name)
+		if err != nil {
+			return err
+		}
+		if other != nil {
+			return ErrLabelExists
+		}
+	}
+	label.Id = existing.Id
+	label.Created = existing.Created
+	if _, err := rdb.Table(LABEL_TABLE).Get(label.Id).Replace(label).Run(s.session); err != nil {
+		return err
+	}
+	if label.Name != name {
+		update := map[string]interface{}{
+			"labels": rdb.Row.Field("labels").SetDifference([]string{name}).SetInsert(label.Name),
+		}
+		if _, err := rdb.Table(TOPIC_TABLE).GetAllByIndex("labels", name).Update(nextVersion(update)).Run(s.session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteLabel deletes a label and removes it from all topics
+func (s *Rethinkdb) DeleteLabel(name string) error {
+	label, err := s.GetLabel(name)
+	if err != nil {
+		return err
+	}
+	if label == nil {
+		return ErrLabelNotFound
+	}
+	if _, err := rdb.Table(LABEL_TABLE).Get(label.Id).Delete().Run(s.session); err != nil {
+		return err
+	}
+	update := map[string]interface{}{
+		"labels": rdb.Row.Field("labels").SetDifference([]string{name}),
+	}
+	if _, err := rdb.Table(TOPIC_TABLE).GetAllByIndex("labels", name).Update(nextVersion(update)).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetLabel(name string) (*dialogue.Label, error) {
+	res, err := rdb.Table(LABEL_TABLE).GetAllByIndex("name", name).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get label from db: %s", err)
+		return nil, err
+	}
+	var label *dialogue.Label
+	if !res.IsNil() {
+		if err := res.Scan(&label); err != nil {
+			log.Errorf("Unable to get label from db: %s", err)
+			return nil, err
+		}
+	}
+	return label, nil
+}
+
+func (s *Rethinkdb) GetLabels() ([]*dialogue.Label, error) {
+	var labels []*dialogue.Label
+	res, err := rdb.Table(LABEL_TABLE).OrderBy(rdb.Asc("name")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get labels from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var l *dialogue.Label
+		if err := res.Scan(&l); err != nil {
+			log.Errorf("Unable to deserialize label from db: %s", err)
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return labels, nil
+}
+
+// GetTopicsByLabels returns topics with any of the labels, or with all of
+// them if matchAll is true
+func (s *Rethinkdb) GetTopicsByLabels(labels []string, matchAll bool) ([]*dialogue.Topic, error) {
+	var topics []*dialogue.Topic
+	keys := make([]interface{}, len(labels))
+	for i, l := range labels {
+		keys[i] = l
+	}
+	res, err := rdb.Table(TOPIC_TABLE).GetAllByIndex("labels", keys...).Filter(notDeleted()).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get topics from db: %s", err)
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			log.Errorf("Unable to deserialize topic from db: %s", err)
+			return nil, err
+		}
+		// a topic is returned once for each matching label
+		if seen[t.Id] {
+			continue
+		}
+		seen[t.Id] = true
+		if matchAll && !hasLabels(t, labels) {
+			continue
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+func hasLabels(t *dialogue.Topic, labels []string) bool {
+	for _, l := range labels {
+		if !t.HasLabel(l) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search returns topics with titles and posts with content matching query
+// (case insensitive).  If labels are specified, only topics with those
+// labels and their posts are returned.
+func (s *Rethinkdb) Search(query string, labels []string, matchAll bool) (*dialogue.SearchResult, error) {
+	result := &dialogue.SearchResult{
+		Topics: []*dialogue.Topic{},
+		Posts:  []*dialogue.Post{},
+	}
+	var topicIds map[string]bool
+	if len(labels) > 0 {
+		topics, err := s.GetTopicsByLabels(labels, matchAll)
+		if err != nil {
+			return nil, err
+		}
+		topicIds = map[string]bool{}
+		for _, t := range topics {
+			topicIds[t.Id] = true
+		}
+	}
+	pattern := "(?i)" + regexp.QuoteMeta(query)
+	res, err := rdb.Table(TOPIC_TABLE).Filter(rdb.Row.Field("title").Match(pattern)).Filter(notDeleted()).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to search topics: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			log.Errorf("Unable to deserialize topic from db: %s", err)
+			return nil, err
+		}
+		if topicIds == nil || topicIds[t.Id] {
+			result.Topics = append(result.Topics, t)
+		}
+	}
+	res, err = rdb.Table(POST_TABLE).Filter(rdb.Row.Field("content").Match(pattern)).Filter(notDeleted()).Filter(published()).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to search posts: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		if topicIds == nil || topicIds[p.TopicId] {
+			result.Posts = append(result.Posts, p)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,26 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestHasLabels(t *testing.T) {
+	topic := &dialogue.Topic{Labels: []string{"bug", "area:api"}}
+	tests := []struct {
+		labels []string
+		want   bool
+	}{
+		{nil, true},
+		{[]string{"bug"}, true},
+		{[]string{"bug", "area:api"}, true},
+		{[]string{"bug", "feature"}, false},
+		{[]string{"Bug"}, false},
+	}
+	for _, test := range tests {
+		if got := hasLabels(topic, test.labels); got != test.want {
+			t.Errorf("hasLabels(%v) = %v, want %v", test.labels, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+type (
+	// pinnedFirst orders pinned posts before the others
+	pinnedFirst []*dialogue.Post
+)
+
+func (p pinnedFirst) Len() int           { return len(p) }
+func (p pinnedFirst) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pinnedFirst) Less(i, j int) bool { return p[i].Pinned && !p[j].Pinned }
+
+// SetPostPinned pins or unpins a post
+func (s *Rethinkdb) SetPostPinned(id string, pinned bool, username string) error {
+	post, err := s.GetPost(id)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return ErrPostNotFound
+	}
+	update := map[string]interface{}{
+		"pinned":   pinned,
+		"pinnedBy": "",
+	}
+	if pinned {
+		update["pinnedBy"] = username
+	}
+	if _, err := rdb.Table(POST_TABLE).Get(id).Update(nextVersion(update)).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
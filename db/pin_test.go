@@ -0,0 +1,26 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ehazlett/dialogue"
+)
+
+func TestPinnedFirst(t *testing.T) {
+	posts := []*dialogue.Post{
+		{Id: "p1"},
+		{Id: "p2", Pinned: true},
+		{Id: "p3"},
+		{Id: "p4", Pinned: true},
+	}
+	sort.Stable(pinnedFirst(posts))
+	ids := []string{}
+	for _, p := range posts {
+		ids = append(ids, p.Id)
+	}
+	if got := strings.Join(ids, ","); got != "p2,p4,p1,p3" {
+		t.Errorf("posts ordered %s, want p2,p4,p1,p3", got)
+	}
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) SavePoll(poll *dialogue.Poll) error {
+	poll.Created = time.Now()
+	if poll.Votes == nil {
+		poll.Votes = map[string][]int{}
+	}
+	res, err := rdb.Table(POLL_TABLE).Insert(poll).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if len(res.GeneratedKeys) > 0 {
+		poll.Id = res.GeneratedKeys[0]
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetPoll(id string) (*dialogue.Poll, error) {
+	res, err := rdb.Table(POLL_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get poll from db: %s", err)
+		return nil, err
+	}
+	var poll *dialogue.Poll
+	if !res.IsNil() {
+		if err := res.Scan(&poll); err != nil {
+			log.Errorf("Unable to get poll from db: %s", err)
+			return nil, err
+		}
+	}
+	return poll, nil
+}
+
+// GetPolls returns the polls in a topic
+func (s *Rethinkdb) GetPolls(topicId string) ([]*dialogue.Poll, error) {
+	var polls []*dialogue.Poll
+	res, err := rdb.Table(POLL_TABLE).GetAllByIndex("topicId", topicId).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get polls from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Poll
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize poll from db: %s", err)
+			return nil, err
+		}
+		polls = append(polls, p)
+	}
+	return polls, nil
+}
+
+// SavePollVote records the options chosen by username, replacing any
+// earlier vote.  Votes are keyed by username within the poll document, so
+// each user has a single vote and concurrent votes are applied atomically.
+func (s *Rethinkdb) SavePollVote(id string, username string, choices []int) error {
+	update := map[string]interface{}{
+		"votes": map[string]interface{}{
+			username: choices,
+		},
+	}
+	res, err := rdb.Table(POLL_TABLE).Get(id).Update(update).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Skipped > 0 {
+		return ErrPollNotFound
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// maxTokenAttempts limits the retries of a token bucket update that
+// conflicts with other api instances
+const maxTokenAttempts = 5
+
+// TakeToken takes a token from the shared bucket for key, which holds up to
+// capacity tokens and refills at rate tokens per second.  It returns
+// whether a token was taken and the tokens left.  Buckets are updated with
+// compare-and-swap so that several api instances can share them;
+// ErrRateBucketBusy is returned if the bucket kept changing while it was
+// updated.
+func (s *Rethinkdb) TakeToken(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	for i := 0; i < maxTokenAttempts; i++ {
+		res, err := rdb.Table(RATE_LIMIT_TABLE).Get(key).RunRow(s.session)
+		if err != nil {
+			log.Errorf("Unable to get rate limit bucket from db: %s", err)
+			return false, 0, err
+		}
+		if res.IsNil() {
+			bucket := &dialogue.RateBucket{
+				Key:     key,
+				Tokens:  capacity,
+				Updated: now,
+			}
+			ok := bucket.Take(capacity, rate, now)
+			w, err := rdb.Table(RATE_LIMIT_TABLE).Insert(bucket).RunWrite(s.session)
+			if err != nil {
+				return false, 0, err
+			}
+			if w.Inserted == 1 {
+				return ok, bucket.Tokens, nil
+			}
+			// created by another instance in the meantime
+			continue
+		}
+		var bucket *dialogue.RateBucket
+		if err := res.Scan(&bucket); err != nil {
+			log.Errorf("Unable to get rate limit bucket from db: %s", err)
+			return false, 0, err
+		}
+		v := bucket.Version
+		ok := bucket.Take(capacity, rate, now)
+		bucket.Version++
+		err = s.replaceVersion(RATE_LIMIT_TABLE, key, v, bucket)
+		if err == ErrVersionConflict {
+			continue
+		}
+		if err != nil {
+			return false, 0, err
+		}
+		return ok, bucket.Tokens, nil
+	}
+	// the bucket is too busy to update, which only happens under load
+	return false, 0, ErrRateBucketBusy
+}
+
+// PurgeRateBuckets deletes buckets that have not been used since before.
+// They would have refilled completely, so they are no longer needed.
+func (s *Rethinkdb) PurgeRateBuckets(before time.Time) (int, error) {
+	res, err := rdb.Table(RATE_LIMIT_TABLE).Filter(rdb.Row.Field("updated").Lt(before)).Delete().RunWrite(s.session)
+	if err != nil {
+		return 0, err
+	}
+	return res.Deleted, nil
+}
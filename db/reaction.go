@@ -0,0 +1,42 @@
+package db
+
+import (
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// AddReaction adds username to the users for the named reaction on a post.
+// The post is updated in a single atomic write, so concurrent reactions
+// neither duplicate users nor overwrite each other.
+func (s *Rethinkdb) AddReaction(postId string, name string, username string) (*dialogue.Post, error) {
+	update := map[string]interface{}{
+		"reactions": map[string]interface{}{
+			name: rdb.Row.Field("reactions").Field(name).Default([]string{}).SetInsert(username),
+		},
+	}
+	return s.updateReactions(postId, update)
+}
+
+// RemoveReaction removes username from the users for the named reaction
+func (s *Rethinkdb) RemoveReaction(postId string, name string, username string) (*dialogue.Post, error) {
+	update := map[string]interface{}{
+		"reactions": map[string]interface{}{
+			name: rdb.Row.Field("reactions").Field(name).Default([]string{}).SetDifference([]string{username}),
+		},
+	}
+	return s.updateReactions(postId, update)
+}
+
+func (s *Rethinkdb) updateReactions(postId string, update map[string]interface{}) (*dialogue.Post, error) {
+	post, err := s.GetPost(postId)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	if _, err := rdb.Table(POST_TABLE).Get(postId).Update(nextVersion(update)).RunWrite(s.session); err != nil {
+		return nil, err
+	}
+	return s.GetPost(postId)
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// SaveReadMarker records that a user has read a topic up to lastRead
+func (s *Rethinkdb) SaveReadMarker(username string, topicId string, lastRead time.Time) error {
+	tbl := rdb.Table(READ_TABLE)
+	filter := map[string]string{"username": username, "topicId": topicId}
+	row, err := tbl.Filter(filter).RunRow(s.session)
+	if err != nil {
+		return err
+	}
+	if row.IsNil() {
+		marker := &dialogue.ReadMarker{
+			Username: username,
+			TopicId:  topicId,
+			LastRead: lastRead,
+		}
+		if _, err := tbl.Insert(marker).Run(s.session); err != nil {
+			return err
+		}
+		return nil
+	}
+	if _, err := tbl.Filter(filter).Update(map[string]interface{}{"lastRead": lastRead}).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetReadMarkers(username string) ([]*dialogue.ReadMarker, error) {
+	var markers []*dialogue.ReadMarker
+	res, err := rdb.Table(READ_TABLE).Filter(map[string]string{"username": username}).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get read markers from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var m *dialogue.ReadMarker
+		if err := res.Scan(&m); err != nil {
+			log.Errorf("Unable to deserialize read marker from db: %s", err)
+			return nil, err
+		}
+		markers = append(markers, m)
+	}
+	return markers, nil
+}
+
+// GetUnreadCounts returns the number of posts by other users that username
+// has not read in the given topics, keyed by topic id.  Topics without
+// unread posts are omitted.  Posts are read with the topicId index and
+// counted by the database.
+func (s *Rethinkdb) GetUnreadCounts(username string, topicIds []string) (map[string]int, error) {
+	counts := map[string]int{}
+	if len(topicIds) == 0 {
+		return counts, nil
+	}
+	markers, err := s.GetReadMarkers(username)
+	if err != nil {
+		return nil, err
+	}
+	lastRead := map[string]time.Time{}
+	for _, m := range markers {
+		lastRead[m.TopicId] = m.LastRead
+	}
+	keys := make([]interface{}, len(topicIds))
+	for i, id := range topicIds {
+		keys[i] = id
+	}
+	unread := rdb.Row.Field("author").Ne(username).And(rdb.Row.Field("created").Gt(rdb.Expr(lastRead).Field(rdb.Row.Field("topicId")).Default(time.Unix(0, 0))))
+	res, err := rdb.Table(POST_TABLE).GetAllByIndex("topicId", keys...).Filter(notDeleted()).Filter(published()).Filter(unread).Group("topicId").Count().Ungroup().Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to count unread posts: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var c struct {
+			TopicId string `gorethink:"group"`
+			Count   int    `gorethink:"reduction"`
+		}
+		if err := res.Scan(&c); err != nil {
+			log.Errorf("Unable to deserialize unread count from db: %s", err)
+			return nil, err
+		}
+		counts[c.TopicId] = c.Count
+	}
+	return counts, nil
+}
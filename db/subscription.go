@@ -0,0 +1,139 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+func (s *Rethinkdb) subscriptionExists(username string, topicId string) bool {
+	row, err := rdb.Table(SUBSCRIPTION_TABLE).Filter(map[string]string{"username": username, "topicId": topicId}).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Error checking for subscription: %s", err)
+		return true
+	}
+	return !row.IsNil()
+}
+
+func (s *Rethinkdb) SaveSubscription(sub *dialogue.Subscription) error {
+	if s.subscriptionExists(sub.Username, sub.TopicId) {
+		return ErrSubscriptionExists
+	}
+	now := time.Now()
+	sub.Created = now
+	// only deliver posts created after subscribing
+	sub.LastSent = now
+	if _, err := rdb.Table(SUBSCRIPTION_TABLE).Insert(sub).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) UpdateSubscription(sub *dialogue.Subscription) error {
+	if _, err := rdb.Table(SUBSCRIPTION_TABLE).Get(sub.Id).Update(sub).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) DeleteSubscription(id string) error {
+	tbl := rdb.Table(SUBSCRIPTION_TABLE)
+	row, err := tbl.Get(id).RunRow(s.session)
+	if err != nil {
+		return err
+	}
+	if row.IsNil() {
+		return ErrSubscriptionNotFound
+	}
+	if _, err := tbl.Get(id).Delete().Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) GetSubscription(id string) (*dialogue.Subscription, error) {
+	res, err := rdb.Table(SUBSCRIPTION_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get subscription from db: %s", err)
+		return nil, err
+	}
+	var sub *dialogue.Subscription
+	if !res.IsNil() {
+		if err := res.Scan(&sub); err != nil {
+			log.Errorf("Unable to get subscription from db: %s", err)
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+func (s *Rethinkdb) GetSubscriptionByToken(token string) (*dialogue.Subscription, error) {
+	res, err := rdb.Table(SUBSCRIPTION_TABLE).Filter(map[string]string{"unsubscribeToken": token}).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get subscription from db: %s", err)
+		return nil, err
+	}
+	var sub *dialogue.Subscription
+	if !res.IsNil() {
+		if err := res.Scan(&sub); err != nil {
+			log.Errorf("Unable to get subscription from db: %s", err)
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+func (s *Rethinkdb) getSubscriptions(filter map[string]string) ([]*dialogue.Subscription, error) {
+	var subs []*dialogue.Subscription
+	res, err := rdb.Table(SUBSCRIPTION_TABLE).Filter(filter).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get subscriptions from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var sub *dialogue.Subscription
+		if err := res.Scan(&sub); err != nil {
+			log.Errorf("Unable to deserialize subscription from db: %s", err)
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// GetSubscriptions returns all subscriptions for the specified user
+func (s *Rethinkdb) GetSubscriptions(username string) ([]*dialogue.Subscription, error) {
+	return s.getSubscriptions(map[string]string{"username": username})
+}
+
+// GetSubscriptionsByMode returns all subscriptions using the specified delivery mode
+func (s *Rethinkdb) GetSubscriptionsByMode(mode string) ([]*dialogue.Subscription, error) {
+	return s.getSubscriptions(map[string]string{"mode": mode})
+}
+
+// GetPostsSince returns posts created after the specified time.  If topicId
+// is empty, posts from all topics are returned.  Posts in topics that are
+// in the trash are left out.
+func (s *Rethinkdb) GetPostsSince(topicId string, since time.Time) ([]*dialogue.Post, error) {
+	var posts []*dialogue.Post
+	topicLive := rdb.Table(TOPIC_TABLE).Get(rdb.Row.Field("topicId")).HasFields("deletedAt").Not().Default(false)
+	filter := rdb.Row.Field("created").Gt(since).And(notDeleted()).And(published()).And(topicLive)
+	if topicId != "" {
+		filter = filter.And(rdb.Row.Field("topicId").Eq(topicId))
+	}
+	res, err := rdb.Table(POST_TABLE).Filter(filter).OrderBy(rdb.Asc("created")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get posts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, nil
+}
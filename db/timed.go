@@ -0,0 +1,455 @@
+package db
+
+import (
+	"time"
+
+	"github.com/ehazlett/dialogue"
+)
+
+type (
+	// Observer is told how long each call to a Db took
+	Observer func(method string, d time.Duration)
+	// timedDb times the calls to another Db
+	timedDb struct {
+		db      Db
+		observe Observer
+	}
+)
+
+// NewTimedDb returns a Db that reports the duration of each call to d to
+// observe
+func NewTimedDb(d Db, observe Observer) Db {
+	return &timedDb{
+		db:      d,
+		observe: observe,
+	}
+}
+
+func (t *timedDb) done(method string, start time.Time) {
+	t.observe(method, time.Since(start))
+}
+
+func (t *timedDb) SaveTopic(topic *dialogue.Topic) error {
+	defer t.done("SaveTopic", time.Now())
+	return t.db.SaveTopic(topic)
+}
+
+func (t *timedDb) UpdateTopic(topic *dialogue.Topic) error {
+	defer t.done("UpdateTopic", time.Now())
+	return t.db.UpdateTopic(topic)
+}
+
+func (t *timedDb) ClaimTopicReminder(id string, overdue bool) (bool, error) {
+	defer t.done("ClaimTopicReminder", time.Now())
+	return t.db.ClaimTopicReminder(id, overdue)
+}
+
+func (t *timedDb) ResetTopicReminders(id string) error {
+	defer t.done("ResetTopicReminders", time.Now())
+	return t.db.ResetTopicReminders(id)
+}
+
+func (t *timedDb) DeleteTopic(id string, username string, version int) error {
+	defer t.done("DeleteTopic", time.Now())
+	return t.db.DeleteTopic(id, username, version)
+}
+
+func (t *timedDb) GetTopic(id string) (*dialogue.Topic, error) {
+	defer t.done("GetTopic", time.Now())
+	return t.db.GetTopic(id)
+}
+
+func (t *timedDb) GetTopics() ([]*dialogue.Topic, error) {
+	defer t.done("GetTopics", time.Now())
+	return t.db.GetTopics()
+}
+
+func (t *timedDb) GetTopicsById(ids []string) ([]*dialogue.Topic, error) {
+	defer t.done("GetTopicsById", time.Now())
+	return t.db.GetTopicsById(ids)
+}
+
+func (t *timedDb) SavePost(post *dialogue.Post) error {
+	defer t.done("SavePost", time.Now())
+	return t.db.SavePost(post)
+}
+
+func (t *timedDb) UpdatePost(post *dialogue.Post) error {
+	defer t.done("UpdatePost", time.Now())
+	return t.db.UpdatePost(post)
+}
+
+func (t *timedDb) UpdatePostHtml(id string, html string, hash string) error {
+	defer t.done("UpdatePostHtml", time.Now())
+	return t.db.UpdatePostHtml(id, html, hash)
+}
+
+func (t *timedDb) DeletePost(id string, username string, version int) error {
+	defer t.done("DeletePost", time.Now())
+	return t.db.DeletePost(id, username, version)
+}
+
+func (t *timedDb) GetPost(id string) (*dialogue.Post, error) {
+	defer t.done("GetPost", time.Now())
+	return t.db.GetPost(id)
+}
+
+func (t *timedDb) GetPosts(topicId string) ([]*dialogue.Post, error) {
+	defer t.done("GetPosts", time.Now())
+	return t.db.GetPosts(topicId)
+}
+
+func (t *timedDb) FindPosts(topicIds []string, author string, since, until *time.Time, limit int) ([]*dialogue.Post, error) {
+	defer t.done("FindPosts", time.Now())
+	return t.db.FindPosts(topicIds, author, since, until, limit)
+}
+
+func (t *timedDb) GetTopicActivity(topicId string) (int, *time.Time, error) {
+	defer t.done("GetTopicActivity", time.Now())
+	return t.db.GetTopicActivity(topicId)
+}
+
+func (t *timedDb) SaveUser(user *dialogue.User) error {
+	defer t.done("SaveUser", time.Now())
+	return t.db.SaveUser(user)
+}
+
+func (t *timedDb) UpdateUser(user *dialogue.User) error {
+	defer t.done("UpdateUser", time.Now())
+	return t.db.UpdateUser(user)
+}
+
+func (t *timedDb) GetUser(username string) (*dialogue.User, error) {
+	defer t.done("GetUser", time.Now())
+	return t.db.GetUser(username)
+}
+
+func (t *timedDb) GetUserByEmail(email string) (*dialogue.User, error) {
+	defer t.done("GetUserByEmail", time.Now())
+	return t.db.GetUserByEmail(email)
+}
+
+func (t *timedDb) DeleteUser(username string) error {
+	defer t.done("DeleteUser", time.Now())
+	return t.db.DeleteUser(username)
+}
+
+func (t *timedDb) GetAuthorization(username string) (*dialogue.Authorization, error) {
+	defer t.done("GetAuthorization", time.Now())
+	return t.db.GetAuthorization(username)
+}
+
+func (t *timedDb) SaveAuthorization(auth *dialogue.Authorization) error {
+	defer t.done("SaveAuthorization", time.Now())
+	return t.db.SaveAuthorization(auth)
+}
+
+func (t *timedDb) SaveSubscription(sub *dialogue.Subscription) error {
+	defer t.done("SaveSubscription", time.Now())
+	return t.db.SaveSubscription(sub)
+}
+
+func (t *timedDb) UpdateSubscription(sub *dialogue.Subscription) error {
+	defer t.done("UpdateSubscription", time.Now())
+	return t.db.UpdateSubscription(sub)
+}
+
+func (t *timedDb) DeleteSubscription(id string) error {
+	defer t.done("DeleteSubscription", time.Now())
+	return t.db.DeleteSubscription(id)
+}
+
+func (t *timedDb) GetSubscription(id string) (*dialogue.Subscription, error) {
+	defer t.done("GetSubscription", time.Now())
+	return t.db.GetSubscription(id)
+}
+
+func (t *timedDb) GetSubscriptionByToken(token string) (*dialogue.Subscription, error) {
+	defer t.done("GetSubscriptionByToken", time.Now())
+	return t.db.GetSubscriptionByToken(token)
+}
+
+func (t *timedDb) GetSubscriptions(username string) ([]*dialogue.Subscription, error) {
+	defer t.done("GetSubscriptions", time.Now())
+	return t.db.GetSubscriptions(username)
+}
+
+func (t *timedDb) GetSubscriptionsByMode(mode string) ([]*dialogue.Subscription, error) {
+	defer t.done("GetSubscriptionsByMode", time.Now())
+	return t.db.GetSubscriptionsByMode(mode)
+}
+
+func (t *timedDb) GetPostsSince(topicId string, since time.Time) ([]*dialogue.Post, error) {
+	defer t.done("GetPostsSince", time.Now())
+	return t.db.GetPostsSince(topicId, since)
+}
+
+func (t *timedDb) SaveInboxEntry(entry *dialogue.InboxEntry) error {
+	defer t.done("SaveInboxEntry", time.Now())
+	return t.db.SaveInboxEntry(entry)
+}
+
+func (t *timedDb) GetInboxEntry(id string) (*dialogue.InboxEntry, error) {
+	defer t.done("GetInboxEntry", time.Now())
+	return t.db.GetInboxEntry(id)
+}
+
+func (t *timedDb) GetInbox(username string, unreadOnly bool) ([]*dialogue.InboxEntry, error) {
+	defer t.done("GetInbox", time.Now())
+	return t.db.GetInbox(username, unreadOnly)
+}
+
+func (t *timedDb) MarkInboxRead(username string, id string) error {
+	defer t.done("MarkInboxRead", time.Now())
+	return t.db.MarkInboxRead(username, id)
+}
+
+func (t *timedDb) SaveReadMarker(username string, topicId string, lastRead time.Time) error {
+	defer t.done("SaveReadMarker", time.Now())
+	return t.db.SaveReadMarker(username, topicId, lastRead)
+}
+
+func (t *timedDb) GetReadMarkers(username string) ([]*dialogue.ReadMarker, error) {
+	defer t.done("GetReadMarkers", time.Now())
+	return t.db.GetReadMarkers(username)
+}
+
+func (t *timedDb) GetUnreadCounts(username string, topicIds []string) (map[string]int, error) {
+	defer t.done("GetUnreadCounts", time.Now())
+	return t.db.GetUnreadCounts(username, topicIds)
+}
+
+func (t *timedDb) SaveLabel(label *dialogue.Label) error {
+	defer t.done("SaveLabel", time.Now())
+	return t.db.SaveLabel(label)
+}
+
+func (t *timedDb) UpdateLabel(name string, label *dialogue.Label) error {
+	defer t.done("UpdateLabel", time.Now())
+	return t.db.UpdateLabel(name, label)
+}
+
+func (t *timedDb) DeleteLabel(name string) error {
+	defer t.done("DeleteLabel", time.Now())
+	return t.db.DeleteLabel(name)
+}
+
+func (t *timedDb) GetLabel(name string) (*dialogue.Label, error) {
+	defer t.done("GetLabel", time.Now())
+	return t.db.GetLabel(name)
+}
+
+func (t *timedDb) GetLabels() ([]*dialogue.Label, error) {
+	defer t.done("GetLabels", time.Now())
+	return t.db.GetLabels()
+}
+
+func (t *timedDb) GetTopicsByLabels(labels []string, matchAll bool) ([]*dialogue.Topic, error) {
+	defer t.done("GetTopicsByLabels", time.Now())
+	return t.db.GetTopicsByLabels(labels, matchAll)
+}
+
+func (t *timedDb) Search(query string, labels []string, matchAll bool) (*dialogue.SearchResult, error) {
+	defer t.done("Search", time.Now())
+	return t.db.Search(query, labels, matchAll)
+}
+
+func (t *timedDb) SaveCategory(cat *dialogue.Category) error {
+	defer t.done("SaveCategory", time.Now())
+	return t.db.SaveCategory(cat)
+}
+
+func (t *timedDb) UpdateCategory(cat *dialogue.Category) error {
+	defer t.done("UpdateCategory", time.Now())
+	return t.db.UpdateCategory(cat)
+}
+
+func (t *timedDb) DeleteCategory(id string) error {
+	defer t.done("DeleteCategory", time.Now())
+	return t.db.DeleteCategory(id)
+}
+
+func (t *timedDb) GetCategory(id string) (*dialogue.Category, error) {
+	defer t.done("GetCategory", time.Now())
+	return t.db.GetCategory(id)
+}
+
+func (t *timedDb) GetCategories() ([]*dialogue.Category, error) {
+	defer t.done("GetCategories", time.Now())
+	return t.db.GetCategories()
+}
+
+func (t *timedDb) GetTopicsByCategory(ids []string) ([]*dialogue.Topic, error) {
+	defer t.done("GetTopicsByCategory", time.Now())
+	return t.db.GetTopicsByCategory(ids)
+}
+
+func (t *timedDb) GetDeletedTopic(id string) (*dialogue.Topic, error) {
+	defer t.done("GetDeletedTopic", time.Now())
+	return t.db.GetDeletedTopic(id)
+}
+
+func (t *timedDb) GetDeletedPost(id string) (*dialogue.Post, error) {
+	defer t.done("GetDeletedPost", time.Now())
+	return t.db.GetDeletedPost(id)
+}
+
+func (t *timedDb) RestoreTopic(id string) error {
+	defer t.done("RestoreTopic", time.Now())
+	return t.db.RestoreTopic(id)
+}
+
+func (t *timedDb) RestorePost(id string) error {
+	defer t.done("RestorePost", time.Now())
+	return t.db.RestorePost(id)
+}
+
+func (t *timedDb) GetTrash() (*dialogue.Trash, error) {
+	defer t.done("GetTrash", time.Now())
+	return t.db.GetTrash()
+}
+
+func (t *timedDb) PurgeTrash(before time.Time) (int, error) {
+	defer t.done("PurgeTrash", time.Now())
+	return t.db.PurgeTrash(before)
+}
+
+func (t *timedDb) ArchiveTopics(createdBefore time.Time, inactiveSince time.Time) (int, error) {
+	defer t.done("ArchiveTopics", time.Now())
+	return t.db.ArchiveTopics(createdBefore, inactiveSince)
+}
+
+func (t *timedDb) SaveAttachment(a *dialogue.Attachment) error {
+	defer t.done("SaveAttachment", time.Now())
+	return t.db.SaveAttachment(a)
+}
+
+func (t *timedDb) UpdateAttachment(a *dialogue.Attachment) error {
+	defer t.done("UpdateAttachment", time.Now())
+	return t.db.UpdateAttachment(a)
+}
+
+func (t *timedDb) GetAttachment(id string) (*dialogue.Attachment, error) {
+	defer t.done("GetAttachment", time.Now())
+	return t.db.GetAttachment(id)
+}
+
+func (t *timedDb) GetOrphanedAttachments(before time.Time) ([]*dialogue.Attachment, error) {
+	defer t.done("GetOrphanedAttachments", time.Now())
+	return t.db.GetOrphanedAttachments(before)
+}
+
+func (t *timedDb) DeleteAttachment(id string) error {
+	defer t.done("DeleteAttachment", time.Now())
+	return t.db.DeleteAttachment(id)
+}
+
+func (t *timedDb) AddReaction(postId string, name string, username string) (*dialogue.Post, error) {
+	defer t.done("AddReaction", time.Now())
+	return t.db.AddReaction(postId, name, username)
+}
+
+func (t *timedDb) RemoveReaction(postId string, name string, username string) (*dialogue.Post, error) {
+	defer t.done("RemoveReaction", time.Now())
+	return t.db.RemoveReaction(postId, name, username)
+}
+
+func (t *timedDb) SetPostPinned(id string, pinned bool, username string) error {
+	defer t.done("SetPostPinned", time.Now())
+	return t.db.SetPostPinned(id, pinned, username)
+}
+
+func (t *timedDb) SavePoll(poll *dialogue.Poll) error {
+	defer t.done("SavePoll", time.Now())
+	return t.db.SavePoll(poll)
+}
+
+func (t *timedDb) GetPoll(id string) (*dialogue.Poll, error) {
+	defer t.done("GetPoll", time.Now())
+	return t.db.GetPoll(id)
+}
+
+func (t *timedDb) GetPolls(topicId string) ([]*dialogue.Poll, error) {
+	defer t.done("GetPolls", time.Now())
+	return t.db.GetPolls(topicId)
+}
+
+func (t *timedDb) SavePollVote(id string, username string, choices []int) error {
+	defer t.done("SavePollVote", time.Now())
+	return t.db.SavePollVote(id, username, choices)
+}
+
+func (t *timedDb) GetDraft(id string) (*dialogue.Post, error) {
+	defer t.done("GetDraft", time.Now())
+	return t.db.GetDraft(id)
+}
+
+func (t *timedDb) GetDrafts(author string) ([]*dialogue.Post, error) {
+	defer t.done("GetDrafts", time.Now())
+	return t.db.GetDrafts(author)
+}
+
+func (t *timedDb) GetDuePosts(now time.Time) ([]*dialogue.Post, error) {
+	defer t.done("GetDuePosts", time.Now())
+	return t.db.GetDuePosts(now)
+}
+
+func (t *timedDb) UpdateDraft(post *dialogue.Post) (bool, error) {
+	defer t.done("UpdateDraft", time.Now())
+	return t.db.UpdateDraft(post)
+}
+
+func (t *timedDb) DeleteDraft(id string, version int) error {
+	defer t.done("DeleteDraft", time.Now())
+	return t.db.DeleteDraft(id, version)
+}
+
+func (t *timedDb) PublishPost(post *dialogue.Post) (bool, error) {
+	defer t.done("PublishPost", time.Now())
+	return t.db.PublishPost(post)
+}
+
+func (t *timedDb) ClaimPostAnnouncement(id string) (bool, error) {
+	defer t.done("ClaimPostAnnouncement", time.Now())
+	return t.db.ClaimPostAnnouncement(id)
+}
+
+func (t *timedDb) GetUnannouncedPosts(before time.Time) ([]*dialogue.Post, error) {
+	defer t.done("GetUnannouncedPosts", time.Now())
+	return t.db.GetUnannouncedPosts(before)
+}
+
+func (t *timedDb) TakeToken(key string, capacity, rate float64, now time.Time) (bool, float64, error) {
+	defer t.done("TakeToken", time.Now())
+	return t.db.TakeToken(key, capacity, rate, now)
+}
+
+func (t *timedDb) PurgeRateBuckets(before time.Time) (int, error) {
+	defer t.done("PurgeRateBuckets", time.Now())
+	return t.db.PurgeRateBuckets(before)
+}
+
+func (t *timedDb) SaveAuditEntry(entry *dialogue.AuditEntry) error {
+	defer t.done("SaveAuditEntry", time.Now())
+	return t.db.SaveAuditEntry(entry)
+}
+
+func (t *timedDb) FindAuditEntries(action string, actor string, target string, since, until *time.Time, limit int) ([]*dialogue.AuditEntry, error) {
+	defer t.done("FindAuditEntries", time.Now())
+	return t.db.FindAuditEntries(action, actor, target, since, until, limit)
+}
+
+func (t *timedDb) PurgeAuditEntries(before time.Time) (int, error) {
+	defer t.done("PurgeAuditEntries", time.Now())
+	return t.db.PurgeAuditEntries(before)
+}
+
+func (t *timedDb) Ping() error {
+	defer t.done("Ping", time.Now())
+	return t.db.Ping()
+}
+
+func (t *timedDb) Close() error {
+	defer t.done("Close", time.Now())
+	return t.db.Close()
+}
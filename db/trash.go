@@ -0,0 +1,175 @@
+package db
+
+import (
+	"time"
+
+	rdb "github.com/dancannon/gorethink"
+	"github.com/ehazlett/dialogue"
+)
+
+// notDeleted matches documents that are not in the trash
+func notDeleted() rdb.Term {
+	return rdb.Row.HasFields("deletedAt").Not()
+}
+
+func deleted(username string) map[string]interface{} {
+	return map[string]interface{}{
+		"deletedAt": time.Now(),
+		"deletedBy": username,
+	}
+}
+
+// restored removes the trash fields from a document
+func restored() rdb.Term {
+	return rdb.Row.Without("deletedAt", "deletedBy").Merge(map[string]interface{}{"version": version().Add(1)})
+}
+
+// GetDeletedTopic returns a topic from the trash
+func (s *Rethinkdb) GetDeletedTopic(id string) (*dialogue.Topic, error) {
+	res, err := rdb.Table(TOPIC_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get topic from db: %s", err)
+		return nil, err
+	}
+	var topic *dialogue.Topic
+	if !res.IsNil() {
+		if err := res.Scan(&topic); err != nil {
+			log.Errorf("Unable to get topic from db: %s", err)
+			return nil, err
+		}
+	}
+	if topic != nil && topic.DeletedAt == nil {
+		return nil, nil
+	}
+	return topic, nil
+}
+
+// GetDeletedPost returns a post from the trash
+func (s *Rethinkdb) GetDeletedPost(id string) (*dialogue.Post, error) {
+	res, err := rdb.Table(POST_TABLE).Get(id).RunRow(s.session)
+	if err != nil {
+		log.Errorf("Unable to get post from db: %s", err)
+		return nil, err
+	}
+	var post *dialogue.Post
+	if !res.IsNil() {
+		if err := res.Scan(&post); err != nil {
+			log.Errorf("Unable to get post from db: %s", err)
+			return nil, err
+		}
+	}
+	if post != nil && post.DeletedAt == nil {
+		return nil, nil
+	}
+	return post, nil
+}
+
+func (s *Rethinkdb) RestoreTopic(id string) error {
+	topic, err := s.GetDeletedTopic(id)
+	if err != nil {
+		return err
+	}
+	if topic == nil {
+		return ErrTopicNotFound
+	}
+	if _, err := rdb.Table(TOPIC_TABLE).Get(id).Replace(restored()).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *Rethinkdb) RestorePost(id string) error {
+	post, err := s.GetDeletedPost(id)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return ErrPostNotFound
+	}
+	if _, err := rdb.Table(POST_TABLE).Get(id).Replace(restored()).Run(s.session); err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetTrash returns deleted topics and posts, most recently deleted first
+func (s *Rethinkdb) GetTrash() (*dialogue.Trash, error) {
+	trash := &dialogue.Trash{
+		Topics: []*dialogue.Topic{},
+		Posts:  []*dialogue.Post{},
+	}
+	res, err := rdb.Table(TOPIC_TABLE).Filter(rdb.Row.HasFields("deletedAt")).OrderBy(rdb.Desc("deletedAt")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get deleted topics from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			log.Errorf("Unable to deserialize topic from db: %s", err)
+			return nil, err
+		}
+		trash.Topics = append(trash.Topics, t)
+	}
+	res, err = rdb.Table(POST_TABLE).Filter(rdb.Row.HasFields("deletedAt")).OrderBy(rdb.Desc("deletedAt")).Run(s.session)
+	if err != nil {
+		log.Errorf("Unable to get deleted posts from db: %s", err)
+		return nil, err
+	}
+	for res.Next() {
+		var p *dialogue.Post
+		if err := res.Scan(&p); err != nil {
+			log.Errorf("Unable to deserialize post from db: %s", err)
+			return nil, err
+		}
+		trash.Posts = append(trash.Posts, p)
+	}
+	return trash, nil
+}
+
+// PurgeTrash permanently deletes topics and posts that were deleted before
+// the given time, along with all posts, polls, subscriptions, read markers
+// and inbox entries of the purged topics.  It returns the number of topics
+// and posts removed.
+func (s *Rethinkdb) PurgeTrash(before time.Time) (int, error) {
+	expired := rdb.Row.HasFields("deletedAt").And(rdb.Row.Field("deletedAt").Lt(before))
+	res, err := rdb.Table(TOPIC_TABLE).Filter(expired).Pluck("id").Run(s.session)
+	if err != nil {
+		return 0, err
+	}
+	var ids []interface{}
+	for res.Next() {
+		var t *dialogue.Topic
+		if err := res.Scan(&t); err != nil {
+			return 0, err
+		}
+		ids = append(ids, t.Id)
+	}
+	count := 0
+	if len(ids) > 0 {
+		w, err := rdb.Table(POST_TABLE).Filter(rdb.Expr(ids).Contains(rdb.Row.Field("topicId"))).Delete().RunWrite(s.session)
+		if err != nil {
+			return count, err
+		}
+		count += w.Deleted
+		if _, err := rdb.Table(POLL_TABLE).GetAllByIndex("topicId", ids...).Delete().RunWrite(s.session); err != nil {
+			return count, err
+		}
+		for _, table := range []string{SUBSCRIPTION_TABLE, READ_TABLE, INBOX_TABLE} {
+			if _, err := rdb.Table(table).Filter(rdb.Expr(ids).Contains(rdb.Row.Field("topicId"))).Delete().RunWrite(s.session); err != nil {
+				return count, err
+			}
+		}
+		w, err = rdb.Table(TOPIC_TABLE).Filter(expired).Delete().RunWrite(s.session)
+		if err != nil {
+			return count, err
+		}
+		count += w.Deleted
+	}
+	w, err := rdb.Table(POST_TABLE).Filter(expired).Delete().RunWrite(s.session)
+	if err != nil {
+		return count, err
+	}
+	count += w.Deleted
+	return count, nil
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	rdb "github.com/dancannon/gorethink"
+)
+
+// Topics, posts and users have a version that every write increments.
+// Documents that were read earlier are only written back if their
+// version has not changed in the meantime (compare-and-swap), so
+// concurrent edits can't overwrite each other.
+
+// version is the version of the current document.  Documents written
+// before versions were added are at version 0.
+func version() rdb.Term {
+	return rdb.Row.Field("version").Default(0)
+}
+
+// hasVersion matches documents at version v
+func hasVersion(v int) rdb.Term {
+	return version().Eq(v)
+}
+
+// nextVersion adds a version increment to a partial update
+func nextVersion(update map[string]interface{}) map[string]interface{} {
+	update["version"] = version().Add(1)
+	return update
+}
+
+// updateVersion applies update to a document if it is still at version v.
+// ErrVersionConflict is returned if the document has changed.
+func (s *Rethinkdb) updateVersion(table string, id string, v int, update map[string]interface{}) error {
+	res, err := rdb.Table(table).Get(id).Update(rdb.Branch(hasVersion(v), nextVersion(update), map[string]interface{}{})).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Replaced == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// replaceVersion replaces a document with doc if it is still at version
+// v.  ErrVersionConflict is returned if the document has changed.
+func (s *Rethinkdb) replaceVersion(table string, id string, v int, doc interface{}) error {
+	res, err := rdb.Table(table).Get(id).Replace(rdb.Branch(hasVersion(v), doc, rdb.Row)).RunWrite(s.session)
+	if err != nil {
+		return err
+	}
+	if res.Replaced == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+type (
+	// FileMailer writes each message to a file in a directory instead of
+	// delivering it.  Useful for development and testing.
+	FileMailer struct {
+		dir   string
+		mu    sync.Mutex
+		count int
+	}
+)
+
+func NewFileMailer(dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	m := &FileMailer{
+		dir: dir,
+	}
+	return m, nil
+}
+
+func (m *FileMailer) Send(msg *Message) error {
+	b, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.count++
+	name := fmt.Sprintf("%d-%04d.eml", time.Now().UnixNano(), m.count)
+	m.mu.Unlock()
+	return ioutil.WriteFile(filepath.Join(m.dir, name), b, 0600)
+}
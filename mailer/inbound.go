@@ -0,0 +1,174 @@
+package mailer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+type (
+	// InboundMessage is the relevant subset of a received RFC 5322 message
+	InboundMessage struct {
+		From    string
+		To      []string
+		Subject string
+		Text    string
+	}
+
+	// Bounce is returned when an inbound message is rejected permanently
+	Bounce struct {
+		Reason string
+	}
+)
+
+var (
+	ErrNoTextBody = errors.New("message has no text/plain body")
+
+	quoteHeaderRe = regexp.MustCompile(`^On .+ wrote:$`)
+)
+
+func (b *Bounce) Error() string {
+	return b.Reason
+}
+
+// ParseMessage parses a raw MIME message and extracts its plain text body
+func ParseMessage(data []byte) (*InboundMessage, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return nil, err
+	}
+	in := &InboundMessage{
+		From:    strings.ToLower(from.Address),
+		Subject: msg.Header.Get("Subject"),
+	}
+	if to, err := msg.Header.AddressList("To"); err == nil {
+		for _, a := range to {
+			in.To = append(in.To, strings.ToLower(a.Address))
+		}
+	}
+	text, err := textBody(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body)
+	if err != nil {
+		return nil, err
+	}
+	in.Text = text
+	return in, nil
+}
+
+func decodeBody(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(encoding) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+func textBody(contentType string, encoding string, body io.Reader) (string, error) {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == "text/plain" {
+		b, err := ioutil.ReadAll(decodeBody(encoding, body))
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return "", ErrNoTextBody
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return "", ErrNoTextBody
+		}
+		if err != nil {
+			return "", err
+		}
+		text, err := textBody(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p)
+		if err == ErrNoTextBody {
+			continue
+		}
+		return text, err
+	}
+}
+
+// StripReply removes quoted text and signatures from a reply
+func StripReply(text string) string {
+	var lines []string
+	s := bufio.NewScanner(strings.NewReader(text))
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \r")
+		trimmed := strings.TrimSpace(line)
+		// stop at signatures and quoted replies
+		if line == "--" || quoteHeaderRe.MatchString(trimmed) ||
+			strings.HasPrefix(trimmed, "-----Original Message-----") ||
+			strings.HasPrefix(trimmed, "________________________________") {
+			break
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func replySignature(secret, topicId, username string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(topicId + ":" + username))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ReplyAddress returns a reply address for topicId that is only valid
+// when used by username
+func ReplyAddress(secret, domain, topicId, username string) string {
+	return fmt.Sprintf("reply+%s.%s@%s", topicId, replySignature(secret, topicId, username), domain)
+}
+
+// ParseReplyAddress returns the topic id for a reply address if its
+// signature is valid for username
+func ParseReplyAddress(secret, address, username string) (string, bool) {
+	local := strings.SplitN(address, "@", 2)[0]
+	if !strings.HasPrefix(local, "reply+") {
+		return "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(local, "reply+"), ".", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	topicId, sig := parts[0], parts[1]
+	if !hmac.Equal([]byte(sig), []byte(replySignature(secret, topicId, username))) {
+		return "", false
+	}
+	return topicId, true
+}
+
+// MessageId returns a Message-ID (without angle brackets) for a dialogue
+// resource such as a post
+func MessageId(kind, id, domain string) string {
+	return fmt.Sprintf("%s.%s@%s", kind, id, domain)
+}
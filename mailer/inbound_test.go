@@ -0,0 +1,149 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+const testSecret = "reply-secret"
+
+func TestReplyAddress(t *testing.T) {
+	addr := ReplyAddress(testSecret, "example.com", "topic-1", "alice")
+	if !strings.HasPrefix(addr, "reply+topic-1.") || !strings.HasSuffix(addr, "@example.com") {
+		t.Fatalf("ReplyAddress = %q", addr)
+	}
+	tampered := strings.Replace(addr, "topic-1", "topic-2", 1)
+	tests := []struct {
+		name     string
+		secret   string
+		address  string
+		username string
+		topicId  string
+		ok       bool
+	}{
+		{"valid", testSecret, addr, "alice", "topic-1", true},
+		{"other user", testSecret, addr, "bob", "", false},
+		{"other secret", "other", addr, "alice", "", false},
+		{"other topic", testSecret, tampered, "alice", "", false},
+		{"tampered signature", testSecret, addr[:len(addr)-len("@example.com")-1] + "0@example.com", "alice", "", false},
+		{"no signature", testSecret, "reply+topic-1@example.com", "alice", "", false},
+		{"no prefix", testSecret, strings.TrimPrefix(addr, "reply+"), "alice", "", false},
+		{"empty", testSecret, "", "alice", "", false},
+	}
+	for _, test := range tests {
+		topicId, ok := ParseReplyAddress(test.secret, test.address, test.username)
+		if topicId != test.topicId || ok != test.ok {
+			t.Errorf("%s: ParseReplyAddress(%q) = %q, %v, want %q, %v", test.name, test.address, topicId, ok, test.topicId, test.ok)
+		}
+	}
+}
+
+func TestParseMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		text string
+		err  error
+	}{
+		{
+			"plain text",
+			"From: Alice <Alice@Example.com>\r\nTo: reply+t.s@example.com\r\nSubject: Re: hi\r\n" +
+				"In-Reply-To: <post.1@example.com>\r\nReferences: <topic.1@example.com> <post.1@example.com>\r\n\r\nhello\r\n",
+			"hello\r\n",
+			nil,
+		},
+		{
+			"base64",
+			"From: alice@example.com\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\naGVsbG8gd29ybGQ=\r\n",
+			"hello world",
+			nil,
+		},
+		{
+			"quoted printable",
+			"From: alice@example.com\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\ncaf=C3=A9 =\r\nau lait",
+			"café au lait",
+			nil,
+		},
+		{
+			"multipart alternative",
+			"From: alice@example.com\r\nContent-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<p>hello</p>\r\n" +
+				"--b1\r\nContent-Type: text/plain\r\n\r\nhello\r\n--b1--\r\n",
+			"hello",
+			nil,
+		},
+		{
+			"nested multipart",
+			"From: alice@example.com\r\nContent-Type: multipart/mixed; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: multipart/alternative; boundary=b2\r\n\r\n" +
+				"--b2\r\nContent-Type: text/plain\r\nContent-Transfer-Encoding: base64\r\n\r\naGVsbG8=\r\n--b2--\r\n" +
+				"--b1\r\nContent-Type: application/pdf\r\n\r\nx\r\n--b1--\r\n",
+			"hello",
+			nil,
+		},
+		{
+			"no text body",
+			"From: alice@example.com\r\nContent-Type: multipart/alternative; boundary=b1\r\n\r\n" +
+				"--b1\r\nContent-Type: text/html\r\n\r\n<p>hello</p>\r\n--b1--\r\n",
+			"",
+			ErrNoTextBody,
+		},
+		{
+			"html only",
+			"From: alice@example.com\r\nContent-Type: text/html\r\n\r\n<p>hello</p>",
+			"",
+			ErrNoTextBody,
+		},
+	}
+	for _, test := range tests {
+		msg, err := ParseMessage([]byte(test.raw))
+		if err != test.err {
+			t.Errorf("%s: ParseMessage returned %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if msg.Text != test.text {
+			t.Errorf("%s: text = %q, want %q", test.name, msg.Text, test.text)
+		}
+		if msg.From != "alice@example.com" {
+			t.Errorf("%s: from = %q", test.name, msg.From)
+		}
+	}
+
+	msg, err := ParseMessage([]byte(tests[0].raw))
+	if err != nil {
+		t.Fatalf("ParseMessage: %s", err)
+	}
+	if msg.Subject != "Re: hi" || len(msg.To) != 1 || msg.To[0] != "reply+t.s@example.com" {
+		t.Errorf("subject %q, to %v", msg.Subject, msg.To)
+	}
+
+	if _, err := ParseMessage([]byte("From: not an address\r\n\r\nhello")); err == nil {
+		t.Errorf("ParseMessage accepted an invalid From")
+	}
+}
+
+func TestStripReply(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"thanks!", "thanks!"},
+		{"thanks!\r\n\r\n> earlier\r\n> text", "thanks!"},
+		{"agreed\n\nOn Mon, 1 Jan 2026 at 10:00, Bob <bob@example.com> wrote:\n> earlier", "agreed"},
+		{"see below\n-- \nAlice", "see below"},
+		{"see below\n--\nAlice", "see below"},
+		{"ok\n-----Original Message-----\nFrom: bob", "ok"},
+		{"ok\n________________________________\nFrom: bob", "ok"},
+		{"first\n> quoted\nsecond", "first\nsecond"},
+		{"a -- b", "a -- b"},
+		{"> only quoted", ""},
+	}
+	for _, test := range tests {
+		if got := StripReply(test.text); got != test.want {
+			t.Errorf("StripReply(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	Mailer interface {
+		Send(*Message) error
+	}
+
+	Message struct {
+		From    string
+		To      []string
+		Subject string
+		Text    string
+		HTML    string
+		Headers map[string]string
+	}
+)
+
+// Bytes returns the message encoded as a multipart/alternative RFC 5322
+// message with plain text and HTML parts.  Header values often include
+// user input such as topic titles, so line breaks are removed from them
+// and non-ASCII text is encoded.
+func (msg *Message) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	from, err := addressHeader(msg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid From address %q: %s", msg.From, err)
+	}
+	to := []string{}
+	for _, a := range msg.To {
+		v, err := addressHeader(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid To address %q: %s", a, err)
+		}
+		to = append(to, v)
+	}
+	keys := []string{}
+	for k := range msg.Headers {
+		if !validHeaderKey(k) {
+			return nil, fmt.Errorf("invalid header %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", p.contentType)
+		h.Set("Content-Transfer-Encoding", "8bit")
+		pw, err := w.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := pw.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headerValue(msg.Headers[k]))
+	}
+	fmt.Fprint(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", w.Boundary())
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// headerValue returns v as a single line header value.  Control characters
+// such as CR and LF, which would end the header, are replaced with spaces
+// and non-ASCII text is encoded as RFC 2047 words.
+func headerValue(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, v)
+	return mime.QEncoding.Encode("utf-8", v)
+}
+
+// addressHeader returns the address in v formatted for a header.  The
+// display name is encoded if needed.
+func addressHeader(v string) (string, error) {
+	a, err := mail.ParseAddress(v)
+	if err != nil {
+		return "", err
+	}
+	if a.Name == "" {
+		return a.Address, nil
+	}
+	return a.String(), nil
+}
+
+func validHeaderKey(k string) bool {
+	if k == "" {
+		return false
+	}
+	for _, r := range k {
+		if r <= ' ' || r >= 0x7f || r == ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package mailer
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		From:    "Dialogue <dialogue@example.com>",
+		To:      []string{"alice@example.com"},
+		Subject: "[dialogue] New post in Hi\r\nBcc: eve@example.com",
+		Text:    "hello",
+		HTML:    "<p>hello</p>",
+		Headers: map[string]string{
+			"Reply-To":   "reply+t.s@example.com",
+			"References": "<topic.1@example.com>\nBcc: eve@example.com",
+		},
+	}
+	b, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %s", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unable to parse message: %s", err)
+	}
+	if bcc := parsed.Header.Get("Bcc"); bcc != "" {
+		t.Errorf("header injected through the subject or a header: Bcc: %s", bcc)
+	}
+	if got := parsed.Header.Get("Subject"); got != "[dialogue] New post in Hi  Bcc: eve@example.com" {
+		t.Errorf("Subject = %q", got)
+	}
+	if got := parsed.Header.Get("Reply-To"); got != "reply+t.s@example.com" {
+		t.Errorf("Reply-To = %q", got)
+	}
+	if got := parsed.Header.Get("Content-Type"); !strings.HasPrefix(got, "multipart/alternative; boundary=") {
+		t.Errorf("Content-Type = %q", got)
+	}
+}
+
+func TestMessageBytesEncoding(t *testing.T) {
+	msg := &Message{
+		From:    "Dïalogue <dialogue@example.com>",
+		To:      []string{"alice@example.com", "Bob <bob@example.com>"},
+		Subject: "[dialogue] Réunion",
+		Text:    "hello",
+	}
+	b, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %s", err)
+	}
+	head := string(b[:bytes.Index(b, []byte("\r\n\r\n"))])
+	for _, r := range head {
+		if r > 0x7f {
+			t.Fatalf("header contains non-ASCII text:\n%s", head)
+		}
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("unable to parse message: %s", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "[dialogue] Réunion" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "Dïalogue" {
+		t.Errorf("From = %v, %v", from, err)
+	}
+	to, err := parsed.Header.AddressList("To")
+	if err != nil || len(to) != 2 || to[1].Address != "bob@example.com" {
+		t.Errorf("To = %v, %v", to, err)
+	}
+}
+
+func TestMessageBytesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  *Message
+	}{
+		{"from", &Message{From: "dialogue@example.com\r\nBcc: eve@example.com", To: []string{"alice@example.com"}}},
+		{"to", &Message{From: "dialogue@example.com", To: []string{"alice@example.com\r\nBcc: eve@example.com"}}},
+		{"header key", &Message{From: "dialogue@example.com", Headers: map[string]string{"X-A\r\nBcc": "eve@example.com"}}},
+		{"header key colon", &Message{From: "dialogue@example.com", Headers: map[string]string{"Bcc: eve@example.com\r\nX-A": "1"}}},
+	}
+	for _, test := range tests {
+		if _, err := test.msg.Bytes(); err == nil {
+			t.Errorf("%s: Bytes accepted an invalid header", test.name)
+		}
+	}
+}
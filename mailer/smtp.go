@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"net"
+	"net/smtp"
+)
+
+type (
+	SMTPMailer struct {
+		address string
+		auth    smtp.Auth
+	}
+)
+
+// NewSMTPMailer returns a Mailer that delivers through the SMTP server at
+// address.  If username is empty, no authentication is attempted.
+func NewSMTPMailer(address, username, password string) (Mailer, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	m := &SMTPMailer{
+		address: address,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(msg *Message) error {
+	b, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.address, m.auth, msg.From, msg.To, b)
+}
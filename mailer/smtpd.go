@@ -0,0 +1,195 @@
+package mailer
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+type (
+	// InboundHandler processes a received message.  Returning a *Bounce
+	// rejects the message permanently; any other error is reported to the
+	// sender as a temporary failure.
+	InboundHandler func(from string, to []string, data []byte) error
+
+	// SMTPServer is a minimal SMTP listener for receiving replies
+	SMTPServer struct {
+		address  string
+		domain   string
+		handler  InboundHandler
+		maxSize  int64
+		mu       sync.Mutex
+		listener net.Listener
+		conns    map[net.Conn]bool
+		wg       sync.WaitGroup
+	}
+)
+
+const smtpTimeout = time.Minute * 5
+
+var log = logrus.New()
+
+func NewSMTPServer(address, domain string, maxSize int64, handler InboundHandler) *SMTPServer {
+	return &SMTPServer{
+		address: address,
+		domain:  domain,
+		handler: handler,
+		maxSize: maxSize,
+		conns:   map[net.Conn]bool{},
+	}
+}
+
+func (s *SMTPServer) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = l
+	s.mu.Unlock()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.wg.Done()
+			s.serve(conn)
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops accepting mail, closes open connections and waits for the
+// messages being handled to finish
+func (s *SMTPServer) Close() error {
+	s.mu.Lock()
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *SMTPServer) serve(c net.Conn) {
+	defer c.Close()
+	conn := textproto.NewConn(c)
+	var (
+		from    string
+		to      []string
+		started bool
+	)
+	reset := func() {
+		from = ""
+		to = nil
+		started = false
+	}
+	conn.PrintfLine("220 %s ESMTP dialogue", s.domain)
+	for {
+		c.SetDeadline(time.Now().Add(smtpTimeout))
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg := line, ""
+		if i := strings.Index(line, " "); i > 0 {
+			cmd, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+		switch strings.ToUpper(cmd) {
+		case "HELO":
+			conn.PrintfLine("250 %s", s.domain)
+		case "EHLO":
+			conn.PrintfLine("250-%s", s.domain)
+			conn.PrintfLine("250 SIZE %d", s.maxSize)
+		case "MAIL":
+			reset()
+			from = smtpPath(arg, "FROM:")
+			started = true
+			conn.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			if !started {
+				conn.PrintfLine("503 5.5.1 MAIL required first")
+				continue
+			}
+			rcpt := smtpPath(arg, "TO:")
+			// only replies to our own addresses are accepted
+			if !strings.HasSuffix(strings.ToLower(rcpt), "@"+strings.ToLower(s.domain)) {
+				conn.PrintfLine("550 5.7.1 Relaying denied")
+				continue
+			}
+			to = append(to, rcpt)
+			conn.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			if len(to) == 0 {
+				conn.PrintfLine("503 5.5.1 RCPT required first")
+				continue
+			}
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			dr := conn.DotReader()
+			data, err := ioutil.ReadAll(io.LimitReader(dr, s.maxSize+1))
+			if err != nil {
+				return
+			}
+			if int64(len(data)) > s.maxSize {
+				// discard the remainder of the message
+				if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+					return
+				}
+				conn.PrintfLine("552 5.3.4 Message too large")
+				reset()
+				continue
+			}
+			if err := s.handler(from, to, data); err != nil {
+				if b, ok := err.(*Bounce); ok {
+					conn.PrintfLine("550 5.7.1 %s", b.Reason)
+				} else {
+					log.Errorf("Error handling inbound message: %s", err)
+					conn.PrintfLine("451 4.3.0 Temporary failure")
+				}
+			} else {
+				conn.PrintfLine("250 2.0.0 OK")
+			}
+			reset()
+		case "RSET":
+			reset()
+			conn.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			conn.PrintfLine("250 2.0.0 OK")
+		case "QUIT":
+			conn.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			conn.PrintfLine("502 5.5.2 Command not implemented")
+		}
+	}
+}
+
+// smtpPath extracts the address from a MAIL FROM or RCPT TO argument
+func smtpPath(arg, prefix string) string {
+	if len(arg) >= len(prefix) && strings.EqualFold(arg[:len(prefix)], prefix) {
+		arg = arg[len(prefix):]
+	}
+	// drop parameters such as SIZE=
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(strings.Trim(fields[0], "<>"))
+}
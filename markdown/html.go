@@ -0,0 +1,129 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+)
+
+// HTML renders Markdown as HTML.  Raw HTML in the source is escaped and
+// only web, mailto and relative links are kept, so the result is safe to
+// embed in a page.
+func HTML(src string, opts Options) string {
+	var buf bytes.Buffer
+	for _, n := range parse(src, opts) {
+		renderHTML(&buf, n, false)
+	}
+	return buf.String()
+}
+
+func renderHTML(buf *bytes.Buffer, n *node, tight bool) {
+	switch n.kind {
+	case paragraphNode:
+		if !tight {
+			buf.WriteString("<p>")
+		}
+		renderHTMLChildren(buf, n)
+		if !tight {
+			buf.WriteString("</p>\n")
+		}
+	case headingNode:
+		fmt.Fprintf(buf, "<h%d>", n.level)
+		renderHTMLChildren(buf, n)
+		fmt.Fprintf(buf, "</h%d>\n", n.level)
+	case codeBlockNode:
+		buf.WriteString("<pre><code")
+		if n.text != "" {
+			fmt.Fprintf(buf, ` class="language-%s"`, html.EscapeString(n.text))
+		}
+		buf.WriteString(">")
+		buf.WriteString(html.EscapeString(n.children[0].text))
+		buf.WriteString("\n</code></pre>\n")
+	case quoteNode:
+		buf.WriteString("<blockquote>\n")
+		renderHTMLChildren(buf, n)
+		buf.WriteString("</blockquote>\n")
+	case listNode:
+		tag := "ul"
+		if n.ordered {
+			tag = "ol"
+		}
+		buf.WriteString("<" + tag)
+		if n.ordered && n.start != 1 {
+			fmt.Fprintf(buf, ` start="%d"`, n.start)
+		}
+		buf.WriteString(">\n")
+		for _, item := range n.children {
+			buf.WriteString("<li>")
+			// paragraphs are only wrapped in <p> if the item has several
+			paragraphs := 0
+			for _, c := range item.children {
+				if c.kind == paragraphNode {
+					paragraphs++
+				}
+			}
+			for _, c := range item.children {
+				renderHTML(buf, c, paragraphs < 2)
+			}
+			buf.WriteString("</li>\n")
+		}
+		buf.WriteString("</" + tag + ">\n")
+	case tableNode:
+		buf.WriteString("<table>\n")
+		for i, row := range n.children {
+			tag := "td"
+			if i == 0 {
+				tag = "th"
+				buf.WriteString("<thead>\n")
+			} else if i == 1 {
+				buf.WriteString("<tbody>\n")
+			}
+			buf.WriteString("<tr>")
+			for c, cell := range row.children {
+				buf.WriteString("<" + tag)
+				if n.align[c] != "" {
+					fmt.Fprintf(buf, ` align="%s"`, n.align[c])
+				}
+				buf.WriteString(">")
+				renderHTMLChildren(buf, cell)
+				buf.WriteString("</" + tag + ">")
+			}
+			buf.WriteString("</tr>\n")
+			if i == 0 {
+				buf.WriteString("</thead>\n")
+			}
+		}
+		if len(n.children) > 1 {
+			buf.WriteString("</tbody>\n")
+		}
+		buf.WriteString("</table>\n")
+	case ruleNode:
+		buf.WriteString("<hr />\n")
+	case textNode:
+		buf.WriteString(html.EscapeString(n.text))
+	case emphNode:
+		buf.WriteString("<em>")
+		renderHTMLChildren(buf, n)
+		buf.WriteString("</em>")
+	case strongNode:
+		buf.WriteString("<strong>")
+		renderHTMLChildren(buf, n)
+		buf.WriteString("</strong>")
+	case codeNode:
+		buf.WriteString("<code>" + html.EscapeString(n.text) + "</code>")
+	case linkNode, refNode:
+		fmt.Fprintf(buf, `<a href="%s" rel="nofollow">`, html.EscapeString(n.href))
+		renderHTMLChildren(buf, n)
+		buf.WriteString("</a>")
+	case mentionNode:
+		fmt.Fprintf(buf, `<span class="mention">@%s</span>`, html.EscapeString(n.text))
+	case breakNode:
+		buf.WriteString("<br />\n")
+	}
+}
+
+func renderHTMLChildren(buf *bytes.Buffer, n *node) {
+	for _, c := range n.children {
+		renderHTML(buf, c, false)
+	}
+}
@@ -0,0 +1,203 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		// links
+		{"link", "[docs](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow">docs</a></p>` + "\n"},
+		{"relative link", "[topic](/topics/1)", `<p><a href="/topics/1" rel="nofollow">topic</a></p>` + "\n"},
+		{"mailto link", "[mail](mailto:admin@example.com)", `<p><a href="mailto:admin@example.com" rel="nofollow">mail</a></p>` + "\n"},
+		{"javascript link", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+		{"javascript link upper case", "[x](JavaScript:alert(1))", "<p>[x](JavaScript:alert(1))</p>\n"},
+		{"data link", "[x](data:text/html;base64,PHNjcmlwdD4=)", "<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>\n"},
+		{"vbscript link", "[x](vbscript:msgbox)", "<p>[x](vbscript:msgbox)</p>\n"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>\n"},
+		{"autolink", "see https://example.com/x.", `<p>see <a href="https://example.com/x" rel="nofollow">https://example.com/x</a>.</p>` + "\n"},
+		{"quote in href", `[x](https://example.com/"onmouseover="alert(1))`, `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1)" rel="nofollow">x</a></p>` + "\n"},
+		{"no links in link text", "[https://a.example](https://b.example)", `<p><a href="https://b.example" rel="nofollow">https://a.example</a></p>` + "\n"},
+		// raw html
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"html attributes", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"html block", "<div>\n*hi*\n</div>", "<p>&lt;div&gt;\n<em>hi</em>\n&lt;/div&gt;</p>\n"},
+		{"entities", "AT&T &amp; co", "<p>AT&amp;T &amp;amp; co</p>\n"},
+		{"code block language", "```go\"><script>\nx\n```", `<pre><code class="language-go">x` + "\n</code></pre>\n"},
+		// emphasis
+		{"emphasis", "*a* _b_ **c** __d__ ***e***", "<p><em>a</em> <em>b</em> <strong>c</strong> <strong>d</strong> <strong><em>e</em></strong></p>\n"},
+		{"nested emphasis", "**bold *and italic* text**", "<p><strong>bold <em>and italic</em> text</strong></p>\n"},
+		{"emphasis in link", "[*a*](/b)", `<p><a href="/b" rel="nofollow"><em>a</em></a></p>` + "\n"},
+		{"intraword underscore", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"unclosed emphasis", "*a **b", "<p>*a **b</p>\n"},
+		{"space after delimiter", "a * b * c", "<p>a * b * c</p>\n"},
+		{"escaped delimiter", `\*a\*`, "<p>*a*</p>\n"},
+		// code spans
+		{"code span", "use `<b>` here", "<p>use <code>&lt;b&gt;</code> here</p>\n"},
+		{"code span no emphasis", "`*a*`", "<p><code>*a*</code></p>\n"},
+		{"double backtick code", "``a ` b``", "<p><code>a ` b</code></p>\n"},
+		{"code span padding", "`` `x` ``", "<p><code>`x`</code></p>\n"},
+		{"unclosed code span", "`a", "<p>`a</p>\n"},
+		{"code block", "    x < y\n", "<pre><code>x &lt; y\n</code></pre>\n"},
+		// lists
+		{"bullet list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"ordered list start", "3. a\n4. b", "<ol start=\"3\">\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"nested list", "- a\n  - b\n- c", "<ul>\n<li>a<ul>\n<li>b</li>\n</ul>\n</li>\n<li>c</li>\n</ul>\n"},
+		{"loose list item", "- a\n\n  b\n- c", "<ul>\n<li><p>a</p>\n<p>b</p>\n</li>\n<li>c</li>\n</ul>\n"},
+		{"list with markup", "- *a*\n- `b`", "<ul>\n<li><em>a</em></li>\n<li><code>b</code></li>\n</ul>\n"},
+		// other blocks
+		{"heading", "## Title ##", "<h2>Title</h2>\n"},
+		{"quote", "> *a*", "<blockquote>\n<p><em>a</em></p>\n</blockquote>\n"},
+		{"rule", "***", "<hr />\n"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 |", "<table>\n<thead>\n<tr><th align=\"left\">a</th><th align=\"right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td align=\"left\">1</td><td align=\"right\">2</td></tr>\n</tbody>\n</table>\n"},
+		{"hard break", "a  \nb", "<p>a<br />\nb</p>\n"},
+		{"mention", "hi @alice", `<p>hi <span class="mention">@alice</span></p>` + "\n"},
+		{"email is not a mention", "alice@example.com", "<p>alice@example.com</p>\n"},
+	}
+	for _, test := range tests {
+		if got := HTML(test.src, Options{}); got != test.want {
+			t.Errorf("%s: HTML(%q)\n got: %q\nwant: %q", test.name, test.src, got, test.want)
+		}
+	}
+}
+
+func TestHTMLOptions(t *testing.T) {
+	const (
+		topicId = "6f1c2d7e-5b3a-4e8f-a6d9-0c7b2e4f9a13"
+		otherId = "7a2c2d7e-5b3a-4e8f-a6d9-0c7b2e4f9a13"
+	)
+	var looked []string
+	opts := Options{
+		Ref: func(id string) string {
+			looked = append(looked, id)
+			if id == topicId {
+				return "/topics/" + id
+			}
+			return ""
+		},
+		Mention: func(username string) bool {
+			return username == "alice"
+		},
+	}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"see " + topicId, `<p>see <a href="/topics/` + topicId + `" rel="nofollow">` + topicId + "</a></p>\n"},
+		{"see " + otherId, "<p>see " + otherId + "</p>\n"},
+		{"x" + topicId, "<p>x" + topicId + "</p>\n"},
+		{"`" + topicId + "`", "<p><code>" + topicId + "</code></p>\n"},
+		{"@alice @bob", `<p><span class="mention">@alice</span> @bob</p>` + "\n"},
+	}
+	for _, test := range tests {
+		if got := HTML(test.src, opts); got != test.want {
+			t.Errorf("HTML(%q)\n got: %q\nwant: %q", test.src, got, test.want)
+		}
+	}
+	for _, id := range looked {
+		if id != topicId && id != otherId {
+			t.Errorf("Ref called with %q", id)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"**bold** and *italic*", "bold and italic"},
+		{"[docs](https://example.com)", "docs (https://example.com)"},
+		{"https://example.com", "https://example.com"},
+		{"[x](javascript:alert(1))", "[x](javascript:alert(1))"},
+		{"<b>raw</b>", "<b>raw</b>"},
+		{"# Title\n\ntext", "Title\n\ntext"},
+		{"`code`", "code"},
+	}
+	for _, test := range tests {
+		if got := Text(test.src, Options{}); got != test.want {
+			t.Errorf("Text(%q) = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	got := Terminal("**a** `b`", Options{})
+	want := ansiBold + "a" + ansiBoldOff + " " + ansiCode + "b" + ansiColorOff
+	if got != want {
+		t.Errorf("Terminal = %q, want %q", got, want)
+	}
+}
+
+func TestSafeUrl(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.com", true},
+		{"HTTP://example.com", true},
+		{"mailto:a@example.com", true},
+		{"/topics/1", true},
+		{"topics/1#post", true},
+		{"javascript:alert(1)", false},
+		{"JAVASCRIPT:alert(1)", false},
+		{"data:text/html,x", false},
+		{"file:///etc/passwd", false},
+		{"//evil.example/x", true},
+		{"a:b/c", false},
+	}
+	for _, test := range tests {
+		if got := safeUrl(test.url); got != test.ok {
+			t.Errorf("safeUrl(%q) = %v, want %v", test.url, got, test.ok)
+		}
+	}
+}
+
+var (
+	fuzzTagRe  = regexp.MustCompile(`<[^>]*>`)
+	fuzzSafeRe = regexp.MustCompile(`^</?(p|h[1-6]|pre|code|blockquote|ul|ol|li|table|thead|tbody|tr|th|td|em|strong|a|span)( (class|align|start|href|rel)="[^"<>]*")*>$|^<(hr|br) />$`)
+)
+
+func FuzzHTML(f *testing.F) {
+	for _, src := range []string{
+		"*a* **b** `c`",
+		"[x](javascript:alert(1))",
+		"<script>alert(1)</script>",
+		"- a\n  - b\n\n1. c",
+		"| a |\n|---|\n| b |",
+		"```go\nx\n```",
+		"> quote\n> **b**",
+		"@alice 6f1c2d7e-5b3a-4e8f-a6d9-0c7b2e4f9a13",
+	} {
+		f.Add(src)
+	}
+	opts := Options{
+		Ref: func(id string) string {
+			return "/topics/" + id
+		},
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		out := HTML(src, opts)
+		for _, tag := range fuzzTagRe.FindAllString(out, -1) {
+			if !fuzzSafeRe.MatchString(tag) {
+				t.Fatalf("HTML(%q) produced unexpected markup %q", src, tag)
+			}
+			if strings.Contains(tag, "href=") {
+				href := tag[strings.Index(tag, `href="`)+6:]
+				href = href[:strings.Index(href, `"`)]
+				if !safeUrl(html.UnescapeString(href)) {
+					t.Fatalf("HTML(%q) produced an unsafe link %q", src, tag)
+				}
+			}
+		}
+		Text(src, opts)
+		Terminal(src, opts)
+	})
+}
@@ -0,0 +1,569 @@
+package markdown
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type (
+	// Options control how references in content are rendered
+	Options struct {
+		// Ref returns the url for a topic or post id, or "" if the id is
+		// unknown.  Ids are not linked if Ref is nil.
+		Ref func(id string) string
+		// Mention reports whether a mentioned user exists.  All mentions
+		// are expanded if Mention is nil.
+		Mention func(username string) bool
+	}
+
+	nodeKind int
+
+	node struct {
+		kind     nodeKind
+		text     string
+		href     string
+		level    int
+		ordered  bool
+		start    int
+		align    []string
+		children []*node
+	}
+
+	parser struct {
+		opts Options
+	}
+)
+
+const (
+	paragraphNode nodeKind = iota
+	headingNode
+	codeBlockNode
+	quoteNode
+	listNode
+	itemNode
+	tableNode
+	rowNode
+	cellNode
+	ruleNode
+	textNode
+	emphNode
+	strongNode
+	codeNode
+	linkNode
+	refNode
+	mentionNode
+	breakNode
+)
+
+var (
+	fenceRe      = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})[ \t]*([^`]*)$")
+	headingRe    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	ruleRe       = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quoteRe      = regexp.MustCompile(`^ {0,3}> ?`)
+	listItemRe   = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])([ \t]+|$)`)
+	tableDelimRe = regexp.MustCompile(`^ *\|? *:?-+:? *(\| *:?-+:? *)*\|? *$`)
+	urlRe        = regexp.MustCompile(`^https?://[^\s<>]*[^\s<>.,:;"')\]!?*_]`)
+	mentionRe    = regexp.MustCompile(`^@([A-Za-z0-9_.-]*[A-Za-z0-9_])`)
+	idRe         = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	langRe       = regexp.MustCompile(`^[\w.+#-]+`)
+)
+
+func parse(src string, opts Options) []*node {
+	src = strings.Replace(src, "\r\n", "\n", -1)
+	src = strings.Replace(src, "\r", "\n", -1)
+	lines := strings.Split(src, "\n")
+	for i, l := range lines {
+		lines[i] = expandTabs(l)
+	}
+	p := &parser{opts: opts}
+	return p.blocks(lines)
+}
+
+// expandTabs replaces leading tabs with four spaces
+func expandTabs(l string) string {
+	i := 0
+	for i < len(l) && (l[i] == ' ' || l[i] == '\t') {
+		i++
+	}
+	return strings.Replace(l[:i], "\t", "    ", -1) + l[i:]
+}
+
+func isBlank(l string) bool {
+	return strings.TrimSpace(l) == ""
+}
+
+func indentOf(l string) int {
+	return len(l) - len(strings.TrimLeft(l, " "))
+}
+
+func stripIndent(l string, n int) string {
+	if i := indentOf(l); i < n {
+		n = i
+	}
+	return l[n:]
+}
+
+// startsBlock reports whether l interrupts a paragraph
+func startsBlock(l string) bool {
+	return fenceRe.MatchString(l) || headingRe.MatchString(l) || ruleRe.MatchString(l) ||
+		quoteRe.MatchString(l) || listItemRe.MatchString(l)
+}
+
+func isTable(lines []string, i int) bool {
+	return i+1 < len(lines) && strings.Contains(lines[i], "|") &&
+		strings.Contains(lines[i+1], "-") && tableDelimRe.MatchString(lines[i+1])
+}
+
+func (p *parser) blocks(lines []string) []*node {
+	var nodes []*node
+	i := 0
+	for i < len(lines) {
+		l := lines[i]
+		switch {
+		case isBlank(l):
+			i++
+		case fenceRe.MatchString(l):
+			m := fenceRe.FindStringSubmatch(l)
+			fence := m[1]
+			n := &node{kind: codeBlockNode, text: langRe.FindString(strings.TrimSpace(m[2]))}
+			var code []string
+			indent := indentOf(l)
+			for i++; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+					i++
+					break
+				}
+				code = append(code, stripIndent(lines[i], indent))
+			}
+			n.children = []*node{{kind: textNode, text: strings.Join(code, "\n")}}
+			nodes = append(nodes, n)
+		case headingRe.MatchString(l):
+			m := headingRe.FindStringSubmatch(l)
+			nodes = append(nodes, &node{kind: headingNode, level: len(m[1]), children: p.inline(m[2], false)})
+			i++
+		case ruleRe.MatchString(l):
+			nodes = append(nodes, &node{kind: ruleNode})
+			i++
+		case quoteRe.MatchString(l):
+			var quoted []string
+			for ; i < len(lines); i++ {
+				if loc := quoteRe.FindStringIndex(lines[i]); loc != nil {
+					quoted = append(quoted, lines[i][loc[1]:])
+					continue
+				}
+				// lazy continuation of a quoted paragraph
+				if isBlank(lines[i]) || startsBlock(lines[i]) || len(quoted) == 0 || isBlank(quoted[len(quoted)-1]) {
+					break
+				}
+				quoted = append(quoted, lines[i])
+			}
+			nodes = append(nodes, &node{kind: quoteNode, children: p.blocks(quoted)})
+		case listItemRe.MatchString(l):
+			var n *node
+			n, i = p.list(lines, i)
+			nodes = append(nodes, n)
+		case indentOf(l) >= 4:
+			var code []string
+			for ; i < len(lines); i++ {
+				if !isBlank(lines[i]) && indentOf(lines[i]) < 4 {
+					break
+				}
+				code = append(code, stripIndent(lines[i], 4))
+			}
+			// trailing blank lines are not part of the block
+			for len(code) > 0 && isBlank(code[len(code)-1]) {
+				code = code[:len(code)-1]
+			}
+			nodes = append(nodes, &node{kind: codeBlockNode, children: []*node{{kind: textNode, text: strings.Join(code, "\n")}}})
+		case isTable(lines, i):
+			var n *node
+			n, i = p.table(lines, i)
+			nodes = append(nodes, n)
+		default:
+			// trailing spaces are kept until the end for hard line breaks
+			para := []string{strings.TrimLeft(l, " ")}
+			for i++; i < len(lines); i++ {
+				if isBlank(lines[i]) || startsBlock(lines[i]) {
+					break
+				}
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			text := strings.TrimRight(strings.Join(para, "\n"), " ")
+			nodes = append(nodes, &node{kind: paragraphNode, children: p.inline(text, false)})
+		}
+	}
+	return nodes
+}
+
+func (p *parser) list(lines []string, i int) (*node, int) {
+	first := listItemRe.FindStringSubmatch(lines[i])
+	n := &node{kind: listNode}
+	if c := first[2][len(first[2])-1]; c == '.' || c == ')' {
+		n.ordered = true
+		n.start, _ = strconv.Atoi(first[2][:len(first[2])-1])
+	}
+	for i < len(lines) {
+		m := listItemRe.FindStringSubmatch(lines[i])
+		if m == nil || (m[2][len(m[2])-1] != first[2][len(first[2])-1]) {
+			break
+		}
+		offset := len(m[0])
+		if m[3] == "" || len(m[3]) > 4 {
+			offset = len(m[1]) + len(m[2]) + 1
+		}
+		item := []string{""}
+		if offset < len(lines[i]) {
+			item[0] = lines[i][offset:]
+		}
+		for i++; i < len(lines); i++ {
+			l := lines[i]
+			if isBlank(l) {
+				// blank lines continue the item if it is indented after them
+				j := i
+				for j < len(lines) && isBlank(lines[j]) {
+					j++
+				}
+				if j < len(lines) && indentOf(lines[j]) >= offset {
+					for ; i < j; i++ {
+						item = append(item, "")
+					}
+					i--
+					continue
+				}
+				break
+			}
+			if indentOf(l) >= offset {
+				item = append(item, stripIndent(l, offset))
+				continue
+			}
+			if startsBlock(l) {
+				break
+			}
+			item = append(item, l)
+		}
+		n.children = append(n.children, &node{kind: itemNode, children: p.blocks(item)})
+		// skip blank lines between items
+		j := i
+		for j < len(lines) && isBlank(lines[j]) {
+			j++
+		}
+		if j < len(lines) && listItemRe.MatchString(lines[j]) {
+			i = j
+		}
+	}
+	return n, i
+}
+
+func splitRow(l string) []string {
+	l = strings.TrimSpace(l)
+	l = strings.TrimPrefix(l, "|")
+	if strings.HasSuffix(l, "|") && !strings.HasSuffix(l, `\|`) {
+		l = l[:len(l)-1]
+	}
+	var cells []string
+	var cur []byte
+	for i := 0; i < len(l); i++ {
+		switch {
+		case l[i] == '\\' && i+1 < len(l) && l[i+1] == '|':
+			cur = append(cur, '|')
+			i++
+		case l[i] == '|':
+			cells = append(cells, strings.TrimSpace(string(cur)))
+			cur = cur[:0]
+		default:
+			cur = append(cur, l[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(string(cur)))
+}
+
+func (p *parser) table(lines []string, i int) (*node, int) {
+	n := &node{kind: tableNode}
+	for _, d := range splitRow(lines[i+1]) {
+		align := ""
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			align = "center"
+		case strings.HasPrefix(d, ":"):
+			align = "left"
+		case strings.HasSuffix(d, ":"):
+			align = "right"
+		}
+		n.align = append(n.align, align)
+	}
+	row := func(l string) *node {
+		r := &node{kind: rowNode}
+		cells := splitRow(l)
+		for c := range n.align {
+			text := ""
+			if c < len(cells) {
+				text = cells[c]
+			}
+			r.children = append(r.children, &node{kind: cellNode, children: p.inline(text, false)})
+		}
+		return r
+	}
+	n.children = append(n.children, row(lines[i]))
+	for i += 2; i < len(lines); i++ {
+		if isBlank(lines[i]) || !strings.Contains(lines[i], "|") {
+			break
+		}
+		n.children = append(n.children, row(lines[i]))
+	}
+	return n, i
+}
+
+// safeUrl reports whether u can be used as a link.  Only web, mailto and
+// relative urls are allowed.
+func safeUrl(u string) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		return !strings.Contains(strings.SplitN(u, "/", 2)[0], ":")
+	}
+	return false
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// inline parses the inline content of a block.  Links are not parsed
+// inside link text.
+func (p *parser) inline(s string, inLink bool) []*node {
+	var nodes []*node
+	var text []byte
+	flush := func() {
+		if len(text) > 0 {
+			nodes = append(nodes, &node{kind: textNode, text: string(text)})
+			text = nil
+		}
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		prev := byte(' ')
+		if i > 0 {
+			prev = s[i-1]
+		}
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			flush()
+			nodes = append(nodes, &node{kind: breakNode})
+			i++
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", s[i+1]) >= 0:
+			text = append(text, s[i+1])
+			i++
+		case c == '\n':
+			if len(text) >= 2 && text[len(text)-1] == ' ' && text[len(text)-2] == ' ' {
+				text = []byte(strings.TrimRight(string(text), " "))
+				flush()
+				nodes = append(nodes, &node{kind: breakNode})
+				continue
+			}
+			text = []byte(strings.TrimRight(string(text), " "))
+			text = append(text, '\n')
+		case c == '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			fence := s[i : i+n]
+			end := -1
+			for j := i + n; j < len(s); {
+				k := strings.Index(s[j:], fence)
+				if k < 0 {
+					break
+				}
+				k += j
+				// the closing run must be exactly as long as the opening
+				if k+n < len(s) && s[k+n] == '`' {
+					for j = k; j < len(s) && s[j] == '`'; j++ {
+					}
+					continue
+				}
+				end = k
+				break
+			}
+			if end < 0 {
+				text = append(text, fence...)
+				i += n - 1
+				continue
+			}
+			code := strings.Replace(s[i+n:end], "\n", " ", -1)
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			flush()
+			nodes = append(nodes, &node{kind: codeNode, text: code})
+			i = end + n - 1
+		case c == '*' || c == '_':
+			n := 1
+			for i+n < len(s) && s[i+n] == c {
+				n++
+			}
+			if n > 3 || i+n >= len(s) || isSpace(s[i+n]) || (c == '_' && isWordChar(prev)) {
+				text = append(text, s[i:i+n]...)
+				i += n - 1
+				continue
+			}
+			end := p.closingDelim(s, i+n, s[i:i+n])
+			if end < 0 {
+				text = append(text, s[i:i+n]...)
+				i += n - 1
+				continue
+			}
+			flush()
+			inner := p.inline(s[i+n:end], inLink)
+			switch n {
+			case 1:
+				nodes = append(nodes, &node{kind: emphNode, children: inner})
+			case 2:
+				nodes = append(nodes, &node{kind: strongNode, children: inner})
+			default:
+				nodes = append(nodes, &node{kind: strongNode, children: []*node{{kind: emphNode, children: inner}}})
+			}
+			i = end + n - 1
+		case c == '[' && !inLink:
+			label, href, end := linkAt(s, i)
+			if end < 0 || !safeUrl(href) {
+				text = append(text, c)
+				continue
+			}
+			flush()
+			nodes = append(nodes, &node{kind: linkNode, href: href, children: p.inline(label, true)})
+			i = end
+		case c == '<' && !inLink:
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 || !urlRe.MatchString(s[i+1:i+end]) || strings.ContainsAny(s[i+1:i+end], " \n") {
+				text = append(text, c)
+				continue
+			}
+			flush()
+			href := s[i+1 : i+end]
+			nodes = append(nodes, &node{kind: linkNode, href: href, children: []*node{{kind: textNode, text: href}}})
+			i += end
+		case (c == 'h' || c == 'H') && !inLink && !isWordChar(prev) && urlRe.MatchString(s[i:]):
+			href := urlRe.FindString(s[i:])
+			flush()
+			nodes = append(nodes, &node{kind: linkNode, href: href, children: []*node{{kind: textNode, text: href}}})
+			i += len(href) - 1
+		case c == '@' && !isWordChar(prev) && prev != '@' && mentionRe.MatchString(s[i:]):
+			m := mentionRe.FindStringSubmatch(s[i:])
+			if p.opts.Mention != nil && !p.opts.Mention(m[1]) {
+				text = append(text, m[0]...)
+				i += len(m[0]) - 1
+				continue
+			}
+			flush()
+			nodes = append(nodes, &node{kind: mentionNode, text: m[1]})
+			i += len(m[0]) - 1
+		case p.opts.Ref != nil && !inLink && !isWordChar(prev) && prev != '-' && idRe.MatchString(s[i:]):
+			id := idRe.FindString(s[i:])
+			if after := i + len(id); after < len(s) && (isWordChar(s[after]) || s[after] == '-') {
+				text = append(text, c)
+				continue
+			}
+			href := p.opts.Ref(id)
+			if href == "" {
+				text = append(text, id...)
+				i += len(id) - 1
+				continue
+			}
+			flush()
+			nodes = append(nodes, &node{kind: refNode, href: href, text: id, children: []*node{{kind: textNode, text: id}}})
+			i += len(id) - 1
+		default:
+			text = append(text, c)
+		}
+	}
+	flush()
+	return nodes
+}
+
+// closingDelim returns the index of the emphasis delimiter closing the one
+// ending at start, or -1
+func (p *parser) closingDelim(s string, start int, delim string) int {
+	for j := start; j < len(s); {
+		k := strings.Index(s[j:], delim)
+		if k < 0 {
+			return -1
+		}
+		k += j
+		after := k + len(delim)
+		switch {
+		case k == start || isSpace(s[k-1]):
+		case s[k-1] == delim[0] || (after < len(s) && s[after] == delim[0]):
+			// part of a longer run
+			for after < len(s) && s[after] == delim[0] {
+				after++
+			}
+		case delim[0] == '_' && after < len(s) && isWordChar(s[after]):
+		default:
+			return k
+		}
+		j = after
+	}
+	return -1
+}
+
+// linkAt parses a [label](href) link starting at s[i].  It returns the
+// index of the closing parenthesis, or -1 if there is no link.
+func linkAt(s string, i int) (string, string, int) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+			continue
+		}
+		if s[j] == '[' {
+			depth++
+		} else if s[j] == ']' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	if j >= len(s)-1 || s[j+1] != '(' {
+		return "", "", -1
+	}
+	label := s[i+1 : j]
+	depth = 0
+	k := j + 1
+	for ; k < len(s); k++ {
+		if s[k] == '(' {
+			depth++
+		} else if s[k] == ')' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		} else if isSpace(s[k]) {
+			return "", "", -1
+		}
+	}
+	if k >= len(s) {
+		return "", "", -1
+	}
+	href := s[j+2 : k]
+	if strings.HasPrefix(href, "<") && strings.HasSuffix(href, ">") {
+		href = href[1 : len(href)-1]
+	}
+	if href == "" {
+		return "", "", -1
+	}
+	return label, href, k
+}
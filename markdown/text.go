@@ -0,0 +1,189 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ansiBold      = "\x1b[1m"
+	ansiBoldOff   = "\x1b[22m"
+	ansiItalic    = "\x1b[3m"
+	ansiItalicOff = "\x1b[23m"
+	ansiUnder     = "\x1b[4m"
+	ansiUnderOff  = "\x1b[24m"
+	ansiCode      = "\x1b[36m"
+	ansiDim       = "\x1b[2m"
+	ansiDimOff    = "\x1b[22m"
+	ansiColorOff  = "\x1b[39m"
+)
+
+type textRenderer struct {
+	ansi bool
+}
+
+// Text renders Markdown as plain text, removing formatting
+func Text(src string, opts Options) string {
+	r := &textRenderer{}
+	return r.render(src, opts)
+}
+
+// Terminal renders Markdown for display in a terminal using ANSI escape
+// codes for emphasis, code and links
+func Terminal(src string, opts Options) string {
+	r := &textRenderer{ansi: true}
+	return r.render(src, opts)
+}
+
+func (r *textRenderer) render(src string, opts Options) string {
+	return strings.TrimRight(r.blocks(parse(src, opts)), "\n")
+}
+
+func (r *textRenderer) style(on, s, off string) string {
+	if !r.ansi {
+		return s
+	}
+	return on + s + off
+}
+
+// blocks renders blocks separated by blank lines
+func (r *textRenderer) blocks(nodes []*node) string {
+	var parts []string
+	for _, n := range nodes {
+		parts = append(parts, r.block(n))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (r *textRenderer) block(n *node) string {
+	switch n.kind {
+	case paragraphNode:
+		return r.inlines(n.children)
+	case headingNode:
+		text := r.inlines(n.children)
+		if r.ansi {
+			if n.level == 1 {
+				return ansiBold + ansiUnder + text + ansiUnderOff + ansiBoldOff
+			}
+			return ansiBold + text + ansiBoldOff
+		}
+		return text
+	case codeBlockNode:
+		return indent(r.style(ansiCode, n.children[0].text, ansiColorOff), "    ", "    ")
+	case quoteNode:
+		prefix := r.style(ansiDim, "> ", ansiDimOff)
+		return indent(r.blocks(n.children), prefix, prefix)
+	case listNode:
+		var items []string
+		for i, item := range n.children {
+			marker := "- "
+			if n.ordered {
+				marker = fmt.Sprintf("%d. ", n.start+i)
+			}
+			var parts []string
+			for _, c := range item.children {
+				parts = append(parts, r.block(c))
+			}
+			items = append(items, indent(strings.Join(parts, "\n"), marker, strings.Repeat(" ", len(marker))))
+		}
+		return strings.Join(items, "\n")
+	case tableNode:
+		return r.table(n)
+	case ruleNode:
+		return r.style(ansiDim, strings.Repeat("-", 40), ansiDimOff)
+	}
+	return ""
+}
+
+func (r *textRenderer) table(n *node) string {
+	// widths are measured on the plain text so escape codes don't affect
+	// the alignment
+	plain := &textRenderer{}
+	widths := make([]int, len(n.align))
+	cells := make([][]string, len(n.children))
+	for i, row := range n.children {
+		for c, cell := range row.children {
+			text := plain.inlines(cell.children)
+			cells[i] = append(cells[i], text)
+			if w := utf8.RuneCountInString(text); w > widths[c] {
+				widths[c] = w
+			}
+		}
+	}
+	var lines []string
+	for i, row := range cells {
+		var cols []string
+		for c, text := range row {
+			pad := strings.Repeat(" ", widths[c]-utf8.RuneCountInString(text))
+			switch n.align[c] {
+			case "right":
+				text = pad + text
+			case "center":
+				text = pad[:len(pad)/2] + text + pad[len(pad)/2:]
+			default:
+				text = text + pad
+			}
+			if i == 0 {
+				text = r.style(ansiBold, text, ansiBoldOff)
+			}
+			cols = append(cols, text)
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cols, " | "), " "))
+		if i == 0 {
+			var rule []string
+			for _, w := range widths {
+				rule = append(rule, strings.Repeat("-", w))
+			}
+			lines = append(lines, strings.Join(rule, "-+-"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *textRenderer) inlines(nodes []*node) string {
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		switch n.kind {
+		case textNode:
+			buf.WriteString(n.text)
+		case emphNode:
+			buf.WriteString(r.style(ansiItalic, r.inlines(n.children), ansiItalicOff))
+		case strongNode:
+			buf.WriteString(r.style(ansiBold, r.inlines(n.children), ansiBoldOff))
+		case codeNode:
+			buf.WriteString(r.style(ansiCode, n.text, ansiColorOff))
+		case linkNode:
+			text := r.inlines(n.children)
+			plain := (&textRenderer{}).inlines(n.children)
+			buf.WriteString(r.style(ansiUnder, text, ansiUnderOff))
+			if plain != n.href {
+				buf.WriteString(r.style(ansiDim, " ("+n.href+")", ansiDimOff))
+			}
+		case refNode:
+			buf.WriteString(r.style(ansiUnder, n.text, ansiUnderOff))
+		case mentionNode:
+			buf.WriteString(r.style(ansiBold, "@"+n.text, ansiBoldOff))
+		case breakNode:
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
+// indent prefixes the first line of s with first and the others with rest
+func indent(s string, first string, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		p := rest
+		if i == 0 {
+			p = first
+		}
+		if l == "" {
+			p = strings.TrimRight(p, " ")
+		}
+		lines[i] = p + l
+	}
+	return strings.Join(lines, "\n")
+}
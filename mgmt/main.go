@@ -1,11 +1,110 @@
 package main
 
-import "github.com/go-martini/martini"
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/ehazlett/dialogue/db"
+)
+
+var (
+	log = logrus.New()
+)
+
+var dbFlags = []cli.Flag{
+	cli.StringFlag{"rethink-address", "127.0.0.1:28015", "RethinkDB Address"},
+	cli.StringFlag{"rethink-name", "dialogue", "RethinkDB Name"},
+}
+
+func getDb(c *cli.Context) *db.Rethinkdb {
+	rdb, err := db.NewRethinkdbSession(c.String("rethink-address"), c.String("rethink-name"))
+	if err != nil {
+		log.Fatalf("Unable to initialize database: %s", err)
+	}
+	return rdb
+}
+
+// parseAge returns the time the duration v before now, or the zero time if
+// v is empty
+func parseAge(v string) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("Invalid duration: %s", err)
+	}
+	return time.Now().Add(-d)
+}
+
+func mgmtArchive(c *cli.Context) {
+	createdBefore := parseAge(c.String("older-than"))
+	inactiveSince := parseAge(c.String("inactive-for"))
+	if createdBefore.IsZero() && inactiveSince.IsZero() {
+		log.Fatal("You must specify --older-than or --inactive-for")
+	}
+	n, err := getDb(c).ArchiveTopics(createdBefore, inactiveSince)
+	if err != nil {
+		log.Fatalf("Error archiving topics: %s", err)
+	}
+	log.Infof("Archived %d topics", n)
+}
+
+func mgmtAudit(c *cli.Context) {
+	var since *time.Time
+	if t := parseAge(c.String("since")); !t.IsZero() {
+		since = &t
+	}
+	entries, err := getDb(c).FindAuditEntries(c.String("action"), c.String("actor"), c.String("target"), since, nil, c.Int("limit"))
+	if err != nil {
+		log.Fatalf("Error getting audit log: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tACTION\tACTOR\tTARGET\tREMOTE\tDETAILS")
+	for _, e := range entries {
+		details := []string{}
+		for k, v := range e.Details {
+			details = append(details, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(details)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.Created.Format(time.RFC3339), e.Action, e.Actor, e.Target, e.RemoteAddr, strings.Join(details, " "))
+	}
+	w.Flush()
+}
 
 func main() {
-	m := martini.Classic()
-	m.Get("/", func() string {
-		return "Hello world from Discourse"
-	})
-	m.Run()
+	app := cli.NewApp()
+	app.Name = "dialogue-mgmt"
+	app.Usage = "Dialogue management"
+	app.Version = "0.0.1"
+	app.Commands = []cli.Command{
+		{
+			Name:   "archive",
+			Usage:  "archive old or inactive topics",
+			Action: mgmtArchive,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{"older-than", "", "Archive topics created longer ago than this (i.e. 8760h)"},
+				cli.StringFlag{"inactive-for", "", "Archive topics without posts for this long (i.e. 2160h)"},
+			}, dbFlags...),
+		},
+		{
+			Name:   "audit",
+			Usage:  "show the audit log",
+			Action: mgmtAudit,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{"action", "", "Only show this action (i.e. auth.login_failed)"},
+				cli.StringFlag{"actor", "", "Only show actions by this user"},
+				cli.StringFlag{"target", "", "Only show actions on this user or resource"},
+				cli.StringFlag{"since", "", "Only show actions within this long (i.e. 24h)"},
+				cli.IntFlag{"limit", 100, "Maximum number of entries"},
+			}, dbFlags...),
+		},
+	}
+	app.Run(os.Args)
 }